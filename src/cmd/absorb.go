@@ -0,0 +1,472 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yapaluc/hg-git/src/config"
+	"github.com/yapaluc/hg-git/src/git"
+	"github.com/yapaluc/hg-git/src/shell"
+
+	"github.com/alessio/shellescape"
+	"github.com/fatih/color"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+const absorbPatchFilePrefix = "ABSORB_PATCH_FILE_"
+
+// Message of the stash entry holding the working copy while absorb restacks.
+const absorbStashMessage = "hg absorb"
+
+func newAbsorbCmd() *cobra.Command {
+	var message string
+	var strategy string
+	var cont bool
+	var abort bool
+	var cmd = &cobra.Command{
+		Use:   "absorb [-m message] | --continue | --abort",
+		Short: "Commits each uncommitted change onto the branch of the current stack that last touched the changed lines, and restacks.",
+		Long: `Commits each uncommitted change onto the branch of the current stack (current branch and its ancestors) that last touched the changed lines, then restacks the descendants of the changed branches with the restack strategy of the repo, or the one given with --strategy.
+			Changes to lines from master, to lines touched by several branches, and to new, deleted or binary files are left in the working copy.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return recordOperation(func() error {
+				if cont {
+					return continueRestack()
+				}
+				if abort {
+					return abortAbsorb()
+				}
+				return runAbsorb(getConfig(cmd), message, strategy)
+			})
+		},
+	}
+	cmd.Flags().StringVarP(&message, "message", "m", "absorb", "Message of the commits created on each branch")
+	addRestackStrategyFlag(cmd, &strategy)
+	addRestackFlags(cmd, &cont, &abort)
+	for _, flag := range []string{"message", "strategy"} {
+		cmd.MarkFlagsMutuallyExclusive("continue", flag)
+		cmd.MarkFlagsMutuallyExclusive("abort", flag)
+	}
+	return cmd
+}
+
+// absorbFile is the diff of a file modified in the working copy.
+type absorbFile struct {
+	path string
+	// Lines of the diff before the first hunk.
+	header []string
+	hunks  []*absorbHunk
+	// Whether the file cannot be absorbed.
+	skip bool
+}
+
+// absorbHunk is a hunk of a diff without context.
+type absorbHunk struct {
+	file *absorbFile
+	// Line numbers in HEAD and the working copy, as in the hunk header.
+	oldStart int
+	oldCount int
+	newStart int
+	newCount int
+	// Lines removed and added, prefixed with "-" and "+".
+	lines []string
+}
+
+func runAbsorb(cfg *config.Config, message string, strategyFlag string) error {
+	strategy, err := getRestackStrategy(cfg, strategyFlag)
+	if err != nil {
+		return err
+	}
+	currBranch, err := git.GetCurrentBranch()
+	if err != nil {
+		return err
+	}
+	repoData, err := git.NewRepoData(git.RepoDataIncludeCommitMetadata)
+	if err != nil {
+		return err
+	}
+	currNode, ok := repoData.BranchNameToNode[currBranch]
+	if !ok {
+		return fmt.Errorf("missing node for branch %q", currBranch)
+	}
+	if currNode.CommitMetadata.IsEffectiveMaster() {
+		return fmt.Errorf("branch %q is not part of a stack", currBranch)
+	}
+	stack, err := getStack([]*git.TreeNode{currNode})
+	if err != nil {
+		return fmt.Errorf("getting stack: %w", err)
+	}
+
+	files, err := getAbsorbFiles()
+	if err != nil {
+		return err
+	}
+	commitToBranch, err := getStackBranchCommits(stack)
+	if err != nil {
+		return err
+	}
+	branchToHunks := make(map[string][]*absorbHunk)
+	var numSkipped int
+	for _, file := range files {
+		blame, lines, err := blameFile(file.path)
+		if err != nil {
+			return err
+		}
+		for _, hunk := range file.hunks {
+			branch := getAbsorbTarget(hunk, blame, commitToBranch)
+			if branch == "" {
+				numSkipped++
+				continue
+			}
+			addAbsorbContext(hunk, lines)
+			branchToHunks[branch] = append(branchToHunks[branch], hunk)
+		}
+	}
+	if len(branchToHunks) == 0 {
+		return fmt.Errorf("no changes to absorb")
+	}
+
+	// Branches are committed to and restacked from the bottom of the stack.
+	var targets []*stackEntry
+	for _, stackEntry := range stack {
+		hunks := branchToHunks[stackEntry.branchName]
+		if len(hunks) == 0 {
+			continue
+		}
+		targets = append(targets, stackEntry)
+		paths := lo.Uniq(lo.Map(hunks, func(hunk *absorbHunk, _ int) string { return hunk.file.path }))
+		color.Green(
+			"Absorbing %d %s into %s: %s",
+			len(hunks),
+			lo.Ternary(len(hunks) == 1, "change", "changes"),
+			stackEntry.branchName,
+			strings.Join(paths, ", "),
+		)
+	}
+	if numSkipped > 0 {
+		color.Yellow(
+			"Leaving %d %s in the working copy",
+			numSkipped,
+			lo.Ternary(numSkipped == 1, "change", "changes"),
+		)
+	}
+
+	steps, err := getDescendantRestackSteps(strategy, targets[0].node)
+	if err != nil {
+		return fmt.Errorf("finding restack order: %w", err)
+	}
+	plan, err := newRestackPlan(cfg, "absorb")
+	if err != nil {
+		return err
+	}
+	plan.Steps = steps
+	plan.BranchToCheckout = currBranch
+
+	// The working copy is stashed so that the branches can be checked out.
+	// The absorbed changes are part of the branches once restacked, so popping the stash only adds the others.
+	_, err = shell.Run(
+		shell.Opt{StreamOutputToStdout: true, PrintCommand: true},
+		fmt.Sprintf("git stash push -q -m %s", shellescape.Quote(absorbStashMessage)),
+	)
+	if err != nil {
+		return fmt.Errorf("stashing the working copy: %w", err)
+	}
+	for _, target := range targets {
+		err = commitAbsorbedHunks(target.branchName, branchToHunks[target.branchName], message)
+		if err != nil {
+			return fmt.Errorf("%w\nthe working copy is stashed: run `git stash pop` to restore it", err)
+		}
+	}
+
+	err = executeRestack(plan)
+	if err != nil {
+		return fmt.Errorf(
+			"executing restack: %w\nthe working copy is stashed: run `git stash pop` once the restack is done, "+
+				"or `hg absorb --abort` to restore it",
+			err,
+		)
+	}
+	_, err = shell.Run(
+		shell.Opt{StreamOutputToStdout: true, PrintCommand: true},
+		"git stash pop -q",
+	)
+	if err != nil {
+		return fmt.Errorf("restoring the changes that were not absorbed: %w", err)
+	}
+	return nil
+}
+
+// Aborts the restack, then restores the working copy that absorb stashed.
+func abortAbsorb() error {
+	plan, err := loadRestackPlan()
+	if err != nil {
+		return err
+	}
+	err = abortRestack()
+	if err != nil {
+		return err
+	}
+	if plan.Command != "absorb" {
+		return nil
+	}
+	stashRef, err := findAbsorbStash()
+	if err != nil {
+		return err
+	}
+	if stashRef == "" {
+		return nil
+	}
+	_, err = shell.Run(
+		shell.Opt{StreamOutputToStdout: true, PrintCommand: true},
+		fmt.Sprintf("git stash pop -q %s", shellescape.Quote(stashRef)),
+	)
+	if err != nil {
+		return fmt.Errorf("restoring the working copy: %w", err)
+	}
+	return nil
+}
+
+// Returns the most recent stash entry created by absorb, or an empty string if there is none.
+func findAbsorbStash() (string, error) {
+	// Format is:
+	//
+	//	stash@{<index>}<tab>On <branch name>: <message>
+	lines, err := shell.RunAndCollectLines(shell.Opt{}, "git stash list --format='%gd%x09%gs'")
+	if err != nil {
+		return "", fmt.Errorf("listing stash entries: %w", err)
+	}
+	for _, line := range lines {
+		stashRef, subject, ok := strings.Cut(line, "\t")
+		if ok && strings.HasSuffix(subject, ": "+absorbStashMessage) {
+			return stashRef, nil
+		}
+	}
+	return "", nil
+}
+
+// Returns the files modified in the working copy, with their hunks.
+// New, deleted, renamed and binary files, and mode changes, are left out since they cannot be absorbed.
+func getAbsorbFiles() ([]*absorbFile, error) {
+	lines, err := shell.RunAndCollectLines(
+		shell.Opt{},
+		"git -c core.quotePath=false diff HEAD -U0 --full-index --no-color --no-ext-diff --no-renames",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("getting the diff of the working copy: %w", err)
+	}
+
+	var files []*absorbFile
+	var file *absorbFile
+	for _, line := range lines {
+		if strings.HasPrefix(line, "diff --git ") {
+			file = &absorbFile{header: []string{line}}
+			files = append(files, file)
+			continue
+		}
+		if file == nil {
+			continue
+		}
+		if len(file.hunks) == 0 && !strings.HasPrefix(line, "@@ ") {
+			file.header = append(file.header, line)
+			if strings.HasPrefix(line, "new file mode") ||
+				strings.HasPrefix(line, "deleted file mode") ||
+				strings.HasPrefix(line, "old mode") ||
+				strings.HasPrefix(line, "Binary files") {
+				file.skip = true
+			}
+			if path, ok := strings.CutPrefix(line, "--- a/"); ok {
+				file.path = path
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "@@ ") {
+			hunk, err := parseAbsorbHunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			hunk.file = file
+			file.hunks = append(file.hunks, hunk)
+			continue
+		}
+		hunk := file.hunks[len(file.hunks)-1]
+		hunk.lines = append(hunk.lines, line)
+	}
+
+	return lo.Filter(files, func(file *absorbFile, _ int) bool {
+		return file.path != "" && len(file.hunks) > 0 && !file.skip
+	}), nil
+}
+
+var absorbHunkHeaderRegexp = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+func parseAbsorbHunkHeader(line string) (*absorbHunk, error) {
+	match := absorbHunkHeaderRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return nil, fmt.Errorf("parsing hunk header %q", line)
+	}
+	number := func(s string) int {
+		if s == "" {
+			// The count is omitted when it is 1.
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	return &absorbHunk{
+		oldStart: number(match[1]),
+		oldCount: number(match[2]),
+		newStart: number(match[3]),
+		newCount: number(match[4]),
+	}, nil
+}
+
+// Returns the branch that introduced each commit of the stack, i.e. the commits between a branch and its parent.
+func getStackBranchCommits(stack []*stackEntry) (map[string]string, error) {
+	commitToBranch := make(map[string]string)
+	for _, stackEntry := range stack {
+		commitHashes, err := shell.RunAndCollectLines(
+			shell.Opt{},
+			fmt.Sprintf(
+				"git rev-list %s..%s",
+				stackEntry.node.BranchParent.CommitMetadata.CommitHash,
+				shellescape.Quote(stackEntry.branchName),
+			),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("listing the commits of branch %q: %w", stackEntry.branchName, err)
+		}
+		for _, commitHash := range commitHashes {
+			commitToBranch[commitHash] = stackEntry.branchName
+		}
+	}
+	return commitToBranch, nil
+}
+
+// Returns the commit that last touched each line of the file in HEAD, and the lines. Both are indexed from 1.
+func blameFile(path string) ([]string, []string, error) {
+	out, err := shell.RunAndCollectLines(
+		shell.Opt{},
+		fmt.Sprintf(
+			"cd $(git rev-parse --show-toplevel) && git blame --porcelain HEAD -- %s",
+			shellescape.Quote(path),
+		),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("blaming %q: %w", path, err)
+	}
+	blame := []string{""}
+	lines := []string{""}
+	// Each line of the file is preceded by a header starting with "<commit hash> <original line> <final line>".
+	for _, line := range out {
+		if content, ok := strings.CutPrefix(line, "\t"); ok {
+			lines = append(lines, content)
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && len(fields[0]) == 40 {
+			if _, err := strconv.Atoi(fields[2]); err == nil {
+				blame = append(blame, fields[0])
+			}
+		}
+	}
+	return blame, lines, nil
+}
+
+// Returns the branch that last touched the lines changed by the hunk, or an empty string if there is none
+// or there are several. Lines inserted are attributed to the branch of the lines around them.
+func getAbsorbTarget(hunk *absorbHunk, blame []string, commitToBranch map[string]string) string {
+	var lineNums []int
+	if hunk.oldCount > 0 {
+		for i := hunk.oldStart; i < hunk.oldStart+hunk.oldCount; i++ {
+			lineNums = append(lineNums, i)
+		}
+	} else {
+		// The lines are inserted after line oldStart.
+		for _, i := range []int{hunk.oldStart, hunk.oldStart + 1} {
+			if i >= 1 && i < len(blame) {
+				lineNums = append(lineNums, i)
+			}
+		}
+	}
+	var branches []string
+	for _, i := range lineNums {
+		if i < 1 || i >= len(blame) {
+			return ""
+		}
+		branches = append(branches, commitToBranch[blame[i]])
+	}
+	branches = lo.Uniq(branches)
+	if len(branches) != 1 {
+		return ""
+	}
+	return branches[0]
+}
+
+// Adds the line before the hunk as context, so that lines are inserted at the right place
+// in branches where lines were added or removed above. That line is never changed by another hunk.
+func addAbsorbContext(hunk *absorbHunk, lines []string) {
+	contextLine := hunk.oldStart
+	if hunk.oldCount > 0 {
+		contextLine--
+	}
+	if contextLine < 1 || contextLine >= len(lines) {
+		return
+	}
+	hunk.oldStart = contextLine
+	hunk.oldCount++
+	if hunk.newCount > 0 {
+		hunk.newStart--
+	}
+	hunk.newCount++
+	hunk.lines = append([]string{" " + lines[contextLine]}, hunk.lines...)
+}
+
+// Commits the hunks onto the branch. The working copy must be clean.
+func commitAbsorbedHunks(branchName string, hunks []*absorbHunk, message string) error {
+	var sb strings.Builder
+	files := lo.Uniq(lo.Map(hunks, func(hunk *absorbHunk, _ int) *absorbFile { return hunk.file }))
+	for _, file := range files {
+		sb.WriteString(strings.Join(file.header, "\n") + "\n")
+		fileHunks := lo.Filter(hunks, func(hunk *absorbHunk, _ int) bool { return hunk.file == file })
+		sort.Slice(fileHunks, func(i, j int) bool { return fileHunks[i].oldStart < fileHunks[j].oldStart })
+		for _, hunk := range fileHunks {
+			fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", hunk.oldStart, hunk.oldCount, hunk.newStart, hunk.newCount)
+			sb.WriteString(strings.Join(hunk.lines, "\n") + "\n")
+		}
+	}
+
+	tmpFileName := fmt.Sprintf("%s%s_", absorbPatchFilePrefix, branchName)
+	tmpFileName = strings.ReplaceAll(tmpFileName, string(os.PathSeparator), "-")
+	tmpFile, err := os.CreateTemp(os.TempDir(), tmpFileName)
+	if err != nil {
+		return fmt.Errorf("creating temp file for patch: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+	_, err = tmpFile.WriteString(sb.String())
+	if err != nil {
+		return fmt.Errorf("writing patch to temp file %q: %w", tmpFile.Name(), err)
+	}
+
+	_, err = shell.Run(
+		shell.Opt{StreamOutputToStdout: true, PrintCommand: true},
+		// `git apply` runs relative to the working directory.
+		// Run it relative to the root of the repo to ensure the patch created above is accepted.
+		fmt.Sprintf(
+			"git switch -q %s && cd $(git rev-parse --show-toplevel) && git apply --3way --unidiff-zero %s && git commit -q -m %s",
+			shellescape.Quote(branchName),
+			tmpFile.Name(),
+			shellescape.Quote(message),
+		),
+	)
+	if err != nil {
+		return fmt.Errorf("committing the absorbed changes onto branch %q: %w", branchName, err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestAbsorb(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a1\na2\na3\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("a.txt", "a1\na2\na3\nb1\n", "b1")
+	repo.CommitFile("b.txt", "b1\nb2\n", "b2")
+	repo.CreateBranch("c")
+	repo.CommitFile("c.txt", "c\n", "c1")
+	repo.Checkout("b")
+	repo.WriteFile("a.txt", "a1\nfixed a2\na3\nb1\nb1.5\n")
+	repo.WriteFile("b.txt", "b1\nfixed b2\n")
+	repo.WriteFile("README.md", "changed\n")
+
+	g.Expect(runHg("absorb", "-m", "fix")).To(Succeed())
+
+	g.Expect(repo.CurrentBranch()).To(Equal("b"))
+	g.Expect(repo.Git("show", "a:a.txt")).To(Equal("a1\nfixed a2\na3"))
+	g.Expect(repo.Git("log", "-1", "--format=%s", "a")).To(Equal("fix"))
+	g.Expect(repo.Git("show", "b:a.txt")).To(Equal("a1\nfixed a2\na3\nb1\nb1.5"))
+	g.Expect(repo.Git("show", "b:b.txt")).To(Equal("b1\nfixed b2"))
+	g.Expect(repo.IsAncestor("a", "b")).To(BeTrue())
+	g.Expect(repo.IsAncestor("b", "c")).To(BeTrue())
+	// Changes to lines from master are left in the working copy.
+	g.Expect(repo.Git("status", "--porcelain")).To(Equal(" M README.md"))
+	g.Expect(repo.ReadFile("README.md")).To(Equal("changed\n"))
+}
+
+func TestAbsorb_abortAfterConflictRestoresWorkingCopy(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("f.txt", "1\n2\n3\n", "a1")
+	aHash := repo.Hash("a")
+	repo.CreateBranch("c")
+	repo.CommitFile("f.txt", "c\n2\n3\n", "c1")
+	repo.Checkout("a")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	bHash := repo.Hash("b")
+	repo.WriteFile("unrelated.txt", "unrelated\n")
+	repo.Git("stash", "push", "-q", "--include-untracked", "-m", "unrelated")
+	repo.WriteFile("f.txt", "fixed 1\n2\n3\n")
+	repo.WriteFile("README.md", "changed\n")
+
+	// The change is absorbed into a, which conflicts with c when restacking it.
+	g.Expect(runHg("absorb")).ToNot(Succeed())
+	g.Expect(runHg("absorb", "--abort")).To(Succeed())
+
+	g.Expect(repo.CurrentBranch()).To(Equal("b"))
+	g.Expect(repo.Hash("a")).To(Equal(aHash))
+	g.Expect(repo.Hash("b")).To(Equal(bHash))
+	g.Expect(repo.ReadFile("f.txt")).To(Equal("fixed 1\n2\n3\n"))
+	g.Expect(repo.ReadFile("README.md")).To(Equal("changed\n"))
+	// Only the stash entry of absorb was popped.
+	g.Expect(repo.Git("stash", "list", "--format=%gs")).To(Equal("On b: unrelated"))
+}
@@ -6,6 +6,7 @@ import (
 
 	"golang.org/x/term"
 
+	"github.com/yapaluc/hg-git/src/config"
 	"github.com/yapaluc/hg-git/src/git"
 	"github.com/yapaluc/hg-git/src/shell"
 
@@ -18,26 +19,44 @@ func newAmendCmd() *cobra.Command {
 	var message string
 	var force bool
 	var empty bool
+	var strategy string
+	var cont bool
+	var abort bool
 	var cmd = &cobra.Command{
-		Use:   "amend [-m message | -f force] [-e empty]",
-		Short: "Commits changes as a new commit on the current branch and restacks descendant branches via merges (not rebases).",
+		Use:   "amend [-m message | -f force] [-e empty] | --continue | --abort",
+		Short: "Commits changes as a new commit on the current branch and restacks descendant branches.",
+		Long:  "Commits changes as a new commit on the current branch and restacks descendant branches with the restack strategy of the repo, or the one given with --strategy.",
 		Args:  cobra.NoArgs,
-		RunE: func(_ *cobra.Command, _args []string) error {
-			return runAmend(message, force, empty)
+		RunE: func(cmd *cobra.Command, _args []string) error {
+			return recordOperation(func() error {
+				if cont {
+					return continueRestack()
+				}
+				if abort {
+					return abortRestack()
+				}
+				return runAmend(getConfig(cmd), message, force, empty, strategy)
+			})
 		},
 	}
 	cmd.Flags().StringVarP(&message, "message", "m", "", "Message to commit with")
-	cmd.Flags().BoolVarP(&force, "force", "f", false, "Use a default message")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Use the amendMessage setting as message")
 	cmd.Flags().
 		BoolVarP(&empty, "empty", "e", false, "Create an empty commit. The use case is to force a push to remote to trigger a build.")
+	addRestackStrategyFlag(cmd, &strategy)
+	addRestackFlags(cmd, &cont, &abort)
 	cmd.MarkFlagsMutuallyExclusive("message", "force")
+	cmd.MarkFlagsMutuallyExclusive("continue", "message", "force", "empty")
+	cmd.MarkFlagsMutuallyExclusive("abort", "message", "force", "empty")
+	cmd.MarkFlagsMutuallyExclusive("continue", "strategy")
+	cmd.MarkFlagsMutuallyExclusive("abort", "strategy")
 	return cmd
 }
 
-func runAmend(message string, force bool, empty bool) error {
+func runAmend(cfg *config.Config, message string, force bool, empty bool, strategyFlag string) error {
 	msg := message
 	if msg == "" && force {
-		msg = "update"
+		msg = cfg.AmendMessage
 	} else if empty {
 		msg = "empty commit"
 	}
@@ -45,6 +64,10 @@ func runAmend(message string, force bool, empty bool) error {
 		return fmt.Errorf("-m is required or specify -f to use a default")
 	}
 
+	strategy, err := getRestackStrategy(cfg, strategyFlag)
+	if err != nil {
+		return err
+	}
 	branch, err := git.GetCurrentBranch()
 	if err != nil {
 		return err
@@ -55,12 +78,18 @@ func runAmend(message string, force bool, empty bool) error {
 		return err
 	}
 
-	// Prepare merge arguments.
+	// Prepare restack steps.
 	currNode := repoData.BranchNameToNode[branch]
-	mergeArgs, err := getMergeArgs(currNode)
+	steps, err := getDescendantRestackSteps(strategy, currNode)
 	if err != nil {
 		return fmt.Errorf("finding restack order: %w", err)
 	}
+	plan, err := newRestackPlan(cfg, "amend")
+	if err != nil {
+		return err
+	}
+	plan.Steps = steps
+	plan.BranchToCheckout = branch
 
 	// Commit.
 	var allowEmptyFlag string
@@ -75,21 +104,11 @@ func runAmend(message string, force bool, empty bool) error {
 		return fmt.Errorf("committing: %w", err)
 	}
 
-	// Restack.
-	err = executeRestack(mergeArgs)
+	// Restack and checkout original branch.
+	err = executeRestack(plan)
 	if err != nil {
 		return fmt.Errorf("executing restack: %w", err)
 	}
-
-	// Checkout original branch.
-	_, err = shell.Run(
-		shell.Opt{StreamOutputToStdout: true, PrintCommand: true},
-		fmt.Sprintf("git switch %s", shellescape.Quote(branch)),
-	)
-	if err != nil {
-		return fmt.Errorf("checking out original branch %q: %w", branch, err)
-	}
-
 	return nil
 }
 
@@ -138,30 +157,6 @@ func getMergeArgs(currNode *git.TreeNode) ([]mergeArg, error) {
 	return mergeArgs, nil
 }
 
-func executeRestack(mergeArgs []mergeArg) error {
-	for _, mergeArg := range mergeArgs {
-		_, err := shell.Run(
-			shell.Opt{StreamOutputToStdout: true, PrintCommand: true},
-			fmt.Sprintf(
-				"git switch %s && git merge %s -m %s",
-				shellescape.Quote(mergeArg.branchToReceiveMerge),
-				shellescape.Quote(mergeArg.branchToMerge),
-				shellescape.Quote(
-					fmt.Sprintf("Sync changes from upstream (%s)", mergeArg.branchToMerge),
-				),
-			),
-		)
-		if err == nil {
-			continue
-		}
-		err = maybePromptForMergeConflictResolution("git commit --no-edit")
-		if err != nil {
-			return fmt.Errorf("waiting for merge conflict resolution: %w", err)
-		}
-	}
-	return nil
-}
-
 func maybePromptForMergeConflictResolution(resolutionCommand string) error {
 	for {
 		lines, err := shell.RunAndCollectLines(
@@ -181,6 +176,7 @@ func maybePromptForMergeConflictResolution(resolutionCommand string) error {
 
 		color.Yellow("Choose how to proceed:")
 		color.Yellow("  [o] Accept current branch (use ours for all conflicts)")
+		color.Yellow("  [q] Stop here, resolve later and resume with --continue (or roll back with --abort)")
 		color.Yellow(
 			"  [any other key] Resolve manually, then continue (no need to add files or continue the merge/rebase)",
 		)
@@ -192,6 +188,8 @@ func maybePromptForMergeConflictResolution(resolutionCommand string) error {
 		var cmd string
 
 		switch input {
+		case 'q', 'Q', ctrlC:
+			return errRestackPaused
 		case 'o', 'O':
 			color.Green("Accepting current branch for all conflicts (ours)")
 			cmd = "git checkout --ours . && git add --all && " + resolutionCommand
@@ -211,6 +209,9 @@ func maybePromptForMergeConflictResolution(resolutionCommand string) error {
 	return nil
 }
 
+// Raw mode disables signals, so Ctrl-C is read as a regular byte.
+const ctrlC = 3
+
 func waitForUserInput() (rune, error) {
 	// save terminal state to restore later
 	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
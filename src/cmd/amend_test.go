@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestAmend_restacksDescendants(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.CreateBranch("c")
+	repo.CommitFile("c.txt", "c\n", "c1")
+	repo.Checkout("a")
+
+	repo.WriteFile("a.txt", "a amended\n")
+	g.Expect(runHg("amend", "-m", "a2")).To(Succeed())
+
+	g.Expect(repo.CurrentBranch()).To(Equal("a"))
+	g.Expect(repo.Git("log", "-1", "--format=%s", "a")).To(Equal("a2"))
+	g.Expect(repo.IsAncestor("a", "b")).To(BeTrue())
+	g.Expect(repo.IsAncestor("b", "c")).To(BeTrue())
+	g.Expect(repo.Git("show", "c:a.txt")).To(Equal("a amended"))
+}
+
+func TestAmend_rebaseStrategy(t *testing.T) {
+	for _, strategy := range []restackStrategy{restackStrategyRebase, restackStrategyRebaseUpdateRefs} {
+		t.Run(string(strategy), func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			repo := testutil.NewRepo(t)
+			repo.Git("config", "hggit.restackStrategy", string(strategy))
+			repo.CreateBranch("a")
+			repo.CommitFile("a.txt", "a\n", "a1")
+			repo.CreateBranch("b")
+			repo.CommitFile("b.txt", "b\n", "b1")
+			repo.CreateBranch("c")
+			repo.CommitFile("c.txt", "c\n", "c1")
+			repo.Checkout("b")
+			repo.CreateBranch("d")
+			repo.CommitFile("d.txt", "d\n", "d1")
+			repo.Checkout("a")
+
+			repo.WriteFile("a.txt", "a amended\n")
+			g.Expect(runHg("amend", "-m", "a2")).To(Succeed())
+
+			g.Expect(repo.CurrentBranch()).To(Equal("a"))
+			g.Expect(repo.IsAncestor("a", "b")).To(BeTrue())
+			g.Expect(repo.IsAncestor("b", "c")).To(BeTrue())
+			g.Expect(repo.IsAncestor("b", "d")).To(BeTrue())
+			g.Expect(repo.Git("log", "--format=%s", "main..c")).To(Equal("c1\nb1\na2\na1"))
+			g.Expect(repo.Git("log", "--format=%s", "main..d")).To(Equal("d1\nb1\na2\na1"))
+		})
+	}
+}
+
+func TestAmend_strategyFlagOverridesConfig(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.Git("config", "hggit.restackStrategy", string(restackStrategyRebase))
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	bHash := repo.Hash("b")
+	repo.Checkout("a")
+
+	repo.WriteFile("a.txt", "a amended\n")
+	g.Expect(runHg("amend", "-m", "a2", "--strategy", "merge")).To(Succeed())
+
+	g.Expect(repo.Hash("b^")).To(Equal(bHash))
+	g.Expect(repo.IsAncestor("a", "b")).To(BeTrue())
+}
+
+func TestAmend_continueAfterConflict(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("f.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("f.txt", "b\n", "b1")
+	repo.Checkout("a")
+
+	repo.WriteFile("f.txt", "a amended\n")
+	// The conflict prompt cannot be answered without a terminal, so the restack stops.
+	g.Expect(runHg("amend", "-m", "a2")).ToNot(Succeed())
+	g.Expect(repo.Status()).To(ContainSubstring("UU f.txt"))
+
+	repo.WriteFile("f.txt", "resolved\n")
+	g.Expect(runHg("amend", "--continue")).To(Succeed())
+
+	g.Expect(repo.CurrentBranch()).To(Equal("a"))
+	g.Expect(repo.Status()).To(BeEmpty())
+	g.Expect(repo.IsAncestor("a", "b")).To(BeTrue())
+	g.Expect(repo.Git("show", "b:f.txt")).To(Equal("resolved"))
+}
+
+func TestAmend_abortAfterConflict(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("f.txt", "a\n", "a1")
+	aHash := repo.Hash("a")
+	repo.CreateBranch("b")
+	repo.CommitFile("f.txt", "b\n", "b1")
+	bHash := repo.Hash("b")
+	repo.Checkout("a")
+
+	repo.WriteFile("f.txt", "a amended\n")
+	g.Expect(runHg("amend", "-m", "a2")).ToNot(Succeed())
+	g.Expect(runHg("amend", "--abort")).To(Succeed())
+
+	g.Expect(repo.Hash("a")).To(Equal(aHash))
+	g.Expect(repo.Hash("b")).To(Equal(bHash))
+	g.Expect(runHg("amend", "--continue")).ToNot(Succeed())
+}
@@ -40,6 +40,11 @@ func runBookmark(args []string, delete bool, rev string) error {
 func createBookmark(branchName string, rev string) error {
 	var cmd string
 	if rev != "" {
+		// Resolve before switching away, which would change what "." refers to.
+		commitHash, err := git.ResolveRev(rev)
+		if err != nil {
+			return fmt.Errorf("resolving rev %q: %w", rev, err)
+		}
 		currBranch, err := git.GetCurrentBranch()
 		if err != nil {
 			return fmt.Errorf("getting current branch: %w", err)
@@ -54,7 +59,7 @@ func createBookmark(branchName string, rev string) error {
 		cmd = fmt.Sprintf(
 			"git branch %s %s -f",
 			shellescape.Quote(branchName),
-			shellescape.Quote(rev),
+			shellescape.Quote(commitHash),
 		)
 	} else {
 		cmd = fmt.Sprintf("git switch -C %s", shellescape.Quote(branchName))
@@ -5,32 +5,67 @@ import (
 	"strings"
 
 	"github.com/samber/lo"
+	"github.com/yapaluc/hg-git/src/config"
 	"github.com/yapaluc/hg-git/src/git"
 	"github.com/yapaluc/hg-git/src/shell"
 
-	"github.com/fatih/color"
+	"github.com/alessio/shellescape"
 	"github.com/spf13/cobra"
 )
 
 func newCleanupCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "cleanup",
+	var strategy string
+	var cont bool
+	var abort bool
+	var cmd = &cobra.Command{
+		Use:   "cleanup [--strategy strategy] | --continue | --abort",
 		Short: "Cleanup merged branches and rebase their descendants on master.",
+		Long:  "Cleanup merged branches and restack their descendants on master with the restack strategy of the repo, or the one given with --strategy.",
 		Args:  cobra.NoArgs,
-		RunE:  runCleanup,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return recordOperation(func() error {
+				if cont {
+					return continueRestack()
+				}
+				if abort {
+					return abortRestack()
+				}
+				return runCleanup(getConfig(cmd), strategy)
+			})
+		},
 	}
+	addRestackStrategyFlag(cmd, &strategy)
+	addRestackFlags(cmd, &cont, &abort)
+	cmd.MarkFlagsMutuallyExclusive("continue", "strategy")
+	cmd.MarkFlagsMutuallyExclusive("abort", "strategy")
+	return cmd
 }
 
-func runCleanup(cmd *cobra.Command, args []string) error {
+func runCleanup(cfg *config.Config, strategyFlag string) error {
+	strategy, err := getRestackStrategy(cfg, strategyFlag)
+	if err != nil {
+		return err
+	}
+	return cleanupMergedBranches(cfg, nil, strategy)
+}
+
+// Deletes the branches pruned from the remote and the given merged branches,
+// and restacks their descendants on master.
+func cleanupMergedBranches(cfg *config.Config, mergedBranches []string, strategy restackStrategy) error {
 	currentBranch, err := git.GetCurrentBranch()
 	if err != nil {
 		return err
 	}
+	plan, err := newRestackPlan(cfg, "cleanup")
+	if err != nil {
+		return err
+	}
 
-	prunedBranches, err := pruneBranches()
+	prunedBranches, err := pruneBranches(cfg.PushRemote)
 	if err != nil {
 		return err
 	}
+	prunedBranches = lo.Uniq(append(prunedBranches, mergedBranches...))
 
 	repoData, err := git.NewRepoData(git.RepoDataIncludeCommitMetadata)
 	if err != nil {
@@ -38,58 +73,57 @@ func runCleanup(cmd *cobra.Command, args []string) error {
 	}
 
 	masterNode := repoData.BranchNameToNode[repoData.MasterBranch]
-	branchToMergeArgs := make(map[string][]mergeArg)
+	branchToRestackSteps := make(map[string][]restackStep)
 	for _, prunedBranch := range prunedBranches {
 		prunedNode, ok := repoData.BranchNameToNode[prunedBranch]
 		if !ok {
 			continue
 		}
-		branchToMergeArgs[prunedBranch], err = getMergeArgsForCleanup(prunedNode, masterNode)
+		branchToRestackSteps[prunedBranch], err = getRestackStepsForCleanup(strategy, prunedNode, masterNode)
 		if err != nil {
 			return fmt.Errorf(
-				"getting merge args for cleanup of pruned branch %q: %w",
+				"getting restack steps for cleanup of pruned branch %q: %w",
 				prunedBranch,
 				err,
 			)
 		}
 	}
 
-	err = pull()
+	err = pull(cfg.BaseRemote)
 	if err != nil {
 		return fmt.Errorf("pulling latest changes: %w", err)
 	}
 
-	for prunedBranch, mergeArgs := range branchToMergeArgs {
-		color.Green("Pruning branch: %s", prunedBranch)
-
-		// Delete the local branch.
-		err := deleteBranches([]string{prunedBranch})
-		if err != nil {
-			return fmt.Errorf("deleting local pruned branch %q: %w", prunedBranch, err)
-		}
-
-		// Restack.
-		err = executeRestack(mergeArgs)
-		if err != nil {
-			return fmt.Errorf("executing restack of pruned branch %q: %w", prunedBranch, err)
-		}
+	for prunedBranch, restackSteps := range branchToRestackSteps {
+		plan.Steps = append(plan.Steps, deleteBranchStep(prunedBranch))
+		plan.Steps = append(plan.Steps, restackSteps...)
 	}
 
 	// Checkout the original branch or master if the original branch was pruned.
-	branchToCheckout := currentBranch
+	plan.BranchToCheckout = currentBranch
 	if lo.Contains(prunedBranches, currentBranch) {
-		branchToCheckout = repoData.MasterBranch
+		plan.BranchToCheckout = repoData.MasterBranch
 	}
-	return updateRev(branchToCheckout, nil)
+	return executeRestack(plan)
 }
 
-const prunePrefix = " * [pruned] origin/"
+// Prefix of the lines listing the pruned branches, followed by the name of the remote.
+const prunePrefix = " * [pruned] "
+
+const dryRunPrunePrefix = " * [would prune] "
 
 // Prune local tracking branches that don't exist on the remote.
-func pruneBranches() ([]string, error) {
+// In a dry run, returns the branches that would be pruned.
+func pruneBranches(remote string) ([]string, error) {
+	cmd := fmt.Sprintf("git remote prune %s", shellescape.Quote(remote))
+	prefix := prunePrefix + remote + "/"
+	if dryRun {
+		cmd = fmt.Sprintf("git remote prune --dry-run %s", shellescape.Quote(remote))
+		prefix = dryRunPrunePrefix + remote + "/"
+	}
 	lines, err := shell.RunAndCollectLines(
 		shell.Opt{StreamOutputToStdout: true, PrintCommand: true},
-		"git remote prune origin",
+		cmd,
 	)
 	if err != nil {
 		return nil, fmt.Errorf(
@@ -100,58 +134,30 @@ func pruneBranches() ([]string, error) {
 
 	var prunedBranches []string
 	for _, line := range lines {
-		if strings.HasPrefix(line, prunePrefix) {
-			prunedBranches = append(prunedBranches, strings.TrimPrefix(line, prunePrefix))
+		if strings.HasPrefix(line, prefix) {
+			prunedBranches = append(prunedBranches, strings.TrimPrefix(line, prefix))
 		}
 	}
 	return prunedBranches, nil
 }
 
-// Run a depth-first search from the pruned branch to find
-// the children branches and the order in which to merge them.
-func getMergeArgsForCleanup(
+// Returns the steps that restack the children of the pruned branch and their descendants on master.
+func getRestackStepsForCleanup(
+	strategy restackStrategy,
 	prunedNode *git.TreeNode,
 	masterNode *git.TreeNode,
-) ([]mergeArg, error) {
-	var mergeArgs []mergeArg
-	var dfs func(node *git.TreeNode, parent *git.TreeNode) error
-	dfs = func(node *git.TreeNode, parent *git.TreeNode) error {
-		// Switch out the pruned node for master.
-		if parent == prunedNode {
-			parent = masterNode
-		}
-
-		if parent != nil {
-			if len(parent.CommitMetadata.CleanedBranchNames()) == 0 {
-				return fmt.Errorf(
-					"expected branch names on commit %s",
-					parent.CommitMetadata.CommitHash,
-				)
-			}
-			if len(node.CommitMetadata.CleanedBranchNames()) == 0 {
-				return fmt.Errorf(
-					"expected branch names on commit %s",
-					node.CommitMetadata.CommitHash,
-				)
-			}
-			mergeArgs = append(mergeArgs, mergeArg{
-				branchToMerge:        parent.CommitMetadata.CleanedBranchNames()[0],
-				branchToReceiveMerge: node.CommitMetadata.CleanedBranchNames()[0],
-			})
-		}
-		for _, child := range node.BranchChildren {
-			err := dfs(child, node)
-			if err != nil {
-				return err
-			}
-		}
-		return nil
+) ([]restackStep, error) {
+	masterBranchNames := masterNode.CommitMetadata.CleanedBranchNames()
+	if len(masterBranchNames) == 0 {
+		return nil, fmt.Errorf("expected branch names on commit %s", masterNode.CommitMetadata.CommitHash)
 	}
-
-	err := dfs(prunedNode, nil /* parent */)
-	if err != nil {
-		return nil, err
+	var steps []restackStep
+	for _, child := range sortedChildren(prunedNode) {
+		childSteps, err := getRestackSteps(strategy, child, masterBranchNames[0], child.BaseCommitHash())
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, childSteps...)
 	}
-
-	return mergeArgs, nil
+	return steps, nil
 }
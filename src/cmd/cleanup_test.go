@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestCleanup_deletesMergedBranchAndRestacksDescendants(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	aHash := repo.CommitFile("a.txt", "a\n", "a1")
+	repo.Git("push", "-q", "-u", "origin", "a")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.CreateBranch("c")
+	repo.CommitFile("c.txt", "c\n", "c1")
+	repo.Checkout("b")
+
+	// Merge a on the remote and delete its branch.
+	repo.OriginGit("update-ref", "refs/heads/main", aHash)
+	repo.OriginGit("update-ref", "-d", "refs/heads/a")
+
+	g.Expect(runHg("cleanup")).To(Succeed())
+
+	g.Expect(repo.CurrentBranch()).To(Equal("b"))
+	g.Expect(repo.BranchExists("a")).To(BeFalse())
+	g.Expect(repo.Hash("main")).To(Equal(aHash))
+	g.Expect(repo.IsAncestor("main", "b")).To(BeTrue())
+	g.Expect(repo.IsAncestor("b", "c")).To(BeTrue())
+}
+
+func TestCleanup_checksOutMasterIfCurrentBranchWasMerged(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	aHash := repo.CommitFile("a.txt", "a\n", "a1")
+	repo.Git("push", "-q", "-u", "origin", "a")
+
+	repo.OriginGit("update-ref", "refs/heads/main", aHash)
+	repo.OriginGit("update-ref", "-d", "refs/heads/a")
+
+	g.Expect(runHg("cleanup")).To(Succeed())
+
+	g.Expect(repo.CurrentBranch()).To(Equal("main"))
+	g.Expect(repo.BranchExists("a")).To(BeFalse())
+}
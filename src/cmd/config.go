@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yapaluc/hg-git/src/config"
+	"github.com/yapaluc/hg-git/src/git"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+type configContextKey struct{}
+
+func newConfigCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "config [key]",
+		Short: "Shows the effective hg-git settings and where they come from.",
+		Long: `Shows the effective hg-git settings and where they come from.
+			Settings are read from ~/.config/hg-git/config.yaml, then .hg-git.yaml in the repo root, then git config under hggit (e.g. git config hggit.remote upstream). Later sources take precedence.
+			With a key, only prints the value of that setting, one line per value for lists.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfig(getConfig(cmd), args)
+		},
+	}
+}
+
+func runConfig(cfg *config.Config, args []string) error {
+	if len(args) == 1 {
+		setting, ok := cfg.Get(args[0])
+		if !ok {
+			return fmt.Errorf("unknown setting %q", args[0])
+		}
+		for _, value := range setting.Values {
+			fmt.Println(value)
+		}
+		return nil
+	}
+
+	for _, setting := range cfg.Settings() {
+		fmt.Printf(
+			"%s = %s %s\n",
+			setting.Key,
+			formatSettingValues(setting),
+			color.HiBlackString("(%s)", setting.Source),
+		)
+	}
+	return nil
+}
+
+// Lists are quoted since prefixes may end with spaces, and templates are printed on one line.
+func formatSettingValues(setting config.Setting) string {
+	if setting.Key == "hiddenBranchPrefixes" {
+		quoted := make([]string, 0, len(setting.Values))
+		for _, value := range setting.Values {
+			quoted = append(quoted, strconv.Quote(value))
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+	return strings.NewReplacer("\n", `\n`, "\t", `\t`).Replace(strings.Join(setting.Values, ""))
+}
+
+// Loads the config for the command being run, to be read with getConfig.
+func loadConfig(cmd *cobra.Command) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	git.Configure(cfg)
+	cmd.SetContext(context.WithValue(cmd.Context(), configContextKey{}, cfg))
+	return nil
+}
+
+// Returns the config loaded before the command ran, or the default config if none was.
+func getConfig(cmd *cobra.Command) *config.Config {
+	if cmd.Context() == nil {
+		return config.Default()
+	}
+	cfg, ok := cmd.Context().Value(configContextKey{}).(*config.Config)
+	if !ok {
+		return config.Default()
+	}
+	return cfg
+}
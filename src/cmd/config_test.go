@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestConfig_precedence(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	userConfigPath := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "hg-git", "config.yaml")
+	g.Expect(os.MkdirAll(filepath.Dir(userConfigPath), 0o755)).To(Succeed())
+	g.Expect(os.WriteFile(
+		userConfigPath,
+		[]byte("amendMessage: wip\nsyncMessage: Merge parent\ndraft: true\n"),
+		0o644,
+	)).To(Succeed())
+	repo.WriteFile(".hg-git.yaml", "syncMessage: Restack\nhiddenBranchPrefixes: [\"refs/branchless/\", \"backup/\"]\n")
+	repo.Git("config", "hggit.draft", "false")
+
+	out, err := runHgAndCaptureOutput(t, "config")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(ContainSubstring("remote = origin (default)"))
+	g.Expect(out).To(ContainSubstring("amendMessage = wip (" + userConfigPath + ")"))
+	g.Expect(out).To(ContainSubstring("syncMessage = Restack (" + filepath.Join(repo.Dir, ".hg-git.yaml") + ")"))
+	g.Expect(out).To(ContainSubstring(`hiddenBranchPrefixes = ["refs/branchless/", "backup/"]`))
+	g.Expect(out).To(MatchRegexp(`draft = false \(git config .*config\)`))
+
+	out, err = runHgAndCaptureOutput(t, "config", "syncmessage")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(Equal("Restack\n"))
+	g.Expect(runHg("config", "nope")).To(MatchError(ContainSubstring(`unknown setting "nope"`)))
+}
+
+func TestConfig_invalidFileSettingIsWarned(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.WriteFile(".hg-git.yaml", "remtoe: upstream\ndraft: maybe\n")
+	configPath := filepath.Join(repo.Dir, ".hg-git.yaml")
+
+	out, err := runHgAndCaptureStderr(t, "sl")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(ContainSubstring(`Ignoring draft (` + configPath + `): draft: invalid boolean "maybe"`))
+	g.Expect(out).To(ContainSubstring(`Ignoring remtoe (` + configPath + `): unknown setting "remtoe"`))
+
+	repo.WriteFile(".hg-git.yaml", "remote: [\n")
+	g.Expect(runHg("sl")).To(MatchError(ContainSubstring("parsing config file")))
+}
+
+func TestConfig_invalidGitConfigIsWarned(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.Git("config", "hggit.draft", "maybe")
+	repo.Git("config", "hggit.remtoe", "upstream")
+
+	out, err := runHgAndCaptureStderr(t, "config")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(ContainSubstring(`Ignoring hggit.draft (git config .git/config): draft: invalid boolean "maybe"`))
+	g.Expect(out).To(ContainSubstring(`Ignoring hggit.remtoe (git config .git/config): unknown setting "remtoe"`))
+
+	out, err = runHgAndCaptureOutput(t, "config")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(ContainSubstring("draft = false (default)"))
+}
+
+func TestConfig_invalidRestackStrategy(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		set    func(repo *testutil.Repo)
+		source func(repo *testutil.Repo) string
+	}{
+		{
+			name: "git config",
+			set: func(repo *testutil.Repo) {
+				repo.Git("config", "hggit.restackStrategy", "squash")
+			},
+			source: func(*testutil.Repo) string {
+				return "hggit.restackstrategy (git config .git/config)"
+			},
+		},
+		{
+			name: "config file",
+			set: func(repo *testutil.Repo) {
+				repo.WriteFile(".hg-git.yaml", "restackStrategy: squash\n")
+			},
+			source: func(repo *testutil.Repo) string {
+				return "restackStrategy (" + filepath.Join(repo.Dir, ".hg-git.yaml") + ")"
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			repo := testutil.NewRepo(t)
+			tc.set(repo)
+
+			out, err := runHgAndCaptureStderr(t, "config")
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(out).To(ContainSubstring(
+				"Ignoring " + tc.source(repo) + `: restackStrategy: unknown restack strategy "squash"`,
+			))
+			out, err = runHgAndCaptureOutput(t, "config")
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(out).To(ContainSubstring("restackStrategy = merge (default)"))
+		})
+	}
+}
+
+func TestConfig_derivedRemoteSources(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.WriteFile(".hg-git.yaml", "remote: upstream\n")
+	repo.Git("config", "hggit.pushRemote", "fork")
+	configPath := filepath.Join(repo.Dir, ".hg-git.yaml")
+
+	out, err := runHgAndCaptureOutput(t, "config")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(ContainSubstring("remote = upstream (" + configPath + ")"))
+	g.Expect(out).To(ContainSubstring("pushRemote = fork (git config .git/config)"))
+	g.Expect(out).To(ContainSubstring("baseRemote = upstream (" + configPath + ")"))
+}
+
+func TestConfig_messages(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CommitFile(".hg-git.yaml", "amendMessage: wip\nsyncMessage: Restack\n", "Add hg-git config")
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.Checkout("a")
+
+	repo.WriteFile("a.txt", "a2\n")
+	g.Expect(runHg("amend", "-f")).To(Succeed())
+
+	g.Expect(repo.Git("log", "-1", "--format=%s", "a")).To(Equal("wip"))
+	g.Expect(repo.Git("log", "-1", "--format=%s", "b")).To(Equal("Restack (a)"))
+}
+
+func TestConfig_remote(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	repo.Git("remote", "rename", "origin", "upstream")
+	repo.Git("config", "hggit.remote", "upstream")
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+
+	g.Expect(runHg("submit")).To(Succeed())
+	g.Expect(repo.OriginGit("rev-parse", "a")).To(Equal(repo.Hash("a")))
+	g.Expect(gh.PRs()).To(HaveLen(1))
+
+	out, err := runHgAndCaptureOutput(t, "sl")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(ContainSubstring("(a)"))
+	g.Expect(out).ToNot(ContainSubstring("upstream/"))
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestDiff_gitAncestorOfBranchTip(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a1\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b1\n", "b1")
+	repo.CommitFile("b.txt", "b2\n", "b2")
+
+	// HEAD~1 is the previous commit of the branch, not the tip of the parent branch.
+	out, err := runHgAndCaptureOutput(t, "diff", "-r", "HEAD~1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(ContainSubstring("-b1"))
+	g.Expect(out).ToNot(ContainSubstring("new file mode"))
+
+	out, err = runHgAndCaptureOutput(t, "diff", "-r", "b^")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(ContainSubstring("-b1"))
+	g.Expect(out).ToNot(ContainSubstring("new file mode"))
+
+	// .^ is still the parent branch.
+	out, err = runHgAndCaptureOutput(t, "diff", "-r", ".^")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).ToNot(ContainSubstring("-b1"))
+	g.Expect(out).To(ContainSubstring("new file mode"))
+}
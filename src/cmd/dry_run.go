@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/yapaluc/hg-git/src/git"
+	"github.com/yapaluc/hg-git/src/shell"
+)
+
+// dryRun is set by the --dry-run flag. Mutating git and gh commands are printed instead of run,
+// and commands print their plans instead of executing them or persisting any state.
+var dryRun bool
+
+var restoreRunnerAfterDryRun func()
+
+func startDryRun() {
+	dryRun = true
+	git.SetDryRun(true)
+	restoreRunnerAfterDryRun = shell.SetDefaultRunner(shell.NewDryRunRunner(shell.DefaultRunner()))
+}
+
+// No-op if not in a dry run.
+func stopDryRun() {
+	if !dryRun {
+		return
+	}
+	restoreRunnerAfterDryRun()
+	dryRun = false
+	git.SetDryRun(false)
+}
+
+func printDryRun(format string, args ...any) {
+	fmt.Printf("[dry-run] "+format+"\n", args...)
+}
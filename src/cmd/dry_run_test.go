@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/git"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+// Returns the refs of the repo and of its remote, and the status of the working copy.
+func repoState(repo *testutil.Repo) []string {
+	return []string{
+		repo.Git("for-each-ref", "--format=%(refname) %(objectname)"),
+		repo.OriginGit("for-each-ref", "--format=%(refname) %(objectname)"),
+		repo.Git("config", "--get-regexp", "^branch\\."),
+		repo.Status(),
+		repo.CurrentBranch(),
+	}
+}
+
+func expectNoOperationRecorded(g *gomega.WithT) {
+	oplog, err := git.LoadOplog()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(oplog.Entries).To(BeEmpty())
+	plan, err := loadRestackPlan()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(plan).To(BeNil())
+}
+
+func TestDryRun_amend(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.Checkout("a")
+	repo.WriteFile("a.txt", "a amended\n")
+	before := repoState(repo)
+
+	g.Expect(runHg("amend", "--dry-run", "-m", "a2")).To(Succeed())
+
+	g.Expect(repoState(repo)).To(Equal(before))
+	expectNoOperationRecorded(g)
+	g.Expect(dryRun).To(BeFalse())
+}
+
+func TestDryRun_rebase(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.Checkout("main")
+	repo.CommitFile("main.txt", "main\n", "main2")
+	repo.Checkout("a")
+	before := repoState(repo)
+
+	g.Expect(runHg("rebase", "--dry-run", "-s", "a", "-d", "main")).To(Succeed())
+
+	g.Expect(repoState(repo)).To(Equal(before))
+	expectNoOperationRecorded(g)
+}
+
+func TestDryRun_cleanup(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	aHash := repo.CommitFile("a.txt", "a\n", "a1")
+	repo.Git("push", "-q", "-u", "origin", "a")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.OriginGit("update-ref", "refs/heads/main", aHash)
+	repo.OriginGit("update-ref", "-d", "refs/heads/a")
+	before := repoState(repo)
+
+	g.Expect(runHg("cleanup", "--dry-run")).To(Succeed())
+
+	g.Expect(repoState(repo)).To(Equal(before))
+	expectNoOperationRecorded(g)
+}
+
+func TestDryRun_squash(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CommitFile("a.txt", "a\na\n", "a2")
+	before := repoState(repo)
+
+	out, err := runHgAndCaptureOutput(t, "squash", "--dry-run")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// Only the plan is printed, not the commands that would carry it out.
+	g.Expect(out).To(ContainSubstring(`[dry-run] squash a: diff from`))
+	g.Expect(out).ToNot(ContainSubstring("git apply"))
+	g.Expect(out).ToNot(ContainSubstring("git commit"))
+	g.Expect(repoState(repo)).To(Equal(before))
+	expectNoOperationRecorded(g)
+}
+
+func TestDryRun_submit(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	g.Expect(runHg("submit")).To(Succeed())
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.SetBranchDescription("a", "New title of a", "Description of a")
+	prBefore := *gh.PR(1)
+	before := repoState(repo)
+
+	g.Expect(runHg("submit", "--dry-run", "--stack")).To(Succeed())
+
+	g.Expect(repoState(repo)).To(Equal(before))
+	g.Expect(gh.PRs()).To(HaveLen(1))
+	g.Expect(*gh.PR(1)).To(Equal(prBefore))
+}
+
+func TestDryRun_doesNotWriteCaches(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+
+	g.Expect(runHg("sl", "--dry-run")).To(Succeed())
+
+	hgGitDir, err := git.GetHgGitDir()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(os.ReadDir(hgGitDir)).To(BeEmpty())
+}
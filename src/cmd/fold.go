@@ -0,0 +1,343 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yapaluc/hg-git/src/config"
+	"github.com/yapaluc/hg-git/src/git"
+	"github.com/yapaluc/hg-git/src/github"
+
+	"github.com/fatih/color"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+func newFoldCmd() *cobra.Command {
+	var from string
+	var strategy string
+	var cont bool
+	var abort bool
+	var cmd = &cobra.Command{
+		Use:   "fold --from <branch> | --continue | --abort",
+		Short: "Folds the given branch into the current branch, which must be its parent or child branch.",
+		Long: `Folds the given branch into the current branch, which must be its parent or child branch, and deletes the given branch.
+			The branch descriptions are combined in stack order under the title of the current branch, and the descendants of both branches are restacked on the current branch with the restack strategy of the repo, or the one given with --strategy.
+			If the folded branch has a PR, the PRs based on it are retargeted, it is closed with a comment pointing at the PR of the current branch, and the stack is updated in the bodies of the remaining PRs.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return recordOperation(func() error {
+				if cont {
+					return continueFold(getConfig(cmd))
+				}
+				if abort {
+					return abortRestack()
+				}
+				if from == "" {
+					return fmt.Errorf("--from is required")
+				}
+				return runFold(getConfig(cmd), from, strategy)
+			})
+		},
+	}
+	cmd.Flags().StringVar(&from, "from", "", "Branch to fold into the current branch")
+	addRestackStrategyFlag(cmd, &strategy)
+	addRestackFlags(cmd, &cont, &abort)
+	for _, flag := range []string{"from", "strategy"} {
+		cmd.MarkFlagsMutuallyExclusive("continue", flag)
+		cmd.MarkFlagsMutuallyExclusive("abort", flag)
+	}
+	return cmd
+}
+
+func runFold(cfg *config.Config, from string, strategyFlag string) error {
+	strategy, err := getRestackStrategy(cfg, strategyFlag)
+	if err != nil {
+		return err
+	}
+	repoData, err := git.NewRepoData(
+		git.RepoDataIncludeCommitMetadata,
+		git.RepoDataIncludeBranchDescription,
+	)
+	if err != nil {
+		return err
+	}
+	currBranch, err := git.GetCurrentBranch()
+	if err != nil {
+		return err
+	}
+	node, ok := repoData.BranchNameToNode[currBranch]
+	if !ok {
+		return fmt.Errorf("missing node for branch %q", currBranch)
+	}
+	foldedNode, ok := repoData.BranchNameToNode[from]
+	if !ok {
+		return fmt.Errorf("missing node for branch %q", from)
+	}
+	if node.CommitMetadata.IsEffectiveMaster() || foldedNode.CommitMetadata.IsEffectiveMaster() {
+		return fmt.Errorf("branches cannot be folded into or from master")
+	}
+	foldedIsParent := node.BranchParent == foldedNode
+	if !foldedIsParent && foldedNode.BranchParent != node {
+		return fmt.Errorf("branch %q is neither the parent nor a child of the current branch %q", from, currBranch)
+	}
+
+	// The children of the folded branch, and the other children of the current branch if it receives
+	// the changes of its child, are restacked on the current branch.
+	var steps []restackStep
+	var nodesToRestack []*git.TreeNode
+	if !foldedIsParent {
+		steps = getFoldChildSteps(strategy, currBranch, node, from, foldedNode)
+		nodesToRestack = append(nodesToRestack, sortedChildren(node)...)
+	}
+	nodesToRestack = append(nodesToRestack, sortedChildren(foldedNode)...)
+	for _, child := range nodesToRestack {
+		if child == node || child == foldedNode {
+			continue
+		}
+		childSteps, err := getRestackSteps(strategy, child, currBranch, child.BaseCommitHash())
+		if err != nil {
+			return fmt.Errorf("finding restack order: %w", err)
+		}
+		steps = append(steps, childSteps...)
+	}
+	plan, err := newRestackPlan(cfg, "fold")
+	if err != nil {
+		return err
+	}
+	plan.Steps = append(steps, deleteBranchStep(from))
+	plan.BranchToCheckout = currBranch
+
+	// PRs are only looked up for submitted branches.
+	if lo.ContainsBy([]*git.TreeNode{node, foldedNode}, func(node *git.TreeNode) bool {
+		prURL, _ := node.CommitMetadata.PRURL()
+		return prURL != ""
+	}) {
+		newBase := currBranch
+		if foldedIsParent {
+			newBase = repoData.MasterBranch
+			if parent := foldedNode.BranchParent; parent != nil && !parent.CommitMetadata.IsEffectiveMaster() {
+				newBase = parent.CommitMetadata.CleanedBranchNames()[0]
+			}
+		}
+		plan.Fold = &foldPRUpdate{
+			FoldedBranch: from,
+			IntoBranch:   currBranch,
+			NewBase:      newBase,
+			ChildBranches: lo.Map(sortedChildren(foldedNode), func(child *git.TreeNode, _ int) string {
+				return child.CommitMetadata.CleanedBranchNames()[0]
+			}),
+			MasterBranch: repoData.MasterBranch,
+		}
+	}
+
+	desc, err := foldBranchDescriptions(node, foldedNode, foldedIsParent)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		printDryRun("set the description of %s to:\n%s", currBranch, indentLines(desc.String()))
+	} else {
+		err = writeBranchDescription(currBranch, desc.String())
+		if err != nil {
+			return fmt.Errorf("writing branch description: %w", err)
+		}
+	}
+
+	err = executeRestack(plan)
+	if err != nil {
+		return fmt.Errorf("executing restack: %w", err)
+	}
+	return updateFoldedPRs(cfg, plan.Fold)
+}
+
+// Returns the steps that give the current branch the changes of its child branch.
+// The merge strategy merges the child. The rebase strategies keep the history linear: the child is rebased
+// on the current branch if it is stale, then the current branch is fast-forwarded to the child,
+// by rebasing the current branch, which has no commits of its own past its tip, onto the child.
+func getFoldChildSteps(
+	strategy restackStrategy,
+	currBranch string,
+	node *git.TreeNode,
+	childBranch string,
+	childNode *git.TreeNode,
+) []restackStep {
+	if strategy == restackStrategyMerge {
+		return mergeSteps([]mergeArg{{branchToMerge: childBranch, branchToReceiveMerge: currBranch}})
+	}
+	var steps []restackStep
+	if childNode.IsStale() {
+		steps = append(steps, restackStep{
+			Kind:                restackStepRebase,
+			Branch:              childBranch,
+			Parent:              currBranch,
+			OldParentCommitHash: childNode.BaseCommitHash(),
+		})
+	}
+	return append(steps, restackStep{
+		Kind:                restackStepRebase,
+		Branch:              currBranch,
+		Parent:              childBranch,
+		OldParentCommitHash: node.CommitMetadata.CommitHash,
+	})
+}
+
+// Resumes an interrupted fold, then updates the PRs once the restack is done.
+func continueFold(cfg *config.Config) error {
+	plan, err := loadRestackPlan()
+	if err != nil {
+		return err
+	}
+	err = continueRestack()
+	if err != nil {
+		return err
+	}
+	return updateFoldedPRs(cfg, plan.Fold)
+}
+
+// Updates the PRs after the restack of a fold succeeded, so that they are left untouched
+// if the fold is aborted or undone. Does nothing if no PR was submitted.
+func updateFoldedPRs(cfg *config.Config, fold *foldPRUpdate) error {
+	if fold == nil {
+		return nil
+	}
+	client, err := newGitHubClient(cfg)
+	if err != nil {
+		return err
+	}
+	prCfg := submitCfg{gitMasterBranch: fold.MasterBranch, client: newPRCache(client)}
+	err = closeFoldedPR(prCfg, fold)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		printDryRun("update the stack in the PR bodies")
+		return nil
+	}
+	err = syncFoldedStackPRBodies(prCfg, fold.IntoBranch)
+	if err != nil {
+		return err
+	}
+	color.Yellow("Run `hg submit` to push %s and update its PR", fold.IntoBranch)
+	return nil
+}
+
+// Retargets the PRs based on the folded branch to the new base branch,
+// then closes the PR of the folded branch with a comment pointing at the PR of the branch it was folded into.
+func closeFoldedPR(cfg submitCfg, fold *foldPRUpdate) error {
+	foldedPR, err := cfg.client.FetchPRForBranch(fold.FoldedBranch)
+	if err != nil {
+		return fmt.Errorf("fetching PR data for branch %q: %w", fold.FoldedBranch, err)
+	}
+	if foldedPR == nil {
+		return nil
+	}
+
+	for _, childBranch := range fold.ChildBranches {
+		childPR, err := cfg.client.FetchPRForBranch(childBranch)
+		if err != nil {
+			return fmt.Errorf("fetching PR data for branch %q: %w", childBranch, err)
+		}
+		if childPR == nil || childPR.BaseRefName != fold.FoldedBranch {
+			continue
+		}
+		err = cfg.client.EditPR(childPR.Number, github.EditPROpts{Base: &fold.NewBase})
+		if err != nil {
+			return fmt.Errorf("retargeting PR %d: %w", childPR.Number, err)
+		}
+		color.Green("Retargeted PR %s to %s", renderPRLink(childPR), fold.NewBase)
+	}
+
+	comment := fmt.Sprintf("Folded into branch `%s`.", fold.IntoBranch)
+	intoPR, err := cfg.client.FetchPRForBranch(fold.IntoBranch)
+	if err != nil {
+		return fmt.Errorf("fetching PR data for branch %q: %w", fold.IntoBranch, err)
+	}
+	if intoPR != nil {
+		comment = fmt.Sprintf("Folded into %s.", github.PRStrFromPRNum(intoPR.Number))
+	}
+	err = cfg.client.ClosePR(foldedPR.Number, comment)
+	if err != nil {
+		return fmt.Errorf("closing PR %d: %w", foldedPR.Number, err)
+	}
+	color.Green("Closed PR %s", renderPRLink(foldedPR))
+	return nil
+}
+
+// Returns the description of the branch once the folded branch is folded into it:
+// its title, followed by the body of both branches in stack order. The folded body is preceded by its title.
+func foldBranchDescriptions(
+	node *git.TreeNode,
+	foldedNode *git.TreeNode,
+	foldedIsParent bool,
+) (*git.BranchDescription, error) {
+	desc, err := getBranchDescriptionForNode(node)
+	if err != nil {
+		return nil, err
+	}
+	foldedDesc, err := getBranchDescriptionForNode(foldedNode)
+	if err != nil {
+		return nil, err
+	}
+	foldedSection := strings.TrimSpace(foldedDesc.Title + "\n\n" + foldedDesc.Body)
+	sections := []string{desc.Body, foldedSection}
+	if foldedIsParent {
+		sections = []string{foldedSection, desc.Body}
+	}
+	sections = lo.Filter(sections, func(section string, _ int) bool { return section != "" })
+	return &git.BranchDescription{
+		Title: desc.Title,
+		Body:  strings.Join(sections, "\n\n"),
+		PrURL: desc.PrURL,
+	}, nil
+}
+
+// Returns the branch description of the node, falling back to the title of its commit.
+func getBranchDescriptionForNode(node *git.TreeNode) (*git.BranchDescription, error) {
+	if node.CommitMetadata.BranchDescription != nil {
+		return node.CommitMetadata.BranchDescription, nil
+	}
+	branchName := node.CommitMetadata.CleanedBranchNames()[0]
+	desc, err := getBranchDescriptionWithFallback(branchName)
+	if err != nil {
+		return nil, fmt.Errorf("getting description of branch %q: %w", branchName, err)
+	}
+	lines := strings.Split(desc, "\n")
+	return git.NewBranchDescription(lines[0], lines[1:]), nil
+}
+
+// Updates the stack listing in the PR bodies of the stack of the branch, which no longer contains the folded branch.
+func syncFoldedStackPRBodies(cfg submitCfg, branchName string) error {
+	repoData, err := git.NewRepoData(
+		git.RepoDataIncludeCommitMetadata,
+		git.RepoDataIncludeBranchDescription,
+	)
+	if err != nil {
+		return err
+	}
+	node, ok := repoData.BranchNameToNode[branchName]
+	if !ok {
+		return fmt.Errorf("missing node for branch %q", branchName)
+	}
+	stack, err := getStack([]*git.TreeNode{node})
+	if err != nil {
+		return fmt.Errorf("getting stack: %w", err)
+	}
+
+	board := newStatusBoard()
+	row := board.addRow(color.GreenString("stack: "))
+	board.start()
+	defer board.stop()
+	finalStatus, err := syncStackPRBodies(cfg, stack, row)
+	if err != nil {
+		row.finish(color.RedString("(failed)"))
+		return fmt.Errorf("updating the stack in PR bodies: %w", err)
+	}
+	row.finish(finalStatus)
+	return nil
+}
+
+func indentLines(s string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	return "  " + strings.Join(lines, "\n  ")
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/github"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestFold_childIntoParent(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.CreateBranch("c")
+	repo.CommitFile("c.txt", "c\n", "c1")
+	g.Expect(runHg("submit")).To(Succeed())
+	repo.Checkout("a")
+
+	g.Expect(runHg("fold", "--from", "b")).To(Succeed())
+
+	g.Expect(repo.CurrentBranch()).To(Equal("a"))
+	g.Expect(repo.BranchExists("b")).To(BeFalse())
+	g.Expect(repo.ReadFile("b.txt")).To(Equal("b\n"))
+	g.Expect(repo.IsAncestor("a", "c")).To(BeTrue())
+	g.Expect(repo.Git("config", "branch.a.description")).To(Equal(
+		"Title of a\n\nDescription of a\n\nTitle of b\n\nDescription of b\n\nPR: " + gh.PR(1).URL,
+	))
+
+	g.Expect(gh.PR(2).State).To(Equal("CLOSED"))
+	g.Expect(gh.Comments(2)).To(Equal([]string{"Folded into #1."}))
+	g.Expect(gh.PR(3).BaseRefName).To(Equal("a"))
+	for _, prNum := range []int{1, 3} {
+		prBody, err := github.NewPrBody(gh.PR(prNum).Body)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(prBody.Stack).To(Equal([]github.PrStackItem{
+			{PRNum: 1, Depth: 0},
+			{PRNum: 3, Depth: 1},
+		}))
+	}
+}
+
+func TestFold_childIntoParentWithRebaseStrategy(t *testing.T) {
+	for _, strategy := range []restackStrategy{restackStrategyRebase, restackStrategyRebaseUpdateRefs} {
+		t.Run(string(strategy), func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			repo := testutil.NewRepo(t)
+			repo.CreateBranch("a")
+			repo.CommitFile("a.txt", "a\n", "a1")
+			repo.CreateBranch("b")
+			repo.CommitFile("b.txt", "b\n", "b1")
+			repo.CreateBranch("c")
+			repo.CommitFile("c.txt", "c\n", "c1")
+			g.Expect(runHg("sl")).To(Succeed())
+			// b is stale once a is amended with plain git.
+			repo.Checkout("a")
+			repo.WriteFile("a.txt", "a2\n")
+			repo.Git("commit", "-q", "-a", "--amend", "--no-edit")
+
+			g.Expect(runHg("fold", "--from", "b", "--strategy", string(strategy))).To(Succeed())
+
+			g.Expect(repo.CurrentBranch()).To(Equal("a"))
+			g.Expect(repo.BranchExists("b")).To(BeFalse())
+			g.Expect(repo.Git("log", "--format=%s", "main..a")).To(Equal("b1\na1"))
+			g.Expect(repo.ReadFile("a.txt")).To(Equal("a2\n"))
+			g.Expect(repo.ReadFile("b.txt")).To(Equal("b\n"))
+			g.Expect(repo.Git("log", "--format=%s", "a..c")).To(Equal("c1"))
+		})
+	}
+}
+
+func TestFold_parentIntoChild(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.Checkout("a")
+	repo.CreateBranch("a2")
+	repo.CommitFile("a2.txt", "a2\n", "a2")
+	repo.Checkout("b")
+
+	g.Expect(runHg("fold", "--from", "a")).To(Succeed())
+
+	g.Expect(repo.CurrentBranch()).To(Equal("b"))
+	g.Expect(repo.BranchExists("a")).To(BeFalse())
+	g.Expect(repo.ReadFile("a.txt")).To(Equal("a\n"))
+	g.Expect(repo.Git("config", "branch.b.description")).To(Equal(
+		"Title of b\n\nTitle of a\n\nDescription of a\n\nDescription of b",
+	))
+	// The other child of the folded branch is restacked on the current branch.
+	g.Expect(repo.IsAncestor("b", "a2")).To(BeTrue())
+}
+
+func TestFold_abortAfterConflictKeepsPROpen(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("f.txt", "b\n", "b1")
+	g.Expect(runHg("submit")).To(Succeed())
+	repo.Checkout("a")
+	repo.CreateBranch("x")
+	repo.CommitFile("f.txt", "x\n", "x1")
+	g.Expect(runHg("submit")).To(Succeed())
+	repo.Checkout("a")
+	aHash := repo.Hash("a")
+
+	// Restacking x on a conflicts once b is folded into a.
+	g.Expect(runHg("fold", "--from", "b")).ToNot(Succeed())
+	g.Expect(gh.PR(2).State).To(Equal("OPEN"))
+	g.Expect(runHg("fold", "--abort")).To(Succeed())
+
+	g.Expect(repo.Hash("a")).To(Equal(aHash))
+	g.Expect(repo.BranchExists("b")).To(BeTrue())
+	g.Expect(gh.PR(2).State).To(Equal("OPEN"))
+	g.Expect(gh.Comments(2)).To(BeEmpty())
+}
+
+func TestFold_continueAfterConflictClosesPR(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("f.txt", "b\n", "b1")
+	g.Expect(runHg("submit")).To(Succeed())
+	repo.Checkout("a")
+	repo.CreateBranch("x")
+	repo.CommitFile("f.txt", "x\n", "x1")
+	repo.Checkout("a")
+
+	g.Expect(runHg("fold", "--from", "b")).ToNot(Succeed())
+	repo.WriteFile("f.txt", "resolved\n")
+	g.Expect(runHg("fold", "--continue")).To(Succeed())
+
+	g.Expect(repo.CurrentBranch()).To(Equal("a"))
+	g.Expect(repo.BranchExists("b")).To(BeFalse())
+	g.Expect(gh.PR(2).State).To(Equal("CLOSED"))
+	g.Expect(gh.Comments(2)).To(Equal([]string{"Folded into #1."}))
+}
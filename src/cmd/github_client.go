@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/yapaluc/hg-git/src/config"
+	"github.com/yapaluc/hg-git/src/git"
+	"github.com/yapaluc/hg-git/src/github"
+)
+
+// Returns a GitHub client for the repo of the base remote.
+// When pushing to a fork, head branches are looked up in the repo of the push remote.
+func newGitHubClient(cfg *config.Config) (github.Client, error) {
+	remoteURL, err := git.GetRemoteURL(cfg.BaseRemote)
+	if err != nil {
+		return nil, err
+	}
+	var headOwner string
+	if cfg.PushesToFork() {
+		pushRemoteURL, err := git.GetRemoteURL(cfg.PushRemote)
+		if err != nil {
+			return nil, err
+		}
+		pushRepo, err := github.ParseRemoteURL(pushRemoteURL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing URL of push remote %q: %w", cfg.PushRemote, err)
+		}
+		headOwner = pushRepo.Owner
+	}
+	client, err := github.NewClient(remoteURL, headOwner)
+	if err != nil {
+		return nil, fmt.Errorf("creating GitHub client: %w", err)
+	}
+	if dryRun {
+		client = github.NewDryRunClient(client)
+	}
+	return client, nil
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/yapaluc/hg-git/src/git"
+)
+
+// graphRenderer draws a tree of nodes as a vertical graph, descendants above their ancestors.
+type graphRenderer struct {
+	// Returns the children of a node in the order in which they are drawn, furthest from the parent last.
+	children func(node *git.TreeNode) []*git.TreeNode
+	// Returns the lines describing a node. The first line is drawn next to the bullet.
+	render func(node *git.TreeNode) ([]string, error)
+}
+
+// Adapted from https://github.com/reydanro/git-smartlog
+func (r *graphRenderer) printChildren(node *git.TreeNode, prefix string) error {
+	mainGraphConnector := ""
+	for i, child := range r.children(node) {
+		newPrefix := prefix + mainGraphConnector
+		if i > 0 {
+			newPrefix += " "
+		}
+		err := r.printChildren(child, newPrefix)
+		if err != nil {
+			return fmt.Errorf("printing node children: %w", err)
+		}
+
+		lines, err := r.render(child)
+		if err != nil {
+			return fmt.Errorf("rendering node: %w", err)
+		}
+
+		// First line
+		var bullet string
+		if child.CommitMetadata.IsHead {
+			bullet = "*"
+		} else {
+			bullet = "o"
+		}
+		graph := mainGraphConnector
+		if i > 0 {
+			graph += " "
+		}
+		for j, line := range lines {
+			if j == 0 {
+				fmt.Println(prefix + graph + bullet + " " + line)
+			} else {
+				// Continue the line to the parent below the bullet.
+				fmt.Println(prefix + graph + "| " + line)
+			}
+		}
+		if len(lines) == 0 {
+			fmt.Println(prefix + graph + bullet)
+		}
+
+		// Update the connector character. Use ":" if parent is the root node.
+		graphConnector := "|"
+		if node.CommitMetadata == nil {
+			graphConnector = ":"
+		}
+		mainGraphConnector = graphConnector
+
+		// Spacing to parent node
+		if i == 0 {
+			graph = mainGraphConnector
+		} else {
+			graph = mainGraphConnector + "/ "
+		}
+		fmt.Println(prefix + graph)
+	}
+	return nil
+}
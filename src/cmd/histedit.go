@@ -0,0 +1,427 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yapaluc/hg-git/src/config"
+	"github.com/yapaluc/hg-git/src/git"
+	"github.com/yapaluc/hg-git/src/shell"
+
+	"github.com/fatih/color"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+const histeditFilePrefix = "HISTEDIT_"
+
+type histeditAction string
+
+const (
+	histeditPick   histeditAction = "pick"
+	histeditDrop   histeditAction = "drop"
+	histeditFold   histeditAction = "fold"
+	histeditReword histeditAction = "reword"
+)
+
+// histeditLine is a line of the histedit plan: an action on a branch of the stack.
+type histeditLine struct {
+	action histeditAction
+	entry  *stackEntry
+}
+
+func newHisteditCmd() *cobra.Command {
+	var cont bool
+	var abort bool
+	var strategy string
+	var cmd = &cobra.Command{
+		Use:   "histedit | --continue | --abort",
+		Short: "Reorders, drops, folds or rewords the branches of the current stack in the editor.",
+		Long: `Opens the current stack (current branch and its ancestors) in the editor, one branch per line from the bottom of the stack.
+			Lines can be reordered, and the action of each line changed to pick, drop, fold (into the branch of the previous line) or reword (edit the branch description).
+			The branches are then rebuilt onto their new parent with rebases, keeping their branch descriptions and PR URLs.
+			Branches outside of the stack follow their parent branch with the restack strategy of the repo, or the one given with --strategy.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return recordOperation(func() error {
+				if cont {
+					return continueRestack()
+				}
+				if abort {
+					return abortRestack()
+				}
+				return runHistedit(getConfig(cmd), strategy)
+			})
+		},
+	}
+	addRestackStrategyFlag(cmd, &strategy)
+	addRestackFlags(cmd, &cont, &abort)
+	cmd.MarkFlagsMutuallyExclusive("continue", "strategy")
+	cmd.MarkFlagsMutuallyExclusive("abort", "strategy")
+	return cmd
+}
+
+func runHistedit(cfg *config.Config, strategyFlag string) error {
+	strategy, err := getRestackStrategy(cfg, strategyFlag)
+	if err != nil {
+		return err
+	}
+	repoData, err := git.NewRepoData(
+		git.RepoDataIncludeCommitMetadata,
+		git.RepoDataIncludeBranchDescription,
+	)
+	if err != nil {
+		return err
+	}
+	currBranch, err := git.GetCurrentBranch()
+	if err != nil {
+		return err
+	}
+	node, ok := repoData.BranchNameToNode[currBranch]
+	if !ok {
+		return fmt.Errorf("missing node for branch %q", currBranch)
+	}
+	if node.CommitMetadata.IsEffectiveMaster() {
+		return fmt.Errorf("branch %q is not part of a stack", currBranch)
+	}
+	stack, err := getStack([]*git.TreeNode{node})
+	if err != nil {
+		return fmt.Errorf("getting stack: %w", err)
+	}
+
+	lines, err := editHisteditPlan(stack)
+	if err != nil {
+		return err
+	}
+	err = validateHisteditPlan(stack, lines)
+	if err != nil {
+		return err
+	}
+
+	// The new bottom of the stack is based on the commit the old one was based on.
+	baseCommitHash, err := shell.Run(
+		shell.Opt{StripTrailingNewline: true},
+		fmt.Sprintf(
+			"git merge-base %s %s",
+			stack[0].node.BranchParent.CommitMetadata.CommitHash,
+			stack[0].node.CommitMetadata.CommitHash,
+		),
+	)
+	if err != nil {
+		return fmt.Errorf("finding the base of the stack: %w", err)
+	}
+	steps, err := getHisteditSteps(strategy, stack, lines, baseCommitHash, currBranch)
+	if err != nil {
+		return err
+	}
+	plan, err := newRestackPlan(cfg, "histedit")
+	if err != nil {
+		return err
+	}
+	plan.Steps = steps.restackSteps
+	plan.BranchToCheckout = steps.branchToCheckout
+
+	// Descriptions are stored by branch name, so they are updated before the branches are rebuilt.
+	for _, fold := range steps.folds {
+		into, folded := fold[0], fold[1]
+		desc, err := foldBranchDescriptions(into.node, folded.node, false /* foldedIsParent */)
+		if err != nil {
+			return err
+		}
+		// The next fold into the same branch builds on this description.
+		into.node.CommitMetadata.BranchDescription = desc
+		if dryRun {
+			printDryRun("set the description of %s to:\n%s", into.branchName, indentLines(desc.String()))
+			continue
+		}
+		err = writeBranchDescription(into.branchName, desc.String())
+		if err != nil {
+			return fmt.Errorf("writing branch description: %w", err)
+		}
+	}
+	for _, branchName := range steps.branchesToReword {
+		if dryRun {
+			printDryRun("edit the description of %s", branchName)
+			continue
+		}
+		err = editByBranchName(branchName)
+		if err != nil {
+			return fmt.Errorf("editing description of branch %q: %w", branchName, err)
+		}
+	}
+
+	err = executeRestack(plan)
+	if err != nil {
+		return fmt.Errorf("executing restack: %w", err)
+	}
+	warnAboutOrphanedPRs(stack, lines)
+	return nil
+}
+
+// Opens the stack in the editor and returns the lines of the edited plan.
+func editHisteditPlan(stack []*stackEntry) ([]histeditLine, error) {
+	commentChar, err := shell.Run(
+		shell.Opt{StripTrailingNewline: true},
+		"git config core.commentchar",
+	)
+	if err != nil {
+		// git config returns a non-zero exit code if the config doesn't exist
+		commentChar = "#"
+	}
+
+	var sb strings.Builder
+	for _, stackEntry := range stack {
+		fmt.Fprintf(&sb, "%s %s %s\n", histeditPick, stackEntry.branchName, getHisteditTitle(stackEntry))
+	}
+	for _, line := range []string{
+		"",
+		"Edit the branches of the stack, from the bottom (first line) to the top (last line).",
+		"Lines can be reordered. Commands:",
+		"  p, pick = keep the branch",
+		"  d, drop = delete the branch and its changes",
+		"  f, fold = fold the branch into the branch of the previous line",
+		"  r, reword = keep the branch and edit its description",
+		"Removing a line drops the branch. Removing all lines aborts.",
+		fmt.Sprintf("Lines starting with '%s' will be stripped.", commentChar),
+	} {
+		sb.WriteString(strings.TrimRight(commentChar+" "+line, " ") + "\n")
+	}
+
+	content, err := shell.OpenEditor(sb.String(), histeditFilePrefix, commentChar)
+	if err != nil {
+		return nil, fmt.Errorf("opening file for editing: %w", err)
+	}
+
+	branchToEntry := lo.SliceToMap(stack, func(stackEntry *stackEntry) (string, *stackEntry) {
+		return stackEntry.branchName, stackEntry
+	})
+	var lines []histeditLine
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("missing branch name in line %q", line)
+		}
+		action, ok := parseHisteditAction(fields[0])
+		if !ok {
+			return nil, fmt.Errorf("unknown action %q in line %q", fields[0], line)
+		}
+		entry, ok := branchToEntry[fields[1]]
+		if !ok {
+			return nil, fmt.Errorf("branch %q is not part of the stack", fields[1])
+		}
+		lines = append(lines, histeditLine{action: action, entry: entry})
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("nothing to do")
+	}
+	return lines, nil
+}
+
+func getHisteditTitle(stackEntry *stackEntry) string {
+	if desc := stackEntry.node.CommitMetadata.BranchDescription; desc != nil && desc.Title != "" {
+		return desc.Title
+	}
+	return stackEntry.node.CommitMetadata.Title
+}
+
+func parseHisteditAction(s string) (histeditAction, bool) {
+	for _, action := range []histeditAction{histeditPick, histeditDrop, histeditFold, histeditReword} {
+		if s == string(action) || s == string(action)[:1] {
+			return action, true
+		}
+	}
+	return "", false
+}
+
+// Checks that each branch appears at most once, that folds have a branch to fold into,
+// and that dropped branches have no descendants outside of the stack, which would lose their parent.
+// Branches missing from the plan are dropped.
+func validateHisteditPlan(stack []*stackEntry, lines []histeditLine) error {
+	seen := make(map[string]bool)
+	for i, line := range lines {
+		if seen[line.entry.branchName] {
+			return fmt.Errorf("branch %q appears more than once", line.entry.branchName)
+		}
+		seen[line.entry.branchName] = true
+		if line.action == histeditFold && (i == 0 || lines[i-1].action == histeditDrop) {
+			return fmt.Errorf("branch %q cannot be folded: there is no branch to fold it into", line.entry.branchName)
+		}
+	}
+
+	inStack := lo.SliceToMap(stack, func(stackEntry *stackEntry) (*git.TreeNode, bool) {
+		return stackEntry.node, true
+	})
+	for _, stackEntry := range stack {
+		dropped := !seen[stackEntry.branchName] || lo.ContainsBy(lines, func(line histeditLine) bool {
+			return line.entry == stackEntry && line.action == histeditDrop
+		})
+		if !dropped {
+			continue
+		}
+		for _, child := range sortedChildren(stackEntry.node) {
+			if !inStack[child] {
+				return fmt.Errorf(
+					"branch %q cannot be dropped since branch %q is based on it",
+					stackEntry.branchName,
+					child.CommitMetadata.CleanedBranchNames()[0],
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// histeditSteps is what it takes to apply a histedit plan.
+type histeditSteps struct {
+	restackSteps     []restackStep
+	branchesToReword []string
+	// Pairs of the branch that receives a fold and the folded branch, in the order of the plan.
+	folds            [][2]*stackEntry
+	branchToCheckout string
+}
+
+// Returns the steps that rebuild the stack in the new order.
+// Each branch is rebased onto the branch of the previous line, from the first line that changes the stack.
+// Folded branches are then merged into that branch, which fast-forwards it, and deleted like dropped branches.
+// Branches outside of the stack are restacked with the given strategy, so that merge commits
+// of a merge-strategy stack are kept. Merges cannot take out the changes of the branches that a branch
+// is no longer based on, e.g. dropped branches, so such branches can only follow with a rebase strategy.
+func getHisteditSteps(
+	strategy restackStrategy,
+	stack []*stackEntry,
+	lines []histeditLine,
+	baseCommitHash string,
+	currBranch string,
+) (*histeditSteps, error) {
+	result := &histeditSteps{branchToCheckout: currBranch}
+	kept := lo.Filter(lines, func(line histeditLine, _ int) bool { return line.action != histeditDrop })
+
+	// Branches are not rebuilt up to the first line that differs from the stack.
+	numUnchanged := 0
+	for numUnchanged < len(kept) &&
+		kept[numUnchanged].entry == stack[numUnchanged] &&
+		kept[numUnchanged].action != histeditFold {
+		numUnchanged++
+	}
+	// Branch that the branch of the next line is based on. Empty for the first line.
+	var newParent *stackEntry
+	for _, line := range kept[:numUnchanged] {
+		newParent = line.entry
+		if line.action == histeditReword {
+			result.branchesToReword = append(result.branchesToReword, line.entry.branchName)
+		}
+	}
+	if numUnchanged == len(stack) && len(result.branchesToReword) == 0 {
+		return nil, fmt.Errorf("nothing to do")
+	}
+
+	inStack := lo.SliceToMap(stack, func(stackEntry *stackEntry) (*git.TreeNode, bool) {
+		return stackEntry.node, true
+	})
+	// Branches of the stack that the branch of the current line ends up in or based on.
+	placed := lo.SliceToMap(kept[:numUnchanged], func(line histeditLine) (*stackEntry, bool) {
+		return line.entry, true
+	})
+	var branchesToDelete []string
+	for _, line := range kept[numUnchanged:] {
+		placed[line.entry] = true
+		branchName := line.entry.branchName
+		parent := baseCommitHash
+		if newParent != nil {
+			parent = newParent.branchName
+		}
+		result.restackSteps = append(result.restackSteps, restackStep{
+			Kind:                restackStepRebase,
+			Branch:              branchName,
+			Parent:              parent,
+			OldParentCommitHash: line.entry.node.BaseCommitHash(),
+		})
+
+		// Branches outside of the stack follow the branch they are based on.
+		target := branchName
+		if line.action == histeditFold {
+			result.restackSteps = append(
+				result.restackSteps,
+				restackStep{Kind: restackStepMerge, Branch: newParent.branchName, Parent: branchName},
+			)
+			result.folds = append(result.folds, [2]*stackEntry{newParent, line.entry})
+			branchesToDelete = append(branchesToDelete, branchName)
+			target = newParent.branchName
+			if branchName == currBranch {
+				result.branchToCheckout = newParent.branchName
+			}
+		} else {
+			newParent = line.entry
+			if line.action == histeditReword {
+				result.branchesToReword = append(result.branchesToReword, branchName)
+			}
+		}
+		for _, child := range sortedChildren(line.entry.node) {
+			if inStack[child] {
+				continue
+			}
+			if strategy == restackStrategyMerge && !isStackPrefixPlaced(stack, line.entry, placed) {
+				return nil, fmt.Errorf(
+					"branch %q cannot follow branch %q with the merge restack strategy, which would keep "+
+						"the changes of the branches that it is no longer based on. pass --strategy rebase instead",
+					child.CommitMetadata.CleanedBranchNames()[0],
+					branchName,
+				)
+			}
+			childSteps, err := getRestackSteps(strategy, child, target, child.BaseCommitHash())
+			if err != nil {
+				return nil, fmt.Errorf("finding restack order: %w", err)
+			}
+			result.restackSteps = append(result.restackSteps, childSteps...)
+		}
+	}
+
+	for _, stackEntry := range stack {
+		if lo.ContainsBy(kept, func(line histeditLine) bool { return line.entry == stackEntry }) {
+			continue
+		}
+		branchesToDelete = append(branchesToDelete, stackEntry.branchName)
+		if stackEntry.branchName == currBranch {
+			if newParent == nil {
+				return nil, fmt.Errorf("all branches would be dropped")
+			}
+			result.branchToCheckout = newParent.branchName
+		}
+	}
+	for _, branchName := range branchesToDelete {
+		result.restackSteps = append(result.restackSteps, deleteBranchStep(branchName))
+	}
+	return result, nil
+}
+
+// Returns true if the branches of the stack up to the given one are all placed.
+func isStackPrefixPlaced(stack []*stackEntry, last *stackEntry, placed map[*stackEntry]bool) bool {
+	for _, stackEntry := range stack {
+		if !placed[stackEntry] {
+			return false
+		}
+		if stackEntry == last {
+			return true
+		}
+	}
+	return true
+}
+
+// Prints the PRs of the folded and dropped branches, which are left open. Run `hg fold` to close the PR of a folded branch.
+func warnAboutOrphanedPRs(stack []*stackEntry, lines []histeditLine) {
+	for _, stackEntry := range stack {
+		prURL, _ := stackEntry.node.CommitMetadata.PRURL()
+		if prURL == "" {
+			continue
+		}
+		if lo.ContainsBy(lines, func(line histeditLine) bool {
+			return line.entry == stackEntry && line.action != histeditFold && line.action != histeditDrop
+		}) {
+			continue
+		}
+		color.Yellow("The PR of branch %s is still open: %s", stackEntry.branchName, prURL)
+	}
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestHistedit_reorderAndDrop(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.CreateBranch("c")
+	repo.CommitFile("c.txt", "c\n", "c1")
+	repo.Checkout("b")
+	repo.CreateBranch("d")
+	repo.CommitFile("d.txt", "d\n", "d1")
+	repo.Checkout("c")
+	setHisteditPlan(t, "pick c\npick b\ndrop a\n")
+
+	// Merges would keep the changes of the dropped branch in the branch outside of the stack.
+	g.Expect(runHg("histedit")).To(MatchError(ContainSubstring(`branch "d" cannot follow branch "b"`)))
+	g.Expect(runHg("histedit", "--strategy", "rebase")).To(Succeed())
+
+	g.Expect(repo.CurrentBranch()).To(Equal("c"))
+	g.Expect(repo.BranchExists("a")).To(BeFalse())
+	g.Expect(repo.IsAncestor("main", "c")).To(BeTrue())
+	g.Expect(repo.IsAncestor("c", "b")).To(BeTrue())
+	g.Expect(repo.Git("ls-tree", "--name-only", "c")).To(Equal("README.md\nc.txt"))
+	g.Expect(repo.Git("ls-tree", "--name-only", "b")).To(Equal("README.md\nb.txt\nc.txt"))
+	// Branches outside of the stack follow their parent branch.
+	g.Expect(repo.IsAncestor("b", "d")).To(BeTrue())
+	g.Expect(repo.Git("ls-tree", "--name-only", "d")).To(Equal("README.md\nb.txt\nc.txt\nd.txt"))
+	g.Expect(repo.Git("config", "branch.b.description")).To(Equal("Title of b\n\nDescription of b"))
+}
+
+func TestHistedit_fold(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.CreateBranch("c")
+	repo.CommitFile("c.txt", "c\n", "c1")
+	setHisteditPlan(t, "pick a\nf b\npick c\n")
+
+	g.Expect(runHg("histedit")).To(Succeed())
+
+	g.Expect(repo.CurrentBranch()).To(Equal("c"))
+	g.Expect(repo.BranchExists("b")).To(BeFalse())
+	g.Expect(repo.Git("ls-tree", "--name-only", "a")).To(Equal("README.md\na.txt\nb.txt"))
+	g.Expect(repo.IsAncestor("a", "c")).To(BeTrue())
+	g.Expect(repo.Git("config", "branch.a.description")).To(Equal(
+		"Title of a\n\nDescription of a\n\nTitle of b\n\nDescription of b",
+	))
+}
+
+func TestHistedit_staleBranch(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.CreateBranch("c")
+	repo.CommitFile("c.txt", "c\n", "c1")
+	g.Expect(runHg("sl")).To(Succeed())
+	repo.Checkout("a")
+	repo.WriteFile("a.txt", "a2\n")
+	repo.Git("commit", "-q", "-a", "--amend", "--no-edit")
+	repo.Checkout("c")
+	setHisteditPlan(t, "pick a\npick c\npick b\n")
+
+	// The commits of a that b is still based on are not replayed onto c.
+	g.Expect(runHg("histedit", "--strategy", "rebase")).To(Succeed())
+
+	g.Expect(repo.IsAncestor("a", "c")).To(BeTrue())
+	g.Expect(repo.IsAncestor("c", "b")).To(BeTrue())
+	g.Expect(repo.Git("log", "--format=%s", "a..b")).To(Equal("b1\nc1"))
+	g.Expect(repo.Git("show", "b:a.txt")).To(Equal("a2"))
+	g.Expect(repo.Git("ls-tree", "--name-only", "b")).To(Equal("README.md\na.txt\nb.txt\nc.txt"))
+}
+
+func TestHistedit_mergeStrategyKeepsMergeCommits(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.CreateBranch("d")
+	repo.CommitFile("d.txt", "d\n", "d1")
+	repo.Checkout("b")
+	repo.CommitFile("b.txt", "b2\n", "b2")
+	repo.Checkout("d")
+	repo.Git("merge", "-q", "--no-edit", "b")
+	oldD := repo.Hash("d")
+	repo.Checkout("b")
+	setHisteditPlan(t, "pick a\nfold b\n")
+
+	g.Expect(runHg("histedit", "--strategy", "merge")).To(Succeed())
+
+	g.Expect(repo.BranchExists("b")).To(BeFalse())
+	// The branch outside of the stack got the new parent merged in instead of being rebased.
+	g.Expect(repo.IsAncestor(oldD, "d")).To(BeTrue())
+	g.Expect(repo.IsAncestor("a", "d")).To(BeTrue())
+	g.Expect(repo.Git("show", "d:b.txt")).To(Equal("b2"))
+}
+
+// setHisteditPlan makes the editor replace the histedit plan with the given one.
+func setHisteditPlan(t *testing.T, plan string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "plan")
+	err := os.WriteFile(path, []byte(plan), 0o644)
+	if err != nil {
+		t.Fatalf("writing histedit plan: %s", err)
+	}
+	t.Setenv("GIT_EDITOR", "cp "+path)
+}
@@ -0,0 +1,389 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yapaluc/hg-git/src/config"
+	"github.com/yapaluc/hg-git/src/git"
+	"github.com/yapaluc/hg-git/src/github"
+	"github.com/yapaluc/hg-git/src/shell"
+	"github.com/yapaluc/hg-git/src/util"
+
+	"github.com/alessio/shellescape"
+	"github.com/fatih/color"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+func newLandCmd() *cobra.Command {
+	var method string
+	var strategy string
+	var wait time.Duration
+	var cmd = &cobra.Command{
+		Use:   "land [--method squash|merge|rebase] [--strategy strategy] [--wait duration]",
+		Short: "Merges the PRs of the current stack from the bottom, then cleans up the merged branches.",
+		Long: `Merges the PRs of the current stack (current branch and its ancestors) from the bottom, as long as they are approved and their checks pass.
+			After each merge, the PRs based on the merged branch are retargeted to master and the merged branch is deleted on the remote. GitHub reruns the checks of a retargeted PR, so its status is fetched again until the checks finish, for up to --wait, and it is only landed if the status is clean. If the checks are still pending by then, run "hg land" again once they finish.
+			Finally, the stack is updated in the PR bodies and the merged branches are cleaned up like with "hg cleanup", which restacks the rest of the stack onto master.
+			With --method squash or rebase, the retargeted PRs keep showing the commits of the landed PRs until their restacked branches are pushed with "hg submit".`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if !lo.Contains(github.MergeMethods, github.MergeMethod(method)) {
+				return fmt.Errorf("invalid merge method %q: expected squash, merge or rebase", method)
+			}
+			return recordOperation(func() error {
+				return runLand(getConfig(cmd), github.MergeMethod(method), strategy, wait)
+			})
+		},
+	}
+	cmd.Flags().StringVar(&method, "method", string(github.MergeMethodSquash), "Merge method: squash, merge or rebase")
+	addRestackStrategyFlag(cmd, &strategy)
+	cmd.Flags().DurationVar(
+		&wait,
+		"wait",
+		15*time.Minute,
+		"How long to wait for the checks of a retargeted PR to finish. 0 to not wait",
+	)
+	return cmd
+}
+
+// Interval between the fetches of the status of a retargeted PR whose checks are running.
+var landPollInterval = 15 * time.Second
+
+func runLand(cfg *config.Config, method github.MergeMethod, strategyFlag string, wait time.Duration) error {
+	strategy, err := getRestackStrategy(cfg, strategyFlag)
+	if err != nil {
+		return err
+	}
+	repoData, err := git.NewRepoData(
+		git.RepoDataIncludeCommitMetadata,
+		git.RepoDataIncludeBranchDescription,
+	)
+	if err != nil {
+		return err
+	}
+	currBranch, err := git.GetCurrentBranch()
+	if err != nil {
+		return err
+	}
+	node, ok := repoData.BranchNameToNode[currBranch]
+	if !ok {
+		return fmt.Errorf("missing node for branch %q", currBranch)
+	}
+	if node.CommitMetadata.IsEffectiveMaster() {
+		return fmt.Errorf("branch %q is not part of a stack", currBranch)
+	}
+	stack, err := getStack([]*git.TreeNode{node})
+	if err != nil {
+		return fmt.Errorf("getting stack: %w", err)
+	}
+
+	client, err := newGitHubClient(cfg)
+	if err != nil {
+		return err
+	}
+	prCache := newPRCache(client)
+	err = prefetchStackPRs(prCache, stack)
+	if err != nil {
+		// PRs are fetched one by one instead.
+		color.Yellow("Could not prefetch PRs: %s", err)
+	}
+	prCfg := submitCfg{
+		remote:          cfg.PushRemote,
+		pushesToFork:    cfg.PushesToFork(),
+		gitMasterBranch: repoData.MasterBranch,
+		client:          prCache,
+	}
+
+	landedBranches, landErr := landStack(prCfg, stack, method, wait)
+	if len(landedBranches) == 0 {
+		if landErr != nil {
+			return landErr
+		}
+		return fmt.Errorf("no PR of the stack could be landed")
+	}
+	// The branches already landed are cleaned up even if landing the next one failed.
+	// Deleting the remote branches also deleted their remote-tracking branches, so they cannot be pruned.
+	err = cleanupMergedBranches(cfg, landedBranches, strategy)
+	if err == nil && method != github.MergeMethodMerge && len(landedBranches) < len(stack) {
+		// The landed commits were rewritten on master,
+		// so the remote branches of the rest of the stack still contain them.
+		fmt.Println(color.YellowString(
+			"Run \"hg submit\" to push the branches restacked onto master, so that their PRs only show their own commits.",
+		))
+	}
+	return errors.Join(landErr, err)
+}
+
+// Merges the PRs of the stack from the root until one of them is not ready to be landed or fails to land.
+// The stack listing is then updated in the bodies of the remaining PRs.
+// Returns the branches whose PRs were merged, including when an error is returned.
+// Retargeted PRs are landed once their checks finish, waiting up to the given duration.
+func landStack(cfg submitCfg, stack []*stackEntry, method github.MergeMethod, wait time.Duration) ([]string, error) {
+	board := newStatusBoard()
+	rows := make(map[string]*statusRow)
+	for _, stackEntry := range stack {
+		rows[stackEntry.branchName] = board.addRow(color.GreenString("%s: ", stackEntry.branchName))
+	}
+	stackRow := board.addRow(color.GreenString("stack: "))
+	board.start()
+	defer board.stop()
+
+	statuses, err := fetchStackPRStatuses(cfg.client, stack)
+	if err != nil {
+		return nil, err
+	}
+
+	var landedBranches []string
+	var landErr error
+	// PRs retargeted to master after their parent was merged, whose statuses were fetched again.
+	retargetedPRs := make(map[int]bool)
+	for i, stackEntry := range stack {
+		row := rows[stackEntry.branchName]
+		row.set("checking PR")
+		pr, blocker, err := getLandablePR(cfg.client, stackEntry, statuses, retargetedPRs)
+		if err == nil && pr != nil && blocker != "" && retargetedPRs[pr.Number] && wait > 0 {
+			err = waitForRetargetedPR(cfg.client, statuses, pr.Number, wait, row)
+			if err == nil {
+				pr, blocker, err = getLandablePR(cfg.client, stackEntry, statuses, retargetedPRs)
+			}
+		}
+		if err != nil {
+			row.finish(color.RedString("(failed)"))
+			landErr = fmt.Errorf("landing branch %s: %w", stackEntry.branchName, err)
+			skipStackEntries(rows, stack[i+1:])
+			break
+		}
+		if pr != nil && pr.State == "MERGED" {
+			row.finish(fmt.Sprintf("%s (merged)", renderPRLink(pr)))
+			continue
+		}
+		if blocker != "" {
+			row.finish(color.YellowString("(not landed: %s)", blocker))
+			skipStackEntries(rows, stack[i+1:])
+			break
+		}
+
+		row.set(fmt.Sprintf("merging PR %s", github.PRStrFromPRNum(pr.Number)))
+		err = cfg.client.MergePR(pr.Number, method)
+		if err != nil {
+			row.finish(color.RedString("(failed)"))
+			landErr = fmt.Errorf("landing branch %s: merging PR %d: %w", stackEntry.branchName, pr.Number, err)
+			skipStackEntries(rows, stack[i+1:])
+			break
+		}
+		// The branch is merged, so it is cleaned up even if the rest fails.
+		landedBranches = append(landedBranches, stackEntry.branchName)
+		retargeted, err := finishLandedPR(cfg, stackEntry, row)
+		if err == nil && len(retargeted) > 0 {
+			err = refreshPRStatuses(cfg.client, statuses, retargeted)
+			for _, prNum := range retargeted {
+				retargetedPRs[prNum] = true
+			}
+		}
+		if err != nil {
+			row.finish(color.RedString("(failed)"))
+			landErr = fmt.Errorf("landing branch %s: %w", stackEntry.branchName, err)
+			skipStackEntries(rows, stack[i+1:])
+			break
+		}
+		row.finish(fmt.Sprintf("%s (landed)", renderPRLink(pr)))
+	}
+	if len(landedBranches) == 0 {
+		stackRow.finish(fmt.Sprintf("(%s)", statusSkipped))
+		return nil, landErr
+	}
+
+	finalStatus, err := syncStackPRBodies(cfg, stack, stackRow)
+	if err != nil {
+		stackRow.finish(color.RedString("(failed)"))
+		return landedBranches, errors.Join(landErr, fmt.Errorf("updating the stack in PR bodies: %w", err))
+	}
+	stackRow.finish(finalStatus)
+	return landedBranches, landErr
+}
+
+func skipStackEntries(rows map[string]*statusRow, stack []*stackEntry) {
+	for _, stackEntry := range stack {
+		rows[stackEntry.branchName].finish(fmt.Sprintf("(%s)", statusSkipped))
+	}
+}
+
+// Fetches the status of the open PRs of the stack in a single request.
+func fetchStackPRStatuses(client github.Client, stack []*stackEntry) (map[int]*github.PRStatus, error) {
+	var prNums []int
+	for _, stackEntry := range stack {
+		pr, err := client.FetchPRForBranch(stackEntry.branchName)
+		if err != nil {
+			return nil, fmt.Errorf("fetching PR data for branch %q: %w", stackEntry.branchName, err)
+		}
+		if pr != nil {
+			prNums = append(prNums, pr.Number)
+		}
+	}
+	statuses, err := client.FetchPRStatuses(prNums)
+	if err != nil {
+		return nil, fmt.Errorf("fetching PR statuses: %w", err)
+	}
+	return statuses, nil
+}
+
+// Fetches the statuses of the given PRs again, after they were retargeted.
+// PRs that are not found are removed from the statuses.
+func refreshPRStatuses(client github.Client, statuses map[int]*github.PRStatus, prNums []int) error {
+	refreshed, err := client.FetchPRStatuses(prNums)
+	if err != nil {
+		return fmt.Errorf("fetching PR statuses after retarget: %w", err)
+	}
+	for _, prNum := range prNums {
+		if status, ok := refreshed[prNum]; ok {
+			statuses[prNum] = status
+		} else {
+			delete(statuses, prNum)
+		}
+	}
+	return nil
+}
+
+// Fetches the status of a retargeted PR again until GitHub finished rerunning its checks and recomputing
+// its merge state, or the timeout expires.
+func waitForRetargetedPR(
+	client github.Client,
+	statuses map[int]*github.PRStatus,
+	prNum int,
+	timeout time.Duration,
+	row *statusRow,
+) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		status, ok := statuses[prNum]
+		if !ok || !isRetargetPending(status) || !time.Now().Before(deadline) {
+			return nil
+		}
+		row.set(fmt.Sprintf("waiting for the checks of PR %s after retarget", github.PRStrFromPRNum(prNum)))
+		time.Sleep(min(landPollInterval, time.Until(deadline)))
+		err := refreshPRStatuses(client, statuses, []int{prNum})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Returns true if GitHub is still rerunning the checks or recomputing the merge state of a retargeted PR.
+func isRetargetPending(status *github.PRStatus) bool {
+	return status.CheckState == "PENDING" || status.CheckState == "EXPECTED" || status.Mergeable == "UNKNOWN"
+}
+
+// Returns the PR of the branch, which may already be merged, and the reason why it cannot be landed, if any.
+func getLandablePR(
+	client github.Client,
+	stackEntry *stackEntry,
+	statuses map[int]*github.PRStatus,
+	retargetedPRs map[int]bool,
+) (*github.PullRequest, string, error) {
+	if isPrIgnored(stackEntry.branchName) {
+		return nil, "PR ignored", nil
+	}
+	pr, err := getPRForStack(client, stackEntry.node)
+	if err != nil {
+		return nil, "", err
+	}
+	if pr == nil {
+		return nil, "no open PR", nil
+	}
+	if pr.State == "MERGED" {
+		return pr, "", nil
+	}
+	status, ok := statuses[pr.Number]
+	if !ok {
+		return pr, "unknown PR status", nil
+	}
+	if retargetedPRs[pr.Number] {
+		return pr, getRetargetedLandBlocker(status), nil
+	}
+	return pr, getLandBlocker(status), nil
+}
+
+// Returns why a PR with the given status cannot be landed, or an empty string if it can.
+func getLandBlocker(status *github.PRStatus) string {
+	var blockers []string
+	if status.IsDraft {
+		blockers = append(blockers, "draft")
+	}
+	switch status.ReviewDecision {
+	case "CHANGES_REQUESTED":
+		blockers = append(blockers, "changes requested")
+	case "REVIEW_REQUIRED":
+		blockers = append(blockers, "review required")
+	}
+	switch status.CheckState {
+	case "FAILURE", "ERROR":
+		blockers = append(blockers, "checks failed")
+	case "PENDING", "EXPECTED":
+		blockers = append(blockers, "checks pending")
+	}
+	if status.Mergeable == "CONFLICTING" {
+		blockers = append(blockers, "merge conflicts")
+	}
+	return strings.Join(blockers, ", ")
+}
+
+// Like getLandBlocker, for a PR that was just retargeted to master. GitHub reruns its checks
+// and recomputes its merge state against the new base, so it is only landed once both are clean.
+func getRetargetedLandBlocker(status *github.PRStatus) string {
+	if status.CheckState == "PENDING" || status.CheckState == "EXPECTED" {
+		return "checks pending after retarget, run hg land again once they finish"
+	}
+	if blocker := getLandBlocker(status); blocker != "" {
+		return blocker
+	}
+	if status.Mergeable != "MERGEABLE" {
+		return "merge state unknown"
+	}
+	return ""
+}
+
+// Retargets the PRs of the child branches of a merged PR to master and deletes its branch on the remote.
+// Child PRs are retargeted first since GitHub closes the PRs whose base branch is deleted.
+// Returns the numbers of the retargeted PRs.
+func finishLandedPR(cfg submitCfg, stackEntry *stackEntry, row *statusRow) ([]int, error) {
+	var retargeted []int
+	row.set("retargeting child PRs")
+	for _, child := range sortedChildren(stackEntry.node) {
+		childBranch := child.CommitMetadata.CleanedBranchNames()[0]
+		childPR, err := cfg.client.FetchPRForBranch(childBranch)
+		if err != nil {
+			return nil, fmt.Errorf("fetching PR data for branch %q: %w", childBranch, err)
+		}
+		if childPR == nil || childPR.BaseRefName != stackEntry.branchName {
+			continue
+		}
+		err = cfg.client.EditPR(childPR.Number, github.EditPROpts{Base: &cfg.gitMasterBranch})
+		if err != nil {
+			return nil, fmt.Errorf("retargeting PR %d: %w", childPR.Number, err)
+		}
+		retargeted = append(retargeted, childPR.Number)
+	}
+
+	row.set("deleting remote branch")
+	out, err := shell.Run(
+		shell.Opt{CombinedStdoutStderrOutput: true},
+		fmt.Sprintf(
+			"git push %s --delete %s",
+			shellescape.Quote(cfg.remote),
+			shellescape.Quote(stackEntry.branchName),
+		),
+	)
+	// The remote may delete the branches of merged PRs automatically.
+	if err != nil && !strings.Contains(out, "remote ref does not exist") {
+		return nil, fmt.Errorf("deleting remote branch %q: %w: %s", stackEntry.branchName, err, out)
+	}
+	return retargeted, nil
+}
+
+func renderPRLink(pr *github.PullRequest) string {
+	return color.New(color.Bold).Sprint(util.Linkify(github.PRStrFromPRNum(pr.Number), pr.URL))
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/github"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestLand_mergesReadyPRsFromTheBottom(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.CreateBranch("c")
+	repo.CommitFile("c.txt", "c\n", "c1")
+	g.Expect(runHg("submit")).To(Succeed())
+	gh.SetPRStatus(github.PRStatus{Number: 1, ReviewDecision: "APPROVED", CheckState: "SUCCESS", Mergeable: "MERGEABLE"})
+	gh.SetPRStatus(github.PRStatus{Number: 2, CheckState: "SUCCESS", Mergeable: "MERGEABLE"})
+	gh.SetPRStatus(github.PRStatus{Number: 3, ReviewDecision: "REVIEW_REQUIRED", Mergeable: "MERGEABLE"})
+
+	g.Expect(runHg("land", "--method", "merge")).To(Succeed())
+
+	g.Expect(gh.PR(1).State).To(Equal("MERGED"))
+	g.Expect(gh.PR(2).State).To(Equal("MERGED"))
+	g.Expect(gh.PR(3).State).To(Equal("OPEN"))
+	g.Expect(gh.PR(2).BaseRefName).To(Equal("main"))
+	g.Expect(gh.PR(3).BaseRefName).To(Equal("main"))
+	prBody, err := github.NewPrBody(gh.PR(3).Body)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(prBody.Stack).To(Equal([]github.PrStackItem{
+		{PRNum: 1, Depth: 0, Merged: true},
+		{PRNum: 2, Depth: 1, Merged: true},
+		{PRNum: 3, Depth: 2},
+	}))
+
+	// The merged branches are cleaned up and c is restacked on master.
+	g.Expect(repo.BranchExists("a")).To(BeFalse())
+	g.Expect(repo.BranchExists("b")).To(BeFalse())
+	g.Expect(repo.CurrentBranch()).To(Equal("c"))
+	g.Expect(repo.IsAncestor("main", "c")).To(BeTrue())
+	g.Expect(repo.ReadFile("b.txt")).To(Equal("b\n"))
+}
+
+func TestLand_failsIfNothingCanBeLanded(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	g.Expect(runHg("submit")).To(Succeed())
+	gh.SetPRStatus(github.PRStatus{Number: 1, IsDraft: true, CheckState: "FAILURE", Mergeable: "MERGEABLE"})
+
+	g.Expect(runHg("land")).To(MatchError(ContainSubstring("no PR of the stack could be landed")))
+	g.Expect(runHg("land", "--method", "fast-forward")).To(MatchError(ContainSubstring("invalid merge method")))
+	g.Expect(gh.PR(1).State).To(Equal("OPEN"))
+	g.Expect(repo.BranchExists("a")).To(BeTrue())
+}
+
+func TestLand_cleansUpLandedBranchesIfAMergeFails(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.CreateBranch("c")
+	repo.CommitFile("c.txt", "c\n", "c1")
+	g.Expect(runHg("submit")).To(Succeed())
+	for prNum := 1; prNum <= 3; prNum++ {
+		gh.SetPRStatus(github.PRStatus{
+			Number:         prNum,
+			ReviewDecision: "APPROVED",
+			CheckState:     "SUCCESS",
+			Mergeable:      "MERGEABLE",
+		})
+	}
+	gh.FailMerge(2, "Required status check is expected")
+
+	g.Expect(runHg("land", "--method", "merge")).To(MatchError(ContainSubstring("Required status check is expected")))
+
+	g.Expect(gh.PR(1).State).To(Equal("MERGED"))
+	g.Expect(gh.PR(2).State).To(Equal("OPEN"))
+	g.Expect(gh.PR(3).State).To(Equal("OPEN"))
+	g.Expect(gh.PR(2).BaseRefName).To(Equal("main"))
+	prBody, err := github.NewPrBody(gh.PR(2).Body)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(prBody.Stack).To(Equal([]github.PrStackItem{
+		{PRNum: 1, Depth: 0, Merged: true},
+		{PRNum: 2, Depth: 1},
+		{PRNum: 3, Depth: 2},
+	}))
+
+	// The landed branch is cleaned up and the rest of the stack is restacked on master.
+	g.Expect(repo.BranchExists("a")).To(BeFalse())
+	g.Expect(repo.BranchExists("b")).To(BeTrue())
+	g.Expect(repo.IsAncestor("main", "b")).To(BeTrue())
+	g.Expect(repo.IsAncestor("b", "c")).To(BeTrue())
+}
+
+func TestLand_waitsForChecksAfterRetarget(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		retargetStatus  github.PRStatus
+		expectedBlocker string
+	}{
+		{
+			name:            "checks pending",
+			retargetStatus:  github.PRStatus{Number: 2, CheckState: "PENDING", Mergeable: "MERGEABLE"},
+			expectedBlocker: "checks pending after retarget",
+		},
+		{
+			name:            "merge state unknown",
+			retargetStatus:  github.PRStatus{Number: 2, CheckState: "SUCCESS", Mergeable: "UNKNOWN"},
+			expectedBlocker: "merge state unknown",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			repo := testutil.NewRepo(t)
+			gh := testutil.InstallFakeGH(t, repo)
+			repo.CreateBranch("a")
+			repo.CommitFile("a.txt", "a\n", "a1")
+			repo.CreateBranch("b")
+			repo.CommitFile("b.txt", "b\n", "b1")
+			g.Expect(runHg("submit")).To(Succeed())
+			gh.SetPRStatus(github.PRStatus{Number: 1, CheckState: "SUCCESS", Mergeable: "MERGEABLE"})
+			gh.SetPRStatus(github.PRStatus{Number: 2, CheckState: "SUCCESS", Mergeable: "MERGEABLE"})
+			gh.SetPRStatusAfterRetarget(tc.retargetStatus)
+
+			out, err := runHgAndCaptureOutput(t, "land", "--method", "merge", "--wait", "0")
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(out).To(ContainSubstring(tc.expectedBlocker))
+
+			g.Expect(gh.PR(1).State).To(Equal("MERGED"))
+			g.Expect(gh.PR(2).State).To(Equal("OPEN"))
+			g.Expect(gh.PR(2).BaseRefName).To(Equal("main"))
+			g.Expect(repo.BranchExists("a")).To(BeFalse())
+		})
+	}
+}
+
+func TestLand_pollsRetargetedPRUntilChecksFinish(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	g.Expect(runHg("submit")).To(Succeed())
+	gh.SetPRStatus(github.PRStatus{Number: 1, CheckState: "SUCCESS", Mergeable: "MERGEABLE"})
+	gh.SetPRStatus(github.PRStatus{Number: 2, CheckState: "SUCCESS", Mergeable: "MERGEABLE"})
+	gh.SetPRStatusAfterRetarget(
+		github.PRStatus{Number: 2, CheckState: "PENDING", Mergeable: "UNKNOWN"},
+		github.PRStatus{Number: 2, CheckState: "PENDING", Mergeable: "MERGEABLE"},
+		github.PRStatus{Number: 2, CheckState: "SUCCESS", Mergeable: "MERGEABLE"},
+	)
+	previousInterval := landPollInterval
+	landPollInterval = time.Millisecond
+	t.Cleanup(func() { landPollInterval = previousInterval })
+
+	g.Expect(runHg("land", "--method", "merge")).To(Succeed())
+
+	g.Expect(gh.PR(1).State).To(Equal("MERGED"))
+	g.Expect(gh.PR(2).State).To(Equal("MERGED"))
+	g.Expect(repo.BranchExists("b")).To(BeFalse())
+}
+
+func TestLand_squashAsksToPushRestackedBranches(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	g.Expect(runHg("submit")).To(Succeed())
+	gh.SetPRStatus(github.PRStatus{Number: 1, CheckState: "SUCCESS", Mergeable: "MERGEABLE"})
+	gh.SetPRStatus(github.PRStatus{Number: 2, IsDraft: true, CheckState: "SUCCESS", Mergeable: "MERGEABLE"})
+
+	out, err := runHgAndCaptureOutput(t, "land", "--method", "squash")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(ContainSubstring(`Run "hg submit" to push the branches restacked onto master`))
+
+	// The PR of the restacked branch only shows its own changes once pushed.
+	g.Expect(repo.OriginGit("diff", "--name-only", "main...b")).To(Equal("a.txt\nb.txt"))
+	g.Expect(runHg("submit")).To(Succeed())
+	g.Expect(repo.OriginGit("diff", "--name-only", "main...b")).To(Equal("b.txt"))
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yapaluc/hg-git/src/config"
+	"github.com/yapaluc/hg-git/src/git"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+func newLogCmd() *cobra.Command {
+	var rev string
+	var templateName string
+	var limit int
+	var graph bool
+	var cmd = &cobra.Command{
+		Use:   "log [-r revset] [-T template] [-l limit] [-G graph]",
+		Short: "Shows the commits matching a revset, most recent first.",
+		Long: `Shows the commits matching a revset, most recent first. Defaults to all the commits of the branch graph.
+			The template is either the name of a built-in template (default, short, hash),
+			the name of a template defined with the templates setting (e.g. git config hggit.templates.mine '{{.ShortHash}}\n'),
+			or a Go text/template, e.g. -T '{{.ShortHash}} {{join .Branches ","}}\n'.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runLog(getConfig(cmd), rev, templateName, limit, graph)
+		},
+	}
+	cmd.Flags().StringVarP(&rev, "rev", "r", "all()", "Revset of the commits to show")
+	cmd.Flags().StringVarP(&templateName, "template", "T", "default", "Template name or template")
+	cmd.Flags().IntVarP(&limit, "limit", "l", 0, "Maximum number of commits to show")
+	cmd.Flags().BoolVarP(&graph, "graph", "G", false, "Show the branch graph of the commits")
+	return cmd
+}
+
+func runLog(cfg *config.Config, rev string, templateName string, limit int, graph bool) error {
+	tmpl, err := parseLogTemplate(cfg.Templates, templateName)
+	if err != nil {
+		return err
+	}
+	repoData, err := git.NewRepoData(
+		git.RepoDataIncludeCommitMetadata,
+		git.RepoDataIncludeBranchDescription,
+	)
+	if err != nil {
+		return err
+	}
+	commitHashes, err := repoData.EvalRevset(rev)
+	if err != nil {
+		return err
+	}
+	commitHashes = lo.Reverse(commitHashes)
+	if limit > 0 && len(commitHashes) > limit {
+		commitHashes = commitHashes[:limit]
+	}
+
+	var nodes []*git.TreeNode
+	for _, commitHash := range commitHashes {
+		node, err := repoData.NodeForCommit(commitHash)
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, node)
+	}
+	render := func(node *git.TreeNode) (string, error) {
+		var sb strings.Builder
+		err := tmpl.Execute(&sb, newLogEntry(node))
+		if err != nil {
+			return "", fmt.Errorf("rendering commit %s: %w", node.CommitMetadata.CommitHash, err)
+		}
+		return sb.String(), nil
+	}
+
+	if !graph {
+		for _, node := range nodes {
+			out, err := render(node)
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+		}
+		return nil
+	}
+
+	renderer := &graphRenderer{
+		children: getLogGraphChildren(repoData, nodes),
+		render: func(node *git.TreeNode) ([]string, error) {
+			out, err := render(node)
+			if err != nil {
+				return nil, err
+			}
+			out = strings.TrimRight(out, "\n")
+			if out == "" {
+				return nil, nil
+			}
+			return strings.Split(out, "\n"), nil
+		},
+	}
+	return renderer.printChildren(repoData.BranchRootNode, "")
+}
+
+// Returns a function that links each shown node to its closest shown ancestor in the branch graph.
+// Nodes outside of the branch graph are children of the root node.
+func getLogGraphChildren(
+	repoData *git.RepoData,
+	nodes []*git.TreeNode,
+) func(node *git.TreeNode) []*git.TreeNode {
+	shown := lo.SliceToMap(nodes, func(node *git.TreeNode) (*git.TreeNode, bool) {
+		return node, true
+	})
+	return func(node *git.TreeNode) []*git.TreeNode {
+		var children []*git.TreeNode
+		var dfs func(node *git.TreeNode)
+		dfs = func(node *git.TreeNode) {
+			for _, child := range node.BranchChildren {
+				if shown[child] {
+					children = append(children, child)
+				} else {
+					dfs(child)
+				}
+			}
+		}
+		dfs(node)
+		if node == repoData.BranchRootNode {
+			for _, node := range nodes {
+				if node.BranchParent == nil {
+					children = append(children, node)
+				}
+			}
+		}
+		sortSiblings(children)
+		return children
+	}
+}
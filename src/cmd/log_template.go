@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	gotemplate "text/template"
+	"time"
+
+	"github.com/yapaluc/hg-git/src/git"
+	"github.com/yapaluc/hg-git/src/util"
+
+	"github.com/fatih/color"
+	"github.com/samber/lo"
+)
+
+// Built-in templates for `hg log -T`. Users can define more with the templates setting, e.g.
+// `git config hggit.templates.mine '{{.ShortHash}} {{.Title}}\n'`.
+var builtinLogTemplates = map[string]string{
+	"default": `{{yellow (printf "commit:      %s" .ShortHash)}}
+{{with .Branches}}bookmark:    {{green (join . ", ")}}
+{{end}}{{with .PR}}pr:          {{link . $.PRURL}}
+{{end}}user:        {{.Author}}
+date:        {{.Date}} ({{.Time}} ago)
+summary:     {{.Title}}
+
+`,
+	"short": `{{if .IsHead}}{{magenta .ShortHash}}{{else}}{{yellow .ShortHash}}{{end}} {{.Author}} ` +
+		`{{with .Branches}}{{green (printf "(%s)" (join . ", "))}} {{end}}` +
+		`{{with .PR}}{{bold (link . $.PRURL)}} {{end}}{{blue .Time}} {{.Title}}
+`,
+	"hash": `{{.Hash}}
+`,
+}
+
+// logEntry is the data available to log templates.
+type logEntry struct {
+	Hash      string
+	ShortHash string
+	Author    string
+	// Branch names pointing at the commit.
+	Branches []string
+	// PR number prefixed with "#", or empty if the branch has no PR.
+	PR    string
+	PRURL string
+	// Branch description title if any, otherwise the commit title.
+	Title       string
+	CommitTitle string
+	// Branch description body, without the PR URL.
+	Description string
+	// Relative time, e.g. "5m".
+	Time      string
+	Date      string
+	Timestamp int64
+	// True if the commit is checked out.
+	IsHead bool
+	// True if the commit is master or one of its ancestors.
+	IsPublic bool
+}
+
+func newLogEntry(node *git.TreeNode) *logEntry {
+	metadata := node.CommitMetadata
+	prURL, prText := metadata.PRURL()
+	entry := &logEntry{
+		Hash:        metadata.CommitHash,
+		ShortHash:   metadata.ShortCommitHash,
+		Author:      metadata.Author,
+		Branches:    metadata.CleanedBranchNames(),
+		PR:          prText,
+		PRURL:       prURL,
+		Title:       metadata.Title,
+		CommitTitle: metadata.Title,
+		Time:        renderRelativeTime(metadata.Timestamp),
+		Date:        time.Unix(metadata.Timestamp, 0).Format("Mon Jan 02 15:04:05 2006 -0700"),
+		Timestamp:   metadata.Timestamp,
+		IsHead:      metadata.IsHead,
+		IsPublic:    metadata.IsAncestorOfMaster(),
+	}
+	if metadata.BranchDescription != nil {
+		entry.Title = metadata.BranchDescription.Title
+		entry.Description = metadata.BranchDescription.Body
+	}
+	return entry
+}
+
+var logTemplateFuncs = gotemplate.FuncMap{
+	"blue":    color.BlueString,
+	"green":   color.GreenString,
+	"magenta": color.MagentaString,
+	"red":     color.RedString,
+	"yellow":  color.YellowString,
+	"bold": func(s string) string {
+		return color.New(color.Bold).Sprint(s)
+	},
+	"link": util.Linkify,
+	"join": strings.Join,
+	"indent": func(prefix string, s string) string {
+		return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// Resolves the -T flag, which is either the name of a template or a template itself.
+// Templates given inline or defined by the user may use \n and \t escapes.
+func parseLogTemplate(userTemplates map[string]string, nameOrTemplate string) (*gotemplate.Template, error) {
+	// Template names are case-insensitive like git config variable names, and stored in lower case.
+	text, ok := userTemplates[strings.ToLower(nameOrTemplate)]
+	if ok {
+		text = unescapeLogTemplate(text)
+	} else {
+		text, ok = builtinLogTemplates[nameOrTemplate]
+	}
+	if !ok {
+		if isLogTemplateName(nameOrTemplate) {
+			names := lo.Uniq(append(lo.Keys(builtinLogTemplates), lo.Keys(userTemplates)...))
+			sort.Strings(names)
+			return nil, fmt.Errorf(
+				"unknown template %q. available templates: %s",
+				nameOrTemplate,
+				strings.Join(names, ", "),
+			)
+		}
+		text = unescapeLogTemplate(nameOrTemplate)
+	}
+	tmpl, err := gotemplate.New(nameOrTemplate).Funcs(logTemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing template: %w", err)
+	}
+	return tmpl, nil
+}
+
+var logTemplateNameRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`)
+
+// Names are the same as git config variable names, so that user templates can be defined there.
+func isLogTemplateName(s string) bool {
+	return logTemplateNameRegexp.MatchString(s)
+}
+
+func unescapeLogTemplate(text string) string {
+	return strings.NewReplacer(`\n`, "\n", `\t`, "\t").Replace(text)
+}
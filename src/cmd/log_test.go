@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestLog_revsetAndTemplate(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.SetBranchDescription("b", "Title of b", "Description of b\n\nPR: "+testutil.FakeRepoURL+"/pull/7")
+
+	out, err := runHgAndCaptureOutput(t, "log", "-r", "draft()", "-T", `{{.Title}}|{{join .Branches ","}}|{{.PR}}\n`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(Equal("Title of b|b|#7\nTitle of a|a|\n"))
+
+	out, err = runHgAndCaptureOutput(t, "log", "-r", "all()", "-T", "hash", "-l", "1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(Equal(repo.Hash("b") + "\n"))
+
+	out, err = runHgAndCaptureOutput(t, "log", "-r", ".^")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(ContainSubstring("bookmark:    a\n"))
+	g.Expect(out).To(ContainSubstring("summary:     Title of a\n"))
+}
+
+func TestLog_userTemplateAndGraph(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.Checkout("a")
+	repo.CreateBranch("c")
+	repo.CommitFile("c.txt", "c\n", "c1")
+	repo.Git("config", "hggit.templates.names", `{{join .Branches ","}}\n`)
+
+	out, err := runHgAndCaptureOutput(t, "log", "-G", "-T", "names", "-r", "b | c")
+	g.Expect(err).ToNot(HaveOccurred())
+	// b and c have no shown ancestor, so they are both roots.
+	g.Expect(out).To(SatisfyAny(
+		Equal("o b\n|\n| * c\n|/ \n"),
+		Equal("* c\n|\n| o b\n|/ \n"),
+	))
+
+	out, err = runHgAndCaptureOutput(t, "log", "-G", "-T", "names", "-r", "stack()")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(HaveSuffix("|/ \no a\n|\n"))
+
+	_, err = runHgAndCaptureOutput(t, "log", "-T", "unknown")
+	g.Expect(err).To(MatchError(ContainSubstring("available templates: default, hash, names, short")))
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.RunFakeGHIfRequested()
+	os.Exit(m.Run())
+}
+
+// runHg runs a command the same way as the hg binary, in the current directory.
+func runHg(args ...string) error {
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs(args)
+	rootCmd.SilenceUsage = true
+	rootCmd.SilenceErrors = true
+	err := rootCmd.Execute()
+	stopDryRun()
+	if recordErr := stopRecording(); recordErr != nil && err == nil {
+		err = recordErr
+	}
+	return err
+}
+
+// runHgAndCaptureOutput runs a command like runHg and returns what it printed to stdout.
+func runHgAndCaptureOutput(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	return runHgAndCapture(t, &os.Stdout, args...)
+}
+
+// runHgAndCaptureStderr runs a command like runHg and returns what it printed to stderr.
+func runHgAndCaptureStderr(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	return runHgAndCapture(t, &os.Stderr, args...)
+}
+
+func runHgAndCapture(t *testing.T, file **os.File, args ...string) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("creating pipe: %s", err)
+	}
+	original := *file
+	*file = w
+	outCh := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		outCh <- string(out)
+	}()
+	err = runHg(args...)
+	*file = original
+	w.Close()
+	return <-outCh, err
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yapaluc/hg-git/src/git"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func newOplogCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "oplog",
+		Short: "Lists the stack-mutating operations that can be undone with `hg undo`.",
+		Long:  "Lists the stack-mutating operations that can be undone with `hg undo`, most recent first. The current operation is marked with @ and undone operations, which can be reapplied with `hg redo`, are marked with x.",
+		Args:  cobra.NoArgs,
+		RunE:  runOplog,
+	}
+}
+
+func runOplog(_ *cobra.Command, args []string) error {
+	oplog, err := git.LoadOplog()
+	if err != nil {
+		return err
+	}
+	if len(oplog.Entries) == 0 {
+		fmt.Println("No operations recorded.")
+		return nil
+	}
+	for i := len(oplog.Entries) - 1; i >= 0; i-- {
+		entry := oplog.Entries[i]
+		var marker string
+		switch {
+		case i == oplog.Position-1:
+			marker = "@"
+		case i >= oplog.Position:
+			marker = "x"
+		default:
+			marker = "o"
+		}
+		line := fmt.Sprintf(
+			"%s %s %s %s",
+			marker,
+			color.YellowString("%d", entry.ID),
+			color.BlueString(renderRelativeTime(entry.Timestamp)),
+			entry.Command,
+		)
+		changedBranches := entry.ChangedBranches()
+		if len(changedBranches) > 0 {
+			line += " " + color.GreenString("(%s)", strings.Join(changedBranches, ", "))
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// recordOperation runs a stack-mutating operation and records the state of the repo
+// before and after it in the oplog, so that it can be undone with `hg undo`.
+// The operation is recorded even if it fails midway, since partial changes are worth undoing too.
+func recordOperation(operation func() error) error {
+	if dryRun {
+		// Nothing changes, so there is nothing to undo.
+		return operation()
+	}
+	before, err := git.TakeRepoSnapshot()
+	if err != nil {
+		return fmt.Errorf("taking snapshot before operation: %w", err)
+	}
+
+	opErr := operation()
+
+	err = recordSnapshots(before)
+	if err != nil {
+		if opErr != nil {
+			return opErr
+		}
+		return fmt.Errorf("recording operation in oplog: %w", err)
+	}
+	return opErr
+}
+
+func recordSnapshots(before *git.RepoSnapshot) error {
+	after, err := git.TakeRepoSnapshot()
+	if err != nil {
+		return fmt.Errorf("taking snapshot after operation: %w", err)
+	}
+	if len(git.ChangedBranches(before, after)) == 0 &&
+		before.HeadBranch == after.HeadBranch &&
+		before.HeadCommitHash == after.HeadCommitHash {
+		// Nothing to undo.
+		return nil
+	}
+
+	oplog, err := git.LoadOplog()
+	if err != nil {
+		return err
+	}
+	oplog.Record(strings.Join(append([]string{"hg"}, os.Args[1:]...), " "), before, after)
+	return oplog.Save()
+}
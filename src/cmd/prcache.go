@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/samber/lo"
+	"github.com/yapaluc/hg-git/src/github"
+)
+
+// prCache is a github.Client that remembers every PR it has seen, so that commands
+// touching many PRs can prefetch them in one batched request and fetch each PR at most once.
+// Lookups that miss the cache fall back to the underlying client.
+type prCache struct {
+	client github.Client
+
+	mu sync.Mutex
+	// A nil PR means that the branch is known to have no open PR.
+	prsByBranch map[string]*github.PullRequest
+	prsByNum    map[int]*github.PullRequest
+}
+
+func newPRCache(client github.Client) *prCache {
+	return &prCache{
+		client:      client,
+		prsByBranch: make(map[string]*github.PullRequest),
+		prsByNum:    make(map[int]*github.PullRequest),
+	}
+}
+
+// prefetch fetches the PRs of the given branches and the given PR numbers that are not cached yet,
+// in a single request.
+func (c *prCache) prefetch(branchNames []string, prNums []int) error {
+	c.mu.Lock()
+	branchNames = lo.Uniq(lo.Filter(branchNames, func(branchName string, _ int) bool {
+		_, ok := c.prsByBranch[branchName]
+		return !ok
+	}))
+	prNums = lo.Uniq(lo.Filter(prNums, func(prNum int, _ int) bool {
+		_, ok := c.prsByNum[prNum]
+		return prNum != 0 && !ok
+	}))
+	c.mu.Unlock()
+	if len(branchNames) == 0 && len(prNums) == 0 {
+		return nil
+	}
+
+	prsByBranch, prsByNum, err := c.client.FetchPRs(branchNames, prNums)
+	if err != nil {
+		return fmt.Errorf("prefetching PRs: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, branchName := range branchNames {
+		c.storeBranch(branchName, prsByBranch[branchName])
+	}
+	for _, pr := range prsByNum {
+		c.store(pr)
+	}
+	return nil
+}
+
+// prefetchReferenced fetches the PRs referenced by the bodies of the cached PRs.
+func (c *prCache) prefetchReferenced() error {
+	c.mu.Lock()
+	var prNums []int
+	for _, pr := range c.prsByNum {
+		prBody, err := github.NewPrBody(pr.Body)
+		if err != nil {
+			// Reported when the PR is processed.
+			continue
+		}
+		prNums = append(prNums, prBody.PreviousPR)
+		prNums = append(prNums, prBody.NextPRs...)
+		for _, item := range prBody.Stack {
+			prNums = append(prNums, item.PRNum)
+		}
+	}
+	c.mu.Unlock()
+	return c.prefetch(nil, prNums)
+}
+
+// Must be called with the lock held.
+func (c *prCache) store(pr *github.PullRequest) {
+	c.prsByNum[pr.Number] = pr
+	if existing, ok := c.prsByBranch[pr.HeadRefName]; ok && existing != nil &&
+		existing.Number == pr.Number {
+		c.prsByBranch[pr.HeadRefName] = pr
+	}
+}
+
+// Must be called with the lock held.
+func (c *prCache) storeBranch(branchName string, pr *github.PullRequest) {
+	c.prsByBranch[branchName] = pr
+	if pr != nil {
+		c.prsByNum[pr.Number] = pr
+	}
+}
+
+func (c *prCache) FetchPRForBranch(branchName string) (*github.PullRequest, error) {
+	c.mu.Lock()
+	pr, ok := c.prsByBranch[branchName]
+	c.mu.Unlock()
+	if ok {
+		return pr, nil
+	}
+
+	pr, err := c.client.FetchPRForBranch(branchName)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.storeBranch(branchName, pr)
+	return pr, nil
+}
+
+func (c *prCache) FetchPRByNum(prNum int) (*github.PullRequest, error) {
+	c.mu.Lock()
+	pr, ok := c.prsByNum[prNum]
+	c.mu.Unlock()
+	if ok {
+		return pr, nil
+	}
+
+	pr, err := c.client.FetchPRByNum(prNum)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store(pr)
+	return pr, nil
+}
+
+func (c *prCache) FetchPRByURLOrNum(prURLOrNum string) (*github.PullRequest, error) {
+	if prNum, ok := github.ParsePRNum(prURLOrNum); ok {
+		return c.FetchPRByNum(prNum)
+	}
+	return c.client.FetchPRByURLOrNum(prURLOrNum)
+}
+
+func (c *prCache) FetchPRs(
+	branchNames []string,
+	prNums []int,
+) (map[string]*github.PullRequest, map[int]*github.PullRequest, error) {
+	err := c.prefetch(branchNames, prNums)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prsByBranch := make(map[string]*github.PullRequest)
+	for _, branchName := range branchNames {
+		if pr := c.prsByBranch[branchName]; pr != nil {
+			prsByBranch[branchName] = pr
+		}
+	}
+	prsByNum := make(map[int]*github.PullRequest)
+	for _, prNum := range prNums {
+		if pr, ok := c.prsByNum[prNum]; ok {
+			prsByNum[prNum] = pr
+		}
+	}
+	return prsByBranch, prsByNum, nil
+}
+
+// Statuses change independently of the PRs, so they are not cached.
+func (c *prCache) FetchPRStatuses(prNums []int) (map[int]*github.PRStatus, error) {
+	return c.client.FetchPRStatuses(prNums)
+}
+
+func (c *prCache) CreatePR(opts github.CreatePROpts) (*github.PullRequest, error) {
+	pr, err := c.client.CreatePR(opts)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.storeBranch(opts.Head, pr)
+	return pr, nil
+}
+
+func (c *prCache) EditPR(prNum int, opts github.EditPROpts) error {
+	err := c.client.EditPR(prNum, opts)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pr, ok := c.prsByNum[prNum]
+	if !ok {
+		return nil
+	}
+	// Store an updated copy since callers may still be reading the old one.
+	updated := *pr
+	if opts.Base != nil {
+		updated.BaseRefName = *opts.Base
+	}
+	if opts.Title != nil {
+		updated.Title = *opts.Title
+	}
+	if opts.Body != nil {
+		updated.Body = *opts.Body
+	}
+	c.store(&updated)
+	return nil
+}
+
+func (c *prCache) MergePR(prNum int, method github.MergeMethod) error {
+	err := c.client.MergePR(prNum, method)
+	if err != nil {
+		return err
+	}
+	c.markPRNotOpen(prNum, "MERGED")
+	return nil
+}
+
+func (c *prCache) ClosePR(prNum int, comment string) error {
+	err := c.client.ClosePR(prNum, comment)
+	if err != nil {
+		return err
+	}
+	c.markPRNotOpen(prNum, "CLOSED")
+	return nil
+}
+
+// Stores the new state of a PR that was merged or closed, whose branch has no open PR anymore.
+// An updated copy is stored since callers may still be reading the old one.
+func (c *prCache) markPRNotOpen(prNum int, state string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pr, ok := c.prsByNum[prNum]
+	if !ok {
+		return
+	}
+	updated := *pr
+	updated.State = state
+	c.store(&updated)
+	c.storeBranch(pr.HeadRefName, nil)
+}
+
+func (c *prCache) RepoURL() (string, error) {
+	return c.client.RepoURL()
+}
+
+func (c *prCache) HeadOwner() string {
+	return c.client.HeadOwner()
+}
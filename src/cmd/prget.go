@@ -2,9 +2,13 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/alessio/shellescape"
 	"github.com/spf13/cobra"
+	"github.com/yapaluc/hg-git/src/config"
+	"github.com/yapaluc/hg-git/src/git"
+	"github.com/yapaluc/hg-git/src/github"
 	"github.com/yapaluc/hg-git/src/shell"
 )
 
@@ -17,22 +21,98 @@ func newPrgetCmd() *cobra.Command {
 	}
 }
 
-func runPrget(_ *cobra.Command, args []string) error {
+func runPrget(cmd *cobra.Command, args []string) error {
 	// TODO - restack after running this
 	prURLOrNum := args[0]
-	return checkoutPR(prURLOrNum)
+	cfg := getConfig(cmd)
+	client, err := newGitHubClient(cfg)
+	if err != nil {
+		return err
+	}
+	return checkoutPR(cfg, client, prURLOrNum)
 }
 
-func checkoutPR(prURLOrNumOrBranch string) error {
-	_, err := shell.Run(
-		shell.Opt{StreamOutputToStdout: true},
-		fmt.Sprintf(
-			"gh pr checkout %s",
-			shellescape.Quote(prURLOrNumOrBranch),
-		),
+// Checks out the head branch of the PR, creating it from the branch of the remote it was pushed to
+// or fast-forwarding it if it already exists locally. The head of PRs opened from the forks of other users
+// is fetched from the PR ref of the base remote, since their branch is on none of the remotes.
+func checkoutPR(cfg *config.Config, client github.Client, prURLOrNumOrBranch string) error {
+	var prData *github.PullRequest
+	var err error
+	if _, ok := github.ParsePRNum(prURLOrNumOrBranch); ok {
+		prData, err = client.FetchPRByURLOrNum(prURLOrNumOrBranch)
+	} else {
+		prData, err = client.FetchPRForBranch(prURLOrNumOrBranch)
+	}
+	if err != nil {
+		return fmt.Errorf("fetching PR %q: %w", prURLOrNumOrBranch, err)
+	}
+	if prData == nil {
+		return fmt.Errorf("no open PR found for branch %q", prURLOrNumOrBranch)
+	}
+
+	branchName := prData.HeadRefName
+	remote := cfg.BaseRemote
+	sourceRef := "refs/heads/" + branchName
+	isFromOtherFork, err := isPRFromOtherFork(client, prData)
+	if err != nil {
+		return err
+	}
+	switch {
+	case cfg.PushesToFork() && strings.EqualFold(prData.HeadRepositoryOwner.Login, client.HeadOwner()):
+		remote = cfg.PushRemote
+	case isFromOtherFork:
+		sourceRef = fmt.Sprintf("refs/pull/%d/head", prData.Number)
+	}
+	remoteRef := fmt.Sprintf("refs/remotes/%s/%s", remote, branchName)
+	if isFromOtherFork {
+		remoteRef = fmt.Sprintf("refs/remotes/%s/pull/%d", remote, prData.Number)
+	}
+	cmd := fmt.Sprintf(
+		"git fetch %s %s",
+		shellescape.Quote(remote),
+		shellescape.Quote(fmt.Sprintf("+%s:%s", sourceRef, remoteRef)),
 	)
+	switch {
+	case git.GetBranchCommitHash(branchName) != "":
+		cmd += fmt.Sprintf(
+			" && git switch %s && git merge --ff-only %s",
+			shellescape.Quote(branchName),
+			shellescape.Quote(remoteRef),
+		)
+	case isFromOtherFork:
+		// The PR ref is not a remote branch, so it cannot be tracked.
+		cmd += fmt.Sprintf(
+			" && git switch -c %s %s",
+			shellescape.Quote(branchName),
+			shellescape.Quote(remoteRef),
+		)
+	default:
+		cmd += fmt.Sprintf(
+			" && git switch -c %s --track %s",
+			shellescape.Quote(branchName),
+			shellescape.Quote(remote+"/"+branchName),
+		)
+	}
+	_, err = shell.Run(shell.Opt{StreamOutputToStdout: true, PrintCommand: true}, cmd)
 	if err != nil {
-		return fmt.Errorf("running gh pr checkout: %w", err)
+		return fmt.Errorf("checking out branch %q of PR %s: %w", branchName, prData.URL, err)
 	}
 	return nil
 }
+
+// Returns true if the PR was opened from a fork other than the one branches are pushed to.
+func isPRFromOtherFork(client github.Client, pr *github.PullRequest) (bool, error) {
+	headOwner := pr.HeadRepositoryOwner.Login
+	if headOwner == "" || strings.EqualFold(headOwner, client.HeadOwner()) {
+		return false, nil
+	}
+	repoURL, err := client.RepoURL()
+	if err != nil {
+		return false, fmt.Errorf("getting repo URL: %w", err)
+	}
+	repo, err := github.ParseRemoteURL(repoURL)
+	if err != nil {
+		return false, fmt.Errorf("parsing repo URL: %w", err)
+	}
+	return !strings.EqualFold(headOwner, repo.Owner), nil
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/github"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestPrget_prFromOtherFork(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	// The branch of the contributor is only available as the PR ref of the base repo.
+	repo.CreateBranch("contrib")
+	repo.CommitFile("c.txt", "c\n", "c1")
+	repo.Git("push", "-q", "origin", "contrib:refs/pull/1/head")
+	firstHash := repo.Hash("contrib")
+	repo.CommitFile("c.txt", "c2\n", "c2")
+	secondHash := repo.Hash("contrib")
+	repo.Checkout("main")
+	repo.Git("branch", "-q", "-D", "contrib")
+	pr := gh.AddPR(github.PullRequest{
+		BaseRefName:         "main",
+		HeadRefName:         "feature",
+		HeadRepositoryOwner: github.RepositoryOwner{Login: "contributor"},
+		Title:               "Feature",
+	})
+
+	g.Expect(runHg("prget", github.PRStrFromPRNum(pr.Number))).To(Succeed())
+	g.Expect(repo.CurrentBranch()).To(Equal("feature"))
+	g.Expect(repo.Hash("feature")).To(Equal(firstHash))
+
+	// The branch is fast-forwarded once the contributor pushes again.
+	repo.Git("push", "-q", "origin", secondHash+":refs/pull/1/head")
+	g.Expect(runHg("prget", pr.URL)).To(Succeed())
+	g.Expect(repo.Hash("feature")).To(Equal(secondHash))
+}
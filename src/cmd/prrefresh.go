@@ -18,17 +18,22 @@ func newPrRefreshCmd() *cobra.Command {
 	return cmd
 }
 
-func runPrrefresh(_ *cobra.Command, args []string) error {
+func runPrrefresh(cmd *cobra.Command, args []string) error {
 	currBranch, err := git.GetCurrentBranch()
 	if err != nil {
 		return fmt.Errorf("getting current branch: %w", err)
 	}
 
-	err = checkoutPR(currBranch)
+	cfg := getConfig(cmd)
+	client, err := newGitHubClient(cfg)
+	if err != nil {
+		return err
+	}
+	err = checkoutPR(cfg, client, currBranch)
 	if err != nil {
 		return fmt.Errorf("checking out PR for branch %q: %w", currBranch, err)
 	}
-	err = syncPR(currBranch)
+	err = syncPR(client, currBranch)
 	if err != nil {
 		return fmt.Errorf("syncing PR for branch %q: %w", currBranch, err)
 	}
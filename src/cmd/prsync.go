@@ -19,16 +19,20 @@ func newPrsyncCmd() *cobra.Command {
 	}
 }
 
-func runPrsync(_ *cobra.Command, args []string) error {
+func runPrsync(cmd *cobra.Command, args []string) error {
 	currBranch, err := git.GetCurrentBranch()
 	if err != nil {
 		return fmt.Errorf("getting current branch: %w", err)
 	}
-	return syncPR(currBranch)
+	client, err := newGitHubClient(getConfig(cmd))
+	if err != nil {
+		return err
+	}
+	return syncPR(client, currBranch)
 }
 
-func syncPR(branchName string) error {
-	prData, err := github.FetchPRForBranch(branchName)
+func syncPR(client github.Client, branchName string) error {
+	prData, err := client.FetchPRForBranch(branchName)
 	if err != nil {
 		return fmt.Errorf("getting PR data for branch %q: %w", branchName, err)
 	}
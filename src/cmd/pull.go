@@ -6,6 +6,7 @@ import (
 	"github.com/yapaluc/hg-git/src/git"
 	"github.com/yapaluc/hg-git/src/shell"
 
+	"github.com/alessio/shellescape"
 	"github.com/spf13/cobra"
 )
 
@@ -18,11 +19,12 @@ func newPullCmd() *cobra.Command {
 	}
 }
 
-func runPull(_ *cobra.Command, args []string) error {
-	return pull()
+func runPull(cmd *cobra.Command, args []string) error {
+	return pull(getConfig(cmd).BaseRemote)
 }
 
-func pull() error {
+// Fetches master from the remote and fast-forwards the local master branch.
+func pull(remote string) error {
 	masterBranch, err := git.GetMasterBranch()
 	if err != nil {
 		return fmt.Errorf("getting master branch: %w", err)
@@ -31,7 +33,8 @@ func pull() error {
 	_, err = shell.Run(
 		shell.Opt{StreamOutputToStdout: true},
 		fmt.Sprintf(
-			"git -c color.ui=always fetch origin %s:%s --update-head-ok",
+			"git -c color.ui=always fetch %s %s:%s --update-head-ok",
+			shellescape.Quote(remote),
 			masterBranch,
 			masterBranch,
 		),
@@ -3,9 +3,8 @@ package cmd
 import (
 	"fmt"
 
-	"github.com/alessio/shellescape"
+	"github.com/yapaluc/hg-git/src/config"
 	"github.com/yapaluc/hg-git/src/git"
-	"github.com/yapaluc/hg-git/src/shell"
 
 	"github.com/spf13/cobra"
 )
@@ -13,20 +12,46 @@ import (
 func newRebaseCmd() *cobra.Command {
 	var source string
 	var dest string
+	var strategy string
+	var cont bool
+	var abort bool
 	var cmd = &cobra.Command{
-		Use:   "rebase -s source -d dest",
+		Use:   "rebase -s source -d dest | --continue | --abort",
 		Short: "Rebases the given branch and its descendants onto the given branch. If possible, rebase is done with a merge instead of an actual rebase. For example, when rebasing the root of a stack, a merge is used. When rebasing the middle of a stack, a rebase is used.",
-		Args:  cobra.NoArgs,
-		RunE: func(_ *cobra.Command, args []string) error {
-			return runRebase(args, source, dest)
+		Long: `Rebases the given branch and its descendants onto the given branch, with the restack strategy of the repo or the one given with --strategy.
+			With the merge strategy, the root of a stack is rebased with a merge instead of an actual rebase, while the middle of a stack is always rebased since a merge cannot remove the changes of its previous parent branch.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return recordOperation(func() error {
+				if cont {
+					return continueRestack()
+				}
+				if abort {
+					return abortRestack()
+				}
+				if source == "" || dest == "" {
+					return fmt.Errorf("-s and -d are required")
+				}
+				return runRebase(getConfig(cmd), args, source, dest, strategy)
+			})
 		},
 	}
-	cmd.Flags().StringVarP(&source, "source", "s", "", "Source rev")
-	cmd.Flags().StringVarP(&dest, "dest", "d", "", "Destination rev")
+	cmd.Flags().StringVarP(&source, "source", "s", "", "Source rev or revset")
+	cmd.Flags().StringVarP(&dest, "dest", "d", "", "Destination rev or revset")
+	addRestackStrategyFlag(cmd, &strategy)
+	addRestackFlags(cmd, &cont, &abort)
+	for _, flag := range []string{"source", "dest", "strategy"} {
+		cmd.MarkFlagsMutuallyExclusive("continue", flag)
+		cmd.MarkFlagsMutuallyExclusive("abort", flag)
+	}
 	return cmd
 }
 
-func runRebase(_ []string, source, dest string) error {
+func runRebase(cfg *config.Config, _ []string, source, dest string, strategyFlag string) error {
+	strategy, err := getRestackStrategy(cfg, strategyFlag)
+	if err != nil {
+		return err
+	}
 	repoData, err := git.NewRepoData(git.RepoDataIncludeCommitMetadata)
 	if err != nil {
 		return err
@@ -51,74 +76,36 @@ func runRebase(_ []string, source, dest string) error {
 	sourceNode := repoData.BranchNameToNode[sourceBranch]
 	destNode := repoData.BranchNameToNode[destBranch]
 
-	if sourceNode.BranchParent.CommitMetadata.IsEffectiveMaster() {
-		err = rebaseRootOfStack(sourceNode, destNode)
+	plan, err := newRestackPlan(cfg, "rebase")
+	if err != nil {
+		return err
+	}
+	switch {
+	case strategy.rewritesHistory():
+		plan.Steps, err = getRestackSteps(strategy, sourceNode, destBranch, sourceNode.BaseCommitHash())
 		if err != nil {
-			return fmt.Errorf("rebasing root of stack: %w", err)
+			return fmt.Errorf("getting restack steps for rebase: %w", err)
 		}
-	} else {
-		err = rebaseMiddleOfStack(sourceNode, destNode)
+	case sourceNode.BranchParent.CommitMetadata.IsEffectiveMaster():
+		// Run series of merges.
+		mergeArgs, err := getMergeArgsForRebase(sourceNode, destNode)
 		if err != nil {
-			return fmt.Errorf("rebasing middle of stack: %w", err)
+			return fmt.Errorf("getting merge args for rebase on master: %w", err)
 		}
-	}
-
-	// Checkout original branch.
-	_, err = shell.Run(
-		shell.Opt{StreamOutputToStdout: true, PrintCommand: true},
-		fmt.Sprintf("git switch %s", shellescape.Quote(currBranch)),
-	)
-	if err != nil {
-		return fmt.Errorf("checking out original branch %q: %w", currBranch, err)
-	}
-	return nil
-}
-
-func rebaseMiddleOfStack(sourceNode *git.TreeNode, destNode *git.TreeNode) error {
-	// Get rebase args.
-	rebaseArgs, err := getRebaseArgsForRebase(sourceNode, destNode)
-	if err != nil {
-		return fmt.Errorf("getting rebase args for rebase: %w", err)
-	}
-
-	// Run rebases.
-	for _, rebaseArg := range rebaseArgs {
-		_, err = shell.Run(
-			shell.Opt{StreamOutputToStdout: true},
-			// -X theirs is for preferring current branch changes during conflicts
-			fmt.Sprintf(
-				"git checkout %s && git rebase --onto %s %s %s --update-refs -X theirs",
-				shellescape.Quote(rebaseArg.branchToRebase),
-				shellescape.Quote(rebaseArg.targetLocationBranch),
-				shellescape.Quote(rebaseArg.oldParentCommitHash),
-				shellescape.Quote(rebaseArg.branchToRebase),
-			),
-		)
-		if err == nil {
-			continue
-		}
-		err = maybePromptForMergeConflictResolution("git rebase --continue")
+		plan.Steps = mergeSteps(mergeArgs)
+	default:
+		rebaseArgs, err := getRebaseArgsForRebase(sourceNode, destNode)
 		if err != nil {
-			return fmt.Errorf("waiting for merge conflict resolution: %w", err)
+			return fmt.Errorf("getting rebase args for rebase: %w", err)
 		}
-	}
-	return nil
-}
-
-func rebaseRootOfStack(sourceNode *git.TreeNode, destNode *git.TreeNode) error {
-	// Run series of merges
-	mergeArgs, err := getMergeArgsForRebase(sourceNode, destNode)
-	if err != nil {
-		return fmt.Errorf(
-			"getting merge args for rebase on master: %w",
-			err,
-		)
+		plan.Steps = rebaseSteps(rebaseArgs)
 	}
 
-	// Execute merges.
-	err = executeRestack(mergeArgs)
+	// Restack and checkout original branch.
+	plan.BranchToCheckout = currBranch
+	err = executeRestack(plan)
 	if err != nil {
-		return fmt.Errorf("executing merges for rebase on master: %w", err)
+		return fmt.Errorf("executing rebase: %w", err)
 	}
 	return nil
 }
@@ -207,7 +194,7 @@ func getRebaseArgsForRebase(
 		rebaseArgs = append(rebaseArgs, rebaseArg{
 			branchToRebase:       node.CommitMetadata.CleanedBranchNames()[0],
 			targetLocationBranch: parent.CommitMetadata.CleanedBranchNames()[0],
-			oldParentCommitHash:  node.BranchParent.CommitMetadata.CommitHash,
+			oldParentCommitHash:  node.BaseCommitHash(),
 		})
 		for _, child := range node.BranchChildren {
 			err := dfs(child, node)
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestRebase_rootOfStackOntoMaster(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.Checkout("main")
+	repo.CommitFile("main.txt", "main\n", "main2")
+	repo.Checkout("b")
+
+	g.Expect(runHg("rebase", "-s", "a", "-d", "main")).To(Succeed())
+
+	g.Expect(repo.CurrentBranch()).To(Equal("b"))
+	g.Expect(repo.IsAncestor("main", "a")).To(BeTrue())
+	g.Expect(repo.IsAncestor("a", "b")).To(BeTrue())
+}
+
+func TestRebase_middleOfStackOntoOtherBranch(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.CreateBranch("c")
+	repo.CommitFile("c.txt", "c\n", "c1")
+	repo.Checkout("main")
+	repo.CreateBranch("d")
+	repo.CommitFile("d.txt", "d\n", "d1")
+
+	g.Expect(runHg("rebase", "-s", "b", "-d", "d")).To(Succeed())
+
+	g.Expect(repo.CurrentBranch()).To(Equal("d"))
+	g.Expect(repo.IsAncestor("d", "b")).To(BeTrue())
+	g.Expect(repo.IsAncestor("a", "b")).To(BeFalse())
+	g.Expect(repo.IsAncestor("b", "c")).To(BeTrue())
+}
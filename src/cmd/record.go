@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"github.com/yapaluc/hg-git/src/shell"
+)
+
+// recording captures the commands run by the current invocation, see the hidden --record flag.
+type recording struct {
+	runner  *shell.RecordingRunner
+	path    string
+	restore func()
+}
+
+var activeRecording *recording
+
+func startRecording(path string) {
+	runner := shell.NewRecordingRunner(shell.DefaultRunner())
+	activeRecording = &recording{
+		runner:  runner,
+		path:    path,
+		restore: shell.SetDefaultRunner(runner),
+	}
+}
+
+// Saves the recorded commands, even if the command failed. No-op if nothing is being recorded.
+func stopRecording() error {
+	if activeRecording == nil {
+		return nil
+	}
+	activeRecording.restore()
+	err := activeRecording.runner.Save(activeRecording.path)
+	activeRecording = nil
+	return err
+}
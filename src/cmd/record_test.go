@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/shell"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestRecordFlag(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+
+	g.Expect(runHg("--record", path, "bookmark", "b")).To(Succeed())
+
+	g.Expect(repo.BranchExists("b")).To(BeTrue())
+	fixtures, err := shell.LoadFixtures(path)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(fixtures).To(ContainElement(shell.Fixture{Command: "git switch -C b"}))
+	g.Expect(shell.DefaultRunner()).To(Equal(shell.BashRunner{}))
+}
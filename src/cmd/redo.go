@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/yapaluc/hg-git/src/git"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func newRedoCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "redo [operation id]",
+		Short: "Reapplies the last operation undone by `hg undo`.",
+		Long:  "Reapplies the last operation undone by `hg undo`, or all undone operations up to and including the given one (see `hg oplog`).",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runRedo(args)
+		},
+	}
+}
+
+func runRedo(args []string) error {
+	oplog, err := git.LoadOplog()
+	if err != nil {
+		return err
+	}
+	if oplog.Position == len(oplog.Entries) {
+		return fmt.Errorf("nothing to redo")
+	}
+
+	target := oplog.Position
+	if len(args) > 0 {
+		target, err = findOplogEntry(oplog, args[0])
+		if err != nil {
+			return err
+		}
+		if target < oplog.Position {
+			return fmt.Errorf("operation %s has not been undone", args[0])
+		}
+	}
+
+	for i := oplog.Position; i <= target; i++ {
+		entry := oplog.Entries[i]
+		color.Green("Redoing operation %d: %s", entry.ID, entry.Command)
+		err := git.RestoreRepoSnapshot(entry.After, entry.ChangedBranches())
+		if err != nil {
+			return fmt.Errorf("redoing operation %d: %w", entry.ID, err)
+		}
+		oplog.Position = i + 1
+		err = oplog.Save()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
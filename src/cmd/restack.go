@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/yapaluc/hg-git/src/config"
+	"github.com/yapaluc/hg-git/src/git"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func newRestackCmd() *cobra.Command {
+	var all bool
+	var strategy string
+	var cont bool
+	var abort bool
+	var cmd = &cobra.Command{
+		Use:   "restack [--all] [--strategy strategy] | --continue | --abort",
+		Short: "Restacks the stale branches of the current stack on their parent branch.",
+		Long: `Restacks the stale branches of the current stack, along with their descendants, on their parent branch.
+			A branch is stale when its parent branch moved without it, e.g. after committing to or pulling into the parent branch with plain git. Stale branches are marked in the smartlog.
+			With --all, the stale branches of all stacks are restacked. Branches are restacked with the restack strategy of the repo, or the one given with --strategy.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return recordOperation(func() error {
+				if cont {
+					return continueRestack()
+				}
+				if abort {
+					return abortRestack()
+				}
+				return runRestack(getConfig(cmd), all, strategy)
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&all, "all", false, "Restack the stale branches of all stacks")
+	addRestackStrategyFlag(cmd, &strategy)
+	addRestackFlags(cmd, &cont, &abort)
+	for _, flag := range []string{"all", "strategy"} {
+		cmd.MarkFlagsMutuallyExclusive("continue", flag)
+		cmd.MarkFlagsMutuallyExclusive("abort", flag)
+	}
+	return cmd
+}
+
+func runRestack(cfg *config.Config, all bool, strategyFlag string) error {
+	strategy, err := getRestackStrategy(cfg, strategyFlag)
+	if err != nil {
+		return err
+	}
+	repoData, err := git.NewRepoData(git.RepoDataIncludeCommitMetadata)
+	if err != nil {
+		return err
+	}
+	currBranch, err := git.GetCurrentBranch()
+	if err != nil {
+		return err
+	}
+
+	root := repoData.BranchRootNode
+	if !all {
+		node, ok := repoData.BranchNameToNode[currBranch]
+		if !ok {
+			return fmt.Errorf("missing node for branch %q", currBranch)
+		}
+		if node.CommitMetadata.IsEffectiveMaster() {
+			return fmt.Errorf("the current branch is not part of a stack. pass --all to restack all stacks")
+		}
+		root = getStackDescendants(node)[0]
+	}
+	staleNodes := getStaleNodes(root)
+	if len(staleNodes) == 0 {
+		color.Green("No stale branches to restack")
+		return nil
+	}
+
+	plan, err := newRestackPlan(cfg, "restack")
+	if err != nil {
+		return err
+	}
+	for _, node := range staleNodes {
+		steps, err := getRestackSteps(
+			strategy,
+			node,
+			node.BranchParent.CommitMetadata.CleanedBranchNames()[0],
+			node.BaseCommitHash(),
+		)
+		if err != nil {
+			return fmt.Errorf("finding restack order: %w", err)
+		}
+		plan.Steps = append(plan.Steps, steps...)
+	}
+	plan.BranchToCheckout = currBranch
+	err = executeRestack(plan)
+	if err != nil {
+		return fmt.Errorf("executing restack: %w", err)
+	}
+	return nil
+}
+
+// Returns the stale nodes below the given node, parents first.
+// The descendants of a stale node are restacked along with it, so they are not returned.
+func getStaleNodes(node *git.TreeNode) []*git.TreeNode {
+	var staleNodes []*git.TreeNode
+	var dfs func(node *git.TreeNode)
+	dfs = func(node *git.TreeNode) {
+		if node.IsStale() {
+			staleNodes = append(staleNodes, node)
+			return
+		}
+		for _, child := range sortedChildren(node) {
+			dfs(child)
+		}
+	}
+	dfs(node)
+	return staleNodes
+}
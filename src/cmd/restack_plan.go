@@ -0,0 +1,438 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/yapaluc/hg-git/src/config"
+	"github.com/yapaluc/hg-git/src/git"
+	"github.com/yapaluc/hg-git/src/shell"
+
+	"github.com/alessio/shellescape"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+const restackPlanFileName = "restack_state.json"
+
+// Returned when the user chooses to stop resolving conflicts and resume the restack later.
+var errRestackPaused = errors.New("restack paused")
+
+type restackStepKind string
+
+const (
+	restackStepMerge        restackStepKind = "merge"
+	restackStepRebase       restackStepKind = "rebase"
+	restackStepDeleteBranch restackStepKind = "deleteBranch"
+)
+
+type restackStep struct {
+	Kind restackStepKind
+	// Branch that receives the merge, is rebased or is deleted.
+	Branch string
+	// Branch that is merged into Branch, or that Branch is rebased onto.
+	Parent string
+	// For rebases, the commit that Branch was previously based on.
+	OldParentCommitHash string
+	// For rebases, whether the branches between OldParentCommitHash and Branch are moved along.
+	UpdateRefs bool
+	// Commit hash of Branch when the step was started. Used to tell whether
+	// an interrupted step completed.
+	StartCommitHash string
+}
+
+// restackPlan is the list of steps remaining in a restack. It is persisted before each step
+// so that a restack interrupted by a merge conflict can be resumed with --continue,
+// or rolled back with --abort.
+type restackPlan struct {
+	// Command that started the restack, e.g. "amend".
+	Command string
+	// State of the repo before the command ran. Restored by --abort.
+	Snapshot *git.RepoSnapshot
+	Steps    []restackStep
+	// Branch to check out once all steps are done.
+	BranchToCheckout string
+	// Message of the merge commits, followed by the name of the merged branch.
+	SyncMessage string
+	// PR changes of `hg fold`, made once all steps are done.
+	Fold *foldPRUpdate `json:",omitempty"`
+}
+
+// foldPRUpdate describes the PRs to update once a branch was folded.
+type foldPRUpdate struct {
+	FoldedBranch string
+	IntoBranch   string
+	// Base of the PRs that were based on the folded branch.
+	NewBase string
+	// Children of the folded branch, whose PRs may be based on it.
+	ChildBranches []string
+	MasterBranch  string
+}
+
+// Adds the --continue and --abort flags to a command that restacks.
+func addRestackFlags(cmd *cobra.Command, cont *bool, abort *bool) {
+	cmd.Flags().BoolVar(cont, "continue", false, "Continue an interrupted restack")
+	cmd.Flags().BoolVar(abort, "abort", false, "Abort an interrupted restack and restore the original state")
+	cmd.MarkFlagsMutuallyExclusive("continue", "abort")
+}
+
+func mergeSteps(mergeArgs []mergeArg) []restackStep {
+	var steps []restackStep
+	for _, mergeArg := range mergeArgs {
+		steps = append(steps, restackStep{
+			Kind:   restackStepMerge,
+			Branch: mergeArg.branchToReceiveMerge,
+			Parent: mergeArg.branchToMerge,
+		})
+	}
+	return steps
+}
+
+func rebaseSteps(rebaseArgs []rebaseArg) []restackStep {
+	var steps []restackStep
+	for _, rebaseArg := range rebaseArgs {
+		steps = append(steps, restackStep{
+			Kind:                restackStepRebase,
+			Branch:              rebaseArg.branchToRebase,
+			Parent:              rebaseArg.targetLocationBranch,
+			OldParentCommitHash: rebaseArg.oldParentCommitHash,
+			UpdateRefs:          true,
+		})
+	}
+	return steps
+}
+
+func deleteBranchStep(branchName string) restackStep {
+	return restackStep{Kind: restackStepDeleteBranch, Branch: branchName}
+}
+
+// newRestackPlan must be called before the command changes anything,
+// so that --abort can restore the repo to its original state.
+func newRestackPlan(cfg *config.Config, command string) (*restackPlan, error) {
+	existing, err := loadRestackPlan()
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf(
+			"a restack started by `hg %s` is in progress. run `hg %s --continue` or `hg %s --abort` first",
+			existing.Command,
+			existing.Command,
+			existing.Command,
+		)
+	}
+	snapshot, err := git.TakeRepoSnapshot()
+	if err != nil {
+		return nil, fmt.Errorf("taking snapshot before restack: %w", err)
+	}
+	return &restackPlan{Command: command, Snapshot: snapshot, SyncMessage: cfg.SyncMessage}, nil
+}
+
+// Returns nil if there is no restack in progress.
+func loadRestackPlan() (*restackPlan, error) {
+	path, err := getRestackPlanPath()
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading restack state: %w", err)
+	}
+	var plan restackPlan
+	err = json.Unmarshal(content, &plan)
+	if err != nil {
+		return nil, fmt.Errorf("decoding restack state %q: %w", path, err)
+	}
+	return &plan, nil
+}
+
+func (p *restackPlan) save() error {
+	path, err := getRestackPlanPath()
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("encoding restack state: %w", err)
+	}
+	err = os.WriteFile(path, content, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing restack state: %w", err)
+	}
+	return nil
+}
+
+func removeRestackPlan() error {
+	path, err := getRestackPlanPath()
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing restack state: %w", err)
+	}
+	return nil
+}
+
+func getRestackPlanPath() (string, error) {
+	dir, err := git.GetHgGitDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, restackPlanFileName), nil
+}
+
+// executeRestack runs the remaining steps of the plan and checks out BranchToCheckout.
+// If a step fails or the user pauses, the plan is left on disk to be resumed.
+func executeRestack(plan *restackPlan) error {
+	if dryRun {
+		printRestackPlan(plan)
+		return nil
+	}
+	for len(plan.Steps) > 0 {
+		step := &plan.Steps[0]
+		step.StartCommitHash = git.GetBranchCommitHash(step.Branch)
+		err := plan.save()
+		if err != nil {
+			return err
+		}
+
+		err = step.execute(plan.SyncMessage)
+		if errors.Is(err, errRestackPaused) {
+			return fmt.Errorf(
+				"restack paused. resolve the conflicts and run `hg %s --continue`, or run `hg %s --abort` to restore the original state",
+				plan.Command,
+				plan.Command,
+			)
+		}
+		if err != nil {
+			return fmt.Errorf(
+				"%w\nfix the issue and run `hg %s --continue`, or run `hg %s --abort` to restore the original state",
+				err,
+				plan.Command,
+				plan.Command,
+			)
+		}
+		plan.Steps = plan.Steps[1:]
+	}
+
+	err := plan.save()
+	if err != nil {
+		return err
+	}
+	if plan.BranchToCheckout != "" {
+		err = updateRev(plan.BranchToCheckout, nil)
+		if err != nil {
+			return fmt.Errorf("checking out original branch %q: %w", plan.BranchToCheckout, err)
+		}
+	}
+	return removeRestackPlan()
+}
+
+// Prints the steps of the plan instead of executing them, for --dry-run.
+func printRestackPlan(plan *restackPlan) {
+	if len(plan.Steps) == 0 {
+		printDryRun("nothing to restack")
+	} else {
+		printDryRun("restack plan:")
+		for i, step := range plan.Steps {
+			fmt.Printf("  %d. %s\n", i+1, step.String())
+		}
+	}
+	if plan.BranchToCheckout != "" {
+		printDryRun("check out %s", plan.BranchToCheckout)
+	}
+}
+
+func (s *restackStep) String() string {
+	switch s.Kind {
+	case restackStepMerge:
+		return fmt.Sprintf("merge %s into %s", s.Parent, s.Branch)
+	case restackStepRebase:
+		return fmt.Sprintf("rebase %s onto %s (previously based on %s)", s.Branch, s.Parent, s.OldParentCommitHash)
+	case restackStepDeleteBranch:
+		return fmt.Sprintf("delete branch %s", s.Branch)
+	default:
+		return fmt.Sprintf("unknown step %q on %s", s.Kind, s.Branch)
+	}
+}
+
+func (s *restackStep) execute(syncMessage string) error {
+	switch s.Kind {
+	case restackStepMerge:
+		_, err := shell.Run(
+			shell.Opt{StreamOutputToStdout: true, PrintCommand: true},
+			fmt.Sprintf(
+				"git switch %s && git merge %s -m %s",
+				shellescape.Quote(s.Branch),
+				shellescape.Quote(s.Parent),
+				shellescape.Quote(
+					fmt.Sprintf("%s (%s)", syncMessage, s.Parent),
+				),
+			),
+		)
+		if err == nil {
+			return nil
+		}
+		err = maybePromptForMergeConflictResolution("git commit --no-edit")
+		if err != nil {
+			return fmt.Errorf("waiting for merge conflict resolution: %w", err)
+		}
+		return nil
+	case restackStepRebase:
+		var updateRefsFlag string
+		if s.UpdateRefs {
+			updateRefsFlag = " --update-refs"
+		}
+		_, err := shell.Run(
+			shell.Opt{StreamOutputToStdout: true},
+			// -X theirs is for preferring current branch changes during conflicts
+			fmt.Sprintf(
+				"git checkout %s && git rebase --onto %s %s %s%s -X theirs",
+				shellescape.Quote(s.Branch),
+				shellescape.Quote(s.Parent),
+				shellescape.Quote(s.OldParentCommitHash),
+				shellescape.Quote(s.Branch),
+				updateRefsFlag,
+			),
+		)
+		if err == nil {
+			return nil
+		}
+		err = maybePromptForMergeConflictResolution("git rebase --continue")
+		if err != nil {
+			return fmt.Errorf("waiting for merge conflict resolution: %w", err)
+		}
+		return nil
+	case restackStepDeleteBranch:
+		color.Green("Pruning branch: %s", s.Branch)
+		if git.GetBranchCommitHash(s.Branch) == "" {
+			return nil
+		}
+		err := deleteBranches([]string{s.Branch})
+		if err != nil {
+			return fmt.Errorf("deleting local pruned branch %q: %w", s.Branch, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown restack step %q", s.Kind)
+	}
+}
+
+// Returns true if the step was started by a previous run and has since completed,
+// either by that run or by the user resolving conflicts and committing manually.
+func (s *restackStep) isDone() (bool, error) {
+	switch s.Kind {
+	case restackStepDeleteBranch:
+		return git.GetBranchCommitHash(s.Branch) == "", nil
+	case restackStepMerge, restackStepRebase:
+		commitHash := git.GetBranchCommitHash(s.Branch)
+		if s.StartCommitHash == "" || commitHash == s.StartCommitHash {
+			// Not started, or aborted midway.
+			return false, nil
+		}
+		return git.IsAncestor(s.Parent, s.Branch)
+	default:
+		return false, fmt.Errorf("unknown restack step %q", s.Kind)
+	}
+}
+
+// continueRestack finishes the merge or rebase that was interrupted, if any,
+// then runs the rest of the persisted plan.
+func continueRestack() error {
+	plan, err := loadRestackPlan()
+	if err != nil {
+		return err
+	}
+	if plan == nil {
+		return fmt.Errorf("no restack in progress")
+	}
+
+	if len(plan.Steps) > 0 {
+		err = concludeInterruptedStep()
+		if err != nil {
+			return err
+		}
+		done, err := plan.Steps[0].isDone()
+		if err != nil {
+			return err
+		}
+		if done {
+			plan.Steps = plan.Steps[1:]
+		}
+	}
+	return executeRestack(plan)
+}
+
+// The user is expected to have resolved the conflicts before running --continue.
+func concludeInterruptedStep() error {
+	var resolutionCommand string
+	if git.IsMergeInProgress() {
+		resolutionCommand = "git commit --no-edit"
+	} else if git.IsRebaseInProgress() {
+		resolutionCommand = "git rebase --continue"
+	} else {
+		return nil
+	}
+
+	_, err := shell.Run(
+		shell.Opt{StreamOutputToStdout: true, PrintCommand: true},
+		"git add --all && "+resolutionCommand,
+	)
+	if err == nil {
+		return nil
+	}
+	// Continuing a rebase can hit conflicts on the next commit.
+	err = maybePromptForMergeConflictResolution(resolutionCommand)
+	if errors.Is(err, errRestackPaused) {
+		return fmt.Errorf(
+			"restack still paused. resolve the conflicts and run --continue again, or run --abort",
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("waiting for merge conflict resolution: %w", err)
+	}
+	return nil
+}
+
+// abortRestack stops the merge or rebase that was interrupted, if any,
+// and restores the branches changed since the restack plan was created.
+func abortRestack() error {
+	plan, err := loadRestackPlan()
+	if err != nil {
+		return err
+	}
+	if plan == nil {
+		return fmt.Errorf("no restack in progress")
+	}
+
+	var abortCmd string
+	if git.IsMergeInProgress() {
+		abortCmd = "git merge --abort"
+	} else if git.IsRebaseInProgress() {
+		abortCmd = "git rebase --abort"
+	}
+	if abortCmd != "" {
+		_, err = shell.Run(shell.Opt{StreamOutputToStdout: true, PrintCommand: true}, abortCmd)
+		if err != nil {
+			return fmt.Errorf("aborting interrupted step: %w", err)
+		}
+	}
+
+	current, err := git.TakeRepoSnapshot()
+	if err != nil {
+		return err
+	}
+	err = git.RestoreRepoSnapshot(plan.Snapshot, git.ChangedBranches(plan.Snapshot, current))
+	if err != nil {
+		return fmt.Errorf("restoring original state: %w", err)
+	}
+	color.Green("Restored the state from before `hg %s`", plan.Command)
+	return removeRestackPlan()
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/yapaluc/hg-git/src/config"
+	"github.com/yapaluc/hg-git/src/git"
+
+	"github.com/spf13/cobra"
+)
+
+// restackStrategy is how branches are restacked on their parent branch once it changed.
+type restackStrategy string
+
+const (
+	// Merges the parent branch into each branch, keeping the pushed history intact.
+	restackStrategyMerge restackStrategy = "merge"
+	// Rebases each branch onto its parent branch, one branch at a time.
+	restackStrategyRebase restackStrategy = "rebase"
+	// Rebases the tips of the stack with --update-refs, which moves the branches below them along.
+	restackStrategyRebaseUpdateRefs restackStrategy = "rebase-update-refs"
+)
+
+var restackStrategies = []restackStrategy{
+	restackStrategyMerge,
+	restackStrategyRebase,
+	restackStrategyRebaseUpdateRefs,
+}
+
+// Adds the --strategy flag to a command that restacks, overriding the strategy configured for the repo.
+func addRestackStrategyFlag(cmd *cobra.Command, strategy *string) {
+	cmd.Flags().StringVar(
+		strategy,
+		"strategy",
+		"",
+		"How to restack branches: merge, rebase or rebase-update-refs. Defaults to the restackStrategy setting",
+	)
+}
+
+// getRestackStrategy returns the strategy given on the command line if any,
+// else the one configured for the repo.
+func getRestackStrategy(cfg *config.Config, flag string) (restackStrategy, error) {
+	value := flag
+	if value == "" {
+		value = cfg.RestackStrategy
+	}
+	if value == "" {
+		return restackStrategyMerge, nil
+	}
+	for _, strategy := range restackStrategies {
+		if string(strategy) == value {
+			return strategy, nil
+		}
+	}
+	return "", fmt.Errorf(
+		"unknown restack strategy %q. expected merge, rebase or rebase-update-refs",
+		value,
+	)
+}
+
+// rewritesHistory returns true if the strategy rewrites the commits of the restacked branches,
+// which then need to be force pushed.
+func (s restackStrategy) rewritesHistory() bool {
+	return s != restackStrategyMerge
+}
+
+// getRestackSteps returns the steps that restack the node and its descendants onto the given branch.
+// oldBaseCommitHash is the commit that the node is currently based on.
+func getRestackSteps(
+	strategy restackStrategy,
+	node *git.TreeNode,
+	ontoBranch string,
+	oldBaseCommitHash string,
+) ([]restackStep, error) {
+	branchNames := node.CommitMetadata.CleanedBranchNames()
+	if len(branchNames) == 0 {
+		return nil, fmt.Errorf("expected branch names on commit %s", node.CommitMetadata.CommitHash)
+	}
+
+	switch strategy {
+	case restackStrategyMerge:
+		mergeArgs, err := getMergeArgs(node)
+		if err != nil {
+			return nil, err
+		}
+		mergeArgs = append(
+			[]mergeArg{{branchToMerge: ontoBranch, branchToReceiveMerge: branchNames[0]}},
+			mergeArgs...,
+		)
+		return mergeSteps(mergeArgs), nil
+	case restackStrategyRebase:
+		steps := []restackStep{{
+			Kind:                restackStepRebase,
+			Branch:              branchNames[0],
+			Parent:              ontoBranch,
+			OldParentCommitHash: oldBaseCommitHash,
+		}}
+		for _, child := range sortedChildren(node) {
+			childSteps, err := getRestackSteps(strategy, child, branchNames[0], child.BaseCommitHash())
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, childSteps...)
+		}
+		return steps, nil
+	case restackStrategyRebaseUpdateRefs:
+		// The first child that is based on the tip of the node is rebased along with it.
+		// The other children are rebased onto the node once it moved.
+		var steps []restackStep
+		var inlineChild *git.TreeNode
+		for _, child := range sortedChildren(node) {
+			if inlineChild == nil && !child.IsStale() {
+				inlineChild = child
+				continue
+			}
+			childSteps, err := getRestackSteps(strategy, child, branchNames[0], child.BaseCommitHash())
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, childSteps...)
+		}
+		if inlineChild == nil {
+			return append([]restackStep{{
+				Kind:                restackStepRebase,
+				Branch:              branchNames[0],
+				Parent:              ontoBranch,
+				OldParentCommitHash: oldBaseCommitHash,
+				UpdateRefs:          true,
+			}}, steps...), nil
+		}
+		inlineSteps, err := getRestackSteps(strategy, inlineChild, ontoBranch, oldBaseCommitHash)
+		if err != nil {
+			return nil, err
+		}
+		return append(inlineSteps, steps...), nil
+	default:
+		return nil, fmt.Errorf("unknown restack strategy %q", strategy)
+	}
+}
+
+// getDescendantRestackSteps returns the steps that restack the descendants of the node onto it once it changed.
+// Must be called before the node changes.
+func getDescendantRestackSteps(strategy restackStrategy, node *git.TreeNode) ([]restackStep, error) {
+	branchNames := node.CommitMetadata.CleanedBranchNames()
+	if len(branchNames) == 0 {
+		return nil, fmt.Errorf("expected branch names on commit %s", node.CommitMetadata.CommitHash)
+	}
+	var steps []restackStep
+	for _, child := range sortedChildren(node) {
+		childSteps, err := getRestackSteps(strategy, child, branchNames[0], child.BaseCommitHash())
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, childSteps...)
+	}
+	return steps, nil
+}
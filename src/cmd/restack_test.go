@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestRestack_afterCommitWithPlainGit(t *testing.T) {
+	for _, strategy := range restackStrategies {
+		t.Run(string(strategy), func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			repo := testutil.NewRepo(t)
+			repo.CreateBranch("a")
+			repo.CommitFile("a.txt", "a\n", "a1")
+			repo.CreateBranch("b")
+			repo.CommitFile("b.txt", "b\n", "b1")
+			repo.CreateBranch("c")
+			repo.CommitFile("c.txt", "c\n", "c1")
+			g.Expect(runHg("sl")).To(Succeed())
+			repo.Checkout("a")
+			repo.CommitFile("a.txt", "a2\n", "a2")
+
+			out, err := runHgAndCaptureOutput(t, "sl")
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(out).To(MatchRegexp(`\(b\) \(stale\)`))
+			g.Expect(out).ToNot(MatchRegexp(`\(c\) \(stale\)`))
+
+			g.Expect(runHg("restack", "--strategy", string(strategy))).To(Succeed())
+
+			g.Expect(repo.CurrentBranch()).To(Equal("a"))
+			g.Expect(repo.IsAncestor("a", "b")).To(BeTrue())
+			g.Expect(repo.IsAncestor("b", "c")).To(BeTrue())
+			repo.Checkout("c")
+			g.Expect(repo.ReadFile("a.txt")).To(Equal("a2\n"))
+			out, err = runHgAndCaptureOutput(t, "sl")
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(out).ToNot(ContainSubstring("(stale)"))
+		})
+	}
+}
+
+func TestRestack_onlyCurrentStackWithoutAll(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.Checkout("main")
+	repo.CreateBranch("x")
+	repo.CommitFile("x.txt", "x\n", "x1")
+	repo.CreateBranch("y")
+	repo.CommitFile("y.txt", "y\n", "y1")
+	g.Expect(runHg("sl")).To(Succeed())
+	repo.Checkout("a")
+	repo.CommitFile("a.txt", "a2\n", "a2")
+	repo.Checkout("x")
+	repo.CommitFile("x.txt", "x2\n", "x2")
+
+	g.Expect(runHg("restack")).To(Succeed())
+	g.Expect(repo.IsAncestor("x", "y")).To(BeTrue())
+	g.Expect(repo.IsAncestor("a", "b")).To(BeFalse())
+
+	g.Expect(runHg("restack", "--all")).To(Succeed())
+	g.Expect(repo.IsAncestor("a", "b")).To(BeTrue())
+}
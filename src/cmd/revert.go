@@ -17,7 +17,7 @@ func newRevertCmd() *cobra.Command {
 	var cmd = &cobra.Command{
 		Use:   "revert [-r rev] <filepath>...",
 		Short: "Revert file(s) to a given revision.",
-		Long:  "Revert file(s) to a given revision. When specifying .^ as the revision, file(s) will be reverted to their state in the parent branch (not parent commit).",
+		Long:  "Revert file(s) to a given revision, which can be a revset matching a single commit. When specifying .^ as the revision, file(s) will be reverted to their state in the parent branch (not parent commit).",
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(_ *cobra.Command, args []string) error {
 			return runRevert(args, rev)
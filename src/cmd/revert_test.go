@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestRevert_gitAncestorOfBranchTip(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a1\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("a.txt", "b1\n", "b1")
+	repo.CommitFile("a.txt", "b2\n", "b2")
+
+	// HEAD~1 is the previous commit of the branch, not the tip of the parent branch.
+	g.Expect(runHg("revert", "-r", "HEAD~1", "a.txt")).To(Succeed())
+	g.Expect(repo.ReadFile("a.txt")).To(Equal("b1\n"))
+
+	g.Expect(runHg("revert", "-r", "b~2", "a.txt")).To(Succeed())
+	g.Expect(repo.ReadFile("a.txt")).To(Equal("a1\n"))
+
+	// .^ is still the parent branch.
+	g.Expect(runHg("revert", "a.txt")).To(Succeed())
+	g.Expect(runHg("revert", "-r", ".^", "a.txt")).To(Succeed())
+	g.Expect(repo.ReadFile("a.txt")).To(Equal("a1\n"))
+}
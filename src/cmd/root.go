@@ -9,19 +9,54 @@ import (
 )
 
 func Execute() {
+	err := newRootCmd().Execute()
+	stopDryRun()
+	if recordErr := stopRecording(); recordErr != nil && err == nil {
+		err = recordErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, color.RedString("error: %s", err))
+		os.Exit(1)
+	}
+}
+
+func newRootCmd() *cobra.Command {
+	var recordPath string
+	var dryRunFlag bool
 	rootCmd := &cobra.Command{
 		Use:   "hg",
 		Short: "hg is a set of commands for emulating a subset of Mercurial commands on a Git repository, as well as interacting with GitHub Pull Requests.",
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			if recordPath != "" {
+				startRecording(recordPath)
+			}
+			if dryRunFlag {
+				startDryRun()
+			}
+			return loadConfig(cmd)
+		},
 	}
+	rootCmd.PersistentFlags().
+		StringVar(&recordPath, "record", "", "Record the commands run and their output to the given JSON file, for use as test fixtures")
+	_ = rootCmd.PersistentFlags().MarkHidden("record")
+	rootCmd.PersistentFlags().
+		BoolVar(&dryRunFlag, "dry-run", false, "Print the mutating git and gh commands and the restack plan instead of running them")
 	rootCmd.AddCommand(
+		newAbsorbCmd(),
 		newAddCmd(),
 		newAmendCmd(),
 		newBookmarkCmd(),
 		newCleanupCmd(),
 		newCommitCmd(),
+		newConfigCmd(),
 		newDiffCmd(),
 		newEditCmd(),
+		newFoldCmd(),
+		newHisteditCmd(),
+		newLandCmd(),
+		newLogCmd(),
 		newNextCmd(),
+		newOplogCmd(),
 		newPatchCmd(),
 		newPrevCmd(),
 		newPrgetCmd(),
@@ -30,17 +65,19 @@ func Execute() {
 		newPrsyncCmd(),
 		newPullCmd(),
 		newRebaseCmd(),
+		newRedoCmd(),
+		newRestackCmd(),
 		newRevertCmd(),
 		newTopCmd(),
 		newSmartlogCmd(),
+		newSplitCmd(),
 		newSquashCmd(),
+		newStackCmd(),
 		newStatusCmd(),
 		newSubmitCmd(),
 		newUncommitCmd(),
+		newUndoCmd(),
 		newUpdateCmd(),
 	)
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, color.RedString("error: %s", err))
-		os.Exit(1)
-	}
+	return rootCmd
 }
@@ -2,10 +2,13 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"sort"
 	"time"
 
+	"github.com/yapaluc/hg-git/src/config"
 	"github.com/yapaluc/hg-git/src/git"
+	"github.com/yapaluc/hg-git/src/github"
 	"github.com/yapaluc/hg-git/src/util"
 
 	"github.com/fatih/color"
@@ -15,21 +18,26 @@ import (
 
 func newSmartlogCmd() *cobra.Command {
 	var showTime bool
+	var asJSON bool
+	var showPRStatus bool
 	var cmd = &cobra.Command{
-		Use:     "smartlog [-t time]",
+		Use:     "smartlog [-t time] [--json] [--pr]",
 		Short:   "Displays a smartlog: a sparse graph of commits relevant to you.",
 		Long:    "Displays a smartlog of branches: a sparse graph of commits relevant to you. Branches are collapsed into single entries in the graph. Similar to `git log --branches --graph --decorate --oneline --simplify-by-decoration --decorate-refs-exclude='tags/*'`.",
 		Aliases: []string{"sl"},
 		Args:    cobra.NoArgs,
-		RunE: func(_ *cobra.Command, args []string) error {
-			return runSmartlog(args, showTime)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSmartlog(getConfig(cmd), args, showTime, asJSON, showPRStatus)
 		},
 	}
 	cmd.Flags().BoolVarP(&showTime, "time", "t", false, "Show time taken")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the graph as JSON")
+	cmd.Flags().
+		BoolVar(&showPRStatus, "pr", false, "Fetch and show the review, CI and merge status of the PRs of draft branches")
 	return cmd
 }
 
-func runSmartlog(_ []string, showTime bool) error {
+func runSmartlog(cfg *config.Config, _ []string, showTime bool, asJSON bool, showPRStatus bool) error {
 	startTime := time.Now()
 	repoData, err := git.NewRepoData(
 		git.RepoDataIncludeCommitMetadata,
@@ -38,12 +46,24 @@ func runSmartlog(_ []string, showTime bool) error {
 	if err != nil {
 		return err
 	}
+	if asJSON {
+		return printSmartlogJSON(cfg, repoData, sortedChildren, maps.Values(repoData.CommitHashToNode))
+	}
 	currBranch, err := git.GetCurrentBranch()
 	if err != nil {
 		return err
 	}
+	var prStatuses map[int]*github.PRStatus
+	if showPRStatus {
+		prStatuses, err = fetchPRStatuses(cfg, maps.Values(repoData.CommitHashToNode))
+		if err != nil {
+			// The graph is still useful without the statuses, e.g. when offline.
+			fmt.Fprintln(os.Stderr, color.YellowString("Could not fetch the PR statuses: %s", err))
+			prStatuses = nil
+		}
+	}
 	// TODO: show commit even if head has no branch
-	err = printNodeChildren(currBranch, repoData.BranchRootNode, "" /* prefix */)
+	err = printNodeChildren(currBranch, prStatuses, repoData.BranchRootNode, "" /* prefix */)
 	if err != nil {
 		return err
 	}
@@ -55,64 +75,24 @@ func runSmartlog(_ []string, showTime bool) error {
 	return nil
 }
 
-// Adapted from https://github.com/reydanro/git-smartlog
 // TODO: reverse the smartlog
-func printNodeChildren(currBranch string, node *git.TreeNode, prefix string) error {
-	mainGraphConnector := ""
-	children := sortedChildren(node)
-	for i, child := range children {
-		newPrefix := prefix + mainGraphConnector
-		if i > 0 {
-			newPrefix += " "
-		}
-		err := printNodeChildren(currBranch, child, newPrefix)
-		if err != nil {
-			return fmt.Errorf("printing node children: %w", err)
-		}
-
-		summary, err := getNodeSummary(child, currBranch)
-		if err != nil {
-			return fmt.Errorf("getting node summary: %w", err)
-		}
-
-		// First line
-		var bullet string
-		if child.CommitMetadata.IsHead {
-			bullet = "*"
-		} else {
-			bullet = "o"
-		}
-		var graph string
-		if i == 0 {
-			graph = mainGraphConnector + bullet
-		} else {
-			graph = mainGraphConnector + " " + bullet
-		}
-		fmt.Println(prefix + graph + " " + summary)
-
-		// Update the connector character. Use ":" if parent is the root node.
-		graphConnector := "|"
-		if node.CommitMetadata == nil {
-			graphConnector = ":"
-		}
-		if i == 0 {
-			mainGraphConnector = graphConnector
-		}
-
-		// Update the connector character.
-		if i > 0 {
-			mainGraphConnector = graphConnector
-		}
-
-		// Spacing to parent node
-		if i == 0 {
-			graph = mainGraphConnector
-		} else {
-			graph = mainGraphConnector + "/ "
-		}
-		fmt.Println(prefix + graph)
+func printNodeChildren(
+	currBranch string,
+	prStatuses map[int]*github.PRStatus,
+	node *git.TreeNode,
+	prefix string,
+) error {
+	renderer := &graphRenderer{
+		children: sortedChildren,
+		render: func(node *git.TreeNode) ([]string, error) {
+			summary, err := getNodeSummary(node, currBranch, prStatuses)
+			if err != nil {
+				return nil, fmt.Errorf("getting node summary: %w", err)
+			}
+			return []string{summary}, nil
+		},
 	}
-	return nil
+	return renderer.printChildren(node, prefix)
 }
 
 // Sort children by commit time.
@@ -120,6 +100,12 @@ func printNodeChildren(currBranch string, node *git.TreeNode, prefix string) err
 func sortedChildren(node *git.TreeNode) []*git.TreeNode {
 	children := make([]*git.TreeNode, len(node.BranchChildren))
 	copy(children, maps.Values(node.BranchChildren))
+	sortSiblings(children)
+	return children
+}
+
+// Sorts sibling nodes in the order in which they are drawn in a graph.
+func sortSiblings(children []*git.TreeNode) {
 	sort.Slice(children, func(i, j int) bool {
 		if children[i].CommitMetadata.IsMaster {
 			// Master should appear at depth 0.
@@ -140,10 +126,14 @@ func sortedChildren(node *git.TreeNode) []*git.TreeNode {
 		}
 		return children[i].CommitMetadata.Timestamp < children[j].CommitMetadata.Timestamp
 	})
-	return children
 }
 
-func getNodeSummary(node *git.TreeNode, currBranch string) (string, error) {
+// PR statuses are shown if present in the given map, which may be nil.
+func getNodeSummary(
+	node *git.TreeNode,
+	currBranch string,
+	prStatuses map[int]*github.PRStatus,
+) (string, error) {
 	commitMetadata := node.CommitMetadata
 	if commitMetadata == nil {
 		return "", fmt.Errorf("missing CommitMetadata")
@@ -177,6 +167,14 @@ func getNodeSummary(node *git.TreeNode, currBranch string) (string, error) {
 	prURL, prURLText := commitMetadata.PRURL()
 	if prURL != "" && prURLText != "" {
 		line += color.New(color.Bold).Sprintf("%s ", util.Linkify(prURLText, prURL))
+		if status, ok := prStatuses[github.PRNumFromPRURL(prURL)]; ok {
+			if glyphs := renderPRStatus(status); glyphs != "" {
+				line += glyphs + " "
+			}
+		}
+	}
+	if node.IsStale() {
+		line += color.RedString("(stale) ")
 	}
 	line += color.BlueString(renderRelativeTime(commitMetadata.Timestamp))
 
@@ -191,6 +189,62 @@ func getNodeSummary(node *git.TreeNode, currBranch string) (string, error) {
 	return line, nil
 }
 
+// Fetches the status of the PRs of the draft nodes in a single request.
+// Public nodes are skipped since their PRs are merged.
+func fetchPRStatuses(cfg *config.Config, nodes []*git.TreeNode) (map[int]*github.PRStatus, error) {
+	var prNums []int
+	for _, node := range nodes {
+		if node.CommitMetadata.IsAncestorOfMaster() {
+			continue
+		}
+		if prURL, _ := node.CommitMetadata.PRURL(); prURL != "" {
+			prNums = append(prNums, github.PRNumFromPRURL(prURL))
+		}
+	}
+	if len(prNums) == 0 {
+		return nil, nil
+	}
+	sort.Ints(prNums)
+	client, err := newGitHubClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := client.FetchPRStatuses(prNums)
+	if err != nil {
+		return nil, fmt.Errorf("fetching PR statuses: %w", err)
+	}
+	return statuses, nil
+}
+
+// Renders the status of a PR as compact glyphs, in order: draft, review, checks and conflicts.
+// Statuses that need no attention, such as no review required, are not shown.
+func renderPRStatus(status *github.PRStatus) string {
+	var glyphs string
+	if status.IsDraft {
+		glyphs += color.New(color.Faint).Sprint("◌")
+	}
+	switch status.ReviewDecision {
+	case "APPROVED":
+		glyphs += color.GreenString("★")
+	case "CHANGES_REQUESTED":
+		glyphs += color.RedString("✎")
+	case "REVIEW_REQUIRED":
+		glyphs += color.YellowString("◷")
+	}
+	switch status.CheckState {
+	case "SUCCESS":
+		glyphs += color.GreenString("✓")
+	case "FAILURE", "ERROR":
+		glyphs += color.RedString("✗")
+	case "PENDING", "EXPECTED":
+		glyphs += color.YellowString("●")
+	}
+	if status.Mergeable == "CONFLICTING" {
+		glyphs += color.RedString("⚠")
+	}
+	return glyphs
+}
+
 func renderRelativeTime(timestamp int64) string {
 	duration := int64(time.Since(time.Unix(timestamp, 0)).Seconds())
 	if duration < 60 {
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/yapaluc/hg-git/src/config"
+	"github.com/yapaluc/hg-git/src/git"
+	"github.com/yapaluc/hg-git/src/github"
+
+	"github.com/fatih/color"
+)
+
+// Version of the JSON schema of `hg smartlog --json` and `hg stack --json`, documented in the README.
+// Bumped on incompatible changes only: fields may be added without bumping it.
+const smartlogJSONVersion = 1
+
+type smartlogJSON struct {
+	Version      int    `json:"version"`
+	MasterBranch string `json:"masterBranch"`
+	// Empty if HEAD is detached.
+	CurrentBranch string `json:"currentBranch"`
+	Head          string `json:"head"`
+	// The nodes without a parent in the output, each with its descendants.
+	Roots []*smartlogJSONNode `json:"roots"`
+}
+
+type smartlogJSONNode struct {
+	CommitHash      string   `json:"commitHash"`
+	ShortCommitHash string   `json:"shortCommitHash"`
+	BranchNames     []string `json:"branchNames"`
+	Author          string   `json:"author"`
+	Timestamp       int64    `json:"timestamp"`
+	// Title of the commit, regardless of the branch description.
+	Title    string `json:"title"`
+	IsHead   bool   `json:"isHead"`
+	IsMaster bool   `json:"isMaster"`
+	// True if the commit is master or one of its ancestors.
+	IsPublic bool `json:"isPublic"`
+	// Commit hash of the parent in the branch graph, or null for the bottom of the graph.
+	Parent *string `json:"parent"`
+	// True if the parent moved without the branch, which needs to be restacked with `hg restack`.
+	IsStale     bool                     `json:"isStale"`
+	Children    []*smartlogJSONNode      `json:"children"`
+	Description *smartlogJSONDescription `json:"description"`
+	PR          *smartlogJSONPR          `json:"pr"`
+}
+
+type smartlogJSONDescription struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+type smartlogJSONPR struct {
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+	// OPEN, CLOSED or MERGED, or empty if the PR could not be found or fetched.
+	State string `json:"state"`
+}
+
+// Prints the tree below the root node as JSON, with the children of each node given by the function.
+// The PRs of the given nodes are fetched to report their state. If they cannot be fetched,
+// e.g. when offline, a warning is printed to stderr and the PR states are left empty.
+func printSmartlogJSON(
+	cfg *config.Config,
+	repoData *git.RepoData,
+	children func(node *git.TreeNode) []*git.TreeNode,
+	nodes []*git.TreeNode,
+) error {
+	currBranch, err := git.GetCurrentBranch()
+	if err != nil {
+		return err
+	}
+	head, err := git.ResolveRev("HEAD")
+	if err != nil {
+		return err
+	}
+	prs, err := fetchNodePRs(cfg, nodes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, color.YellowString("Could not fetch the PR states: %s", err))
+	}
+
+	var newNode func(node *git.TreeNode) *smartlogJSONNode
+	newNode = func(node *git.TreeNode) *smartlogJSONNode {
+		metadata := node.CommitMetadata
+		jsonNode := &smartlogJSONNode{
+			CommitHash:      metadata.CommitHash,
+			ShortCommitHash: metadata.ShortCommitHash,
+			BranchNames:     metadata.CleanedBranchNames(),
+			Author:          metadata.Author,
+			Timestamp:       metadata.Timestamp,
+			Title:           metadata.Title,
+			IsHead:          metadata.IsHead,
+			IsMaster:        metadata.IsMaster,
+			IsPublic:        metadata.IsAncestorOfMaster(),
+			IsStale:         node.IsStale(),
+			Children:        []*smartlogJSONNode{},
+		}
+		if jsonNode.BranchNames == nil {
+			jsonNode.BranchNames = []string{}
+		}
+		if node.BranchParent != nil && node.BranchParent != repoData.BranchRootNode {
+			jsonNode.Parent = &node.BranchParent.CommitMetadata.CommitHash
+		}
+		if metadata.BranchDescription != nil {
+			jsonNode.Description = &smartlogJSONDescription{
+				Title: metadata.BranchDescription.Title,
+				Body:  metadata.BranchDescription.Body,
+			}
+		}
+		if prURL, _ := metadata.PRURL(); prURL != "" {
+			prNum := github.PRNumFromPRURL(prURL)
+			jsonNode.PR = &smartlogJSONPR{Number: prNum, URL: prURL}
+			if pr, ok := prs[prNum]; ok {
+				jsonNode.PR.State = pr.State
+			}
+		}
+		for _, child := range children(node) {
+			jsonNode.Children = append(jsonNode.Children, newNode(child))
+		}
+		return jsonNode
+	}
+
+	out := &smartlogJSON{
+		Version:       smartlogJSONVersion,
+		MasterBranch:  repoData.MasterBranch,
+		CurrentBranch: currBranch,
+		Head:          head,
+		Roots:         []*smartlogJSONNode{},
+	}
+	for _, root := range children(repoData.BranchRootNode) {
+		out.Roots = append(out.Roots, newNode(root))
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(out)
+	if err != nil {
+		return fmt.Errorf("encoding JSON: %w", err)
+	}
+	return nil
+}
+
+// Fetches the PRs of the branch descriptions and commit titles of the nodes in a single request.
+// Returns nothing without calling GitHub if there are no PRs.
+func fetchNodePRs(cfg *config.Config, nodes []*git.TreeNode) (map[int]*github.PullRequest, error) {
+	var prNums []int
+	for _, node := range nodes {
+		if prURL, _ := node.CommitMetadata.PRURL(); prURL != "" {
+			prNums = append(prNums, github.PRNumFromPRURL(prURL))
+		}
+	}
+	if len(prNums) == 0 {
+		return nil, nil
+	}
+	client, err := newGitHubClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	_, prs, err := client.FetchPRs(nil, prNums)
+	if err != nil {
+		return nil, fmt.Errorf("fetching PRs: %w", err)
+	}
+	return prs, nil
+}
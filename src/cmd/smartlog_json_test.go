@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestSmartlogJSON(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	g.Expect(runHg("submit")).To(Succeed())
+	gh.MergePR(1)
+	repo.Checkout("main")
+	repo.CreateBranch("c")
+	repo.CommitFile("c.txt", "c\n", "c1")
+	repo.Checkout("b")
+
+	out, err := runHgAndCaptureOutput(t, "sl", "--json")
+	g.Expect(err).ToNot(HaveOccurred())
+	var smartlog smartlogJSON
+	g.Expect(json.Unmarshal([]byte(out), &smartlog)).To(Succeed())
+	g.Expect(smartlog.Version).To(Equal(1))
+	g.Expect(smartlog.MasterBranch).To(Equal("main"))
+	g.Expect(smartlog.CurrentBranch).To(Equal("b"))
+	g.Expect(smartlog.Head).To(Equal(repo.Hash("b")))
+	g.Expect(smartlog.Roots).To(HaveLen(1))
+	main := smartlog.Roots[0]
+	g.Expect(main.BranchNames).To(Equal([]string{"main"}))
+	g.Expect(main.IsMaster).To(BeTrue())
+	g.Expect(main.Parent).To(BeNil())
+	g.Expect(main.Children).To(HaveLen(2))
+	branchNames := func(node *smartlogJSONNode) []string { return node.BranchNames }
+	g.Expect(main.Children).To(ConsistOf(
+		WithTransform(branchNames, Equal([]string{"a"})),
+		WithTransform(branchNames, Equal([]string{"c"})),
+	))
+
+	out, err = runHgAndCaptureOutput(t, "stack", "--json")
+	g.Expect(err).ToNot(HaveOccurred())
+	var stack smartlogJSON
+	g.Expect(json.Unmarshal([]byte(out), &stack)).To(Succeed())
+	g.Expect(stack.Roots).To(HaveLen(1))
+	a := stack.Roots[0]
+	g.Expect(a.CommitHash).To(Equal(repo.Hash("a")))
+	g.Expect(*a.Parent).To(Equal(repo.Hash("main")))
+	g.Expect(a.Description).To(Equal(&smartlogJSONDescription{Title: "Title of a", Body: "Description of a"}))
+	g.Expect(a.PR).To(Equal(&smartlogJSONPR{Number: 1, URL: gh.PR(1).URL, State: "MERGED"}))
+	g.Expect(a.IsHead).To(BeFalse())
+	g.Expect(a.Children).To(HaveLen(1))
+	b := a.Children[0]
+	g.Expect(b.BranchNames).To(Equal([]string{"b"}))
+	g.Expect(*b.Parent).To(Equal(repo.Hash("a")))
+	g.Expect(b.PR.State).To(Equal("OPEN"))
+	g.Expect(b.IsHead).To(BeTrue())
+	g.Expect(b.IsPublic).To(BeFalse())
+	g.Expect(b.Children).To(BeEmpty())
+}
+
+func TestSmartlogJSON_githubUnavailable(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	dir := t.TempDir()
+	g.Expect(os.WriteFile(
+		filepath.Join(dir, "gh"),
+		[]byte("#!/bin/sh\necho 'error connecting to api.github.com' >&2\nexit 1\n"),
+		0o755,
+	)).To(Succeed())
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	prURL := testutil.FakeRepoURL + "/pull/1"
+	repo.SetBranchDescription("a", "Title of a", "Description of a\n\nPR: "+prURL)
+
+	for _, command := range []string{"sl", "stack"} {
+		out, err := runHgAndCaptureOutput(t, command, "--json")
+		g.Expect(err).ToNot(HaveOccurred())
+		var smartlog smartlogJSON
+		g.Expect(json.Unmarshal([]byte(out), &smartlog)).To(Succeed())
+		var a *smartlogJSONNode
+		if command == "sl" {
+			a = smartlog.Roots[0].Children[0]
+		} else {
+			a = smartlog.Roots[0]
+		}
+		g.Expect(a.BranchNames).To(Equal([]string{"a"}))
+		g.Expect(a.PR).To(Equal(&smartlogJSONPR{Number: 1, URL: prURL}))
+	}
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/github"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestSmartlog_prStatus(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	g.Expect(runHg("submit")).To(Succeed())
+	gh.SetPRStatus(github.PRStatus{Number: 1, ReviewDecision: "APPROVED", CheckState: "SUCCESS", Mergeable: "MERGEABLE"})
+	gh.SetPRStatus(github.PRStatus{Number: 2, IsDraft: true, CheckState: "FAILURE", Mergeable: "CONFLICTING"})
+
+	out, err := runHgAndCaptureOutput(t, "sl", "--pr")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(MatchRegexp(`\(a\) \S*#1\S* ★✓ \d+s Title of a`))
+	g.Expect(out).To(MatchRegexp(`\(b\) \S*#2\S* ◌✗⚠ \d+s Title of b`))
+
+	out, err = runHgAndCaptureOutput(t, "sl")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(MatchRegexp(`\(a\) \S*#1\S* \d+s Title of a`))
+}
+
+func TestSmartlog_prStatusGithubUnavailable(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	dir := t.TempDir()
+	g.Expect(os.WriteFile(
+		filepath.Join(dir, "gh"),
+		[]byte("#!/bin/sh\necho 'error connecting to api.github.com' >&2\nexit 1\n"),
+		0o755,
+	)).To(Succeed())
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.SetBranchDescription("a", "Title of a", "Description of a\n\nPR: "+testutil.FakeRepoURL+"/pull/1")
+
+	stderr, err := runHgAndCaptureStderr(t, "sl", "--pr")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(stderr).To(ContainSubstring("Could not fetch the PR statuses"))
+
+	out, err := runHgAndCaptureOutput(t, "sl", "--pr")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(MatchRegexp(`\(a\) \S*#1\S* \d+s Title of a`))
+}
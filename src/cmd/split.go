@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yapaluc/hg-git/src/config"
+	"github.com/yapaluc/hg-git/src/git"
+	"github.com/yapaluc/hg-git/src/shell"
+
+	"github.com/alessio/shellescape"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+const splitPatchFilePrefix = "SPLIT_PATCH_FILE_"
+
+func newSplitCmd() *cobra.Command {
+	var newBranchName string
+	var message string
+	var strategy string
+	var cont bool
+	var abort bool
+	var cmd = &cobra.Command{
+		Use:   "split [branch name] [-n new branch name] [-m message] | --continue | --abort",
+		Short: "Splits a branch into two stacked branches by selecting the changes to move to a new parent branch.",
+		Long: `Splits the given branch (defaults to the current branch) into two stacked branches.
+			The changes of the branch are presented hunk by hunk like with "git add -p". The selected hunks are committed on a new branch based on the parent of the branch, with its own branch description, and the rest stays on the branch.
+			The branch and its descendants are then restacked on the new branch with the restack strategy of the repo, or the one given with --strategy.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return recordOperation(func() error {
+				if cont {
+					return continueRestack()
+				}
+				if abort {
+					return abortRestack()
+				}
+				return runSplit(getConfig(cmd), args, newBranchName, message, strategy)
+			})
+		},
+	}
+	cmd.Flags().
+		StringVarP(&newBranchName, "name", "n", "", "Name of the new parent branch. Defaults to the name of the branch followed by \"-split\"")
+	cmd.Flags().
+		StringVarP(&message, "message", "m", "", "Message of the commit on the new branch. Defaults to \"split from <branch name>\"")
+	addRestackStrategyFlag(cmd, &strategy)
+	addRestackFlags(cmd, &cont, &abort)
+	for _, flag := range []string{"name", "message", "strategy"} {
+		cmd.MarkFlagsMutuallyExclusive("continue", flag)
+		cmd.MarkFlagsMutuallyExclusive("abort", flag)
+	}
+	return cmd
+}
+
+func runSplit(cfg *config.Config, args []string, newBranchName string, message string, strategyFlag string) error {
+	strategy, err := getRestackStrategy(cfg, strategyFlag)
+	if err != nil {
+		return err
+	}
+	out, err := shell.Run(shell.Opt{}, "git status --porcelain --untracked-files=no")
+	if err != nil {
+		return fmt.Errorf("checking for uncommitted changes: %w", err)
+	}
+	if strings.TrimSpace(out) != "" {
+		return fmt.Errorf("there are uncommitted changes. commit, stash or revert them before splitting")
+	}
+
+	repoData, err := git.NewRepoData(git.RepoDataIncludeCommitMetadata)
+	if err != nil {
+		return err
+	}
+	currBranch, err := git.GetCurrentBranch()
+	if err != nil {
+		return err
+	}
+	branchName := currBranch
+	if len(args) > 0 {
+		branchName = args[0]
+	}
+	node, ok := repoData.BranchNameToNode[branchName]
+	if !ok {
+		return fmt.Errorf("missing node for branch %q", branchName)
+	}
+	if node.CommitMetadata.IsEffectiveMaster() || node.BranchParent == nil {
+		return fmt.Errorf("branch %q is not part of a stack", branchName)
+	}
+	if newBranchName == "" {
+		newBranchName = branchName + "-split"
+	}
+	if message == "" {
+		message = fmt.Sprintf("split from %s", branchName)
+	}
+	_, err = shell.Run(
+		shell.Opt{},
+		fmt.Sprintf("git rev-parse --verify --quiet refs/heads/%s", shellescape.Quote(newBranchName)),
+	)
+	if err == nil {
+		return fmt.Errorf("branch %q already exists. pass -n to choose another name", newBranchName)
+	}
+
+	// The branch may not contain the latest commit of master, so its changes are taken from the merge base.
+	baseCommitHash, err := shell.Run(
+		shell.Opt{StripTrailingNewline: true},
+		fmt.Sprintf(
+			"git merge-base %s %s",
+			node.BranchParent.CommitMetadata.CommitHash,
+			node.CommitMetadata.CommitHash,
+		),
+	)
+	if err != nil {
+		return fmt.Errorf("finding the base of branch %q: %w", branchName, err)
+	}
+
+	// The branch is restacked on the new branch, then its descendants on the branch.
+	steps, err := getRestackSteps(strategy, node, newBranchName, baseCommitHash)
+	if err != nil {
+		return fmt.Errorf("finding restack order: %w", err)
+	}
+	plan, err := newRestackPlan(cfg, "split")
+	if err != nil {
+		return err
+	}
+	plan.Steps = steps
+	plan.BranchToCheckout = currBranch
+	if dryRun {
+		printDryRun(
+			"select the changes of %s to commit on new branch %s, based on %s",
+			branchName,
+			newBranchName,
+			baseCommitHash,
+		)
+		return executeRestack(plan)
+	}
+
+	err = commitSplitChanges(branchName, newBranchName, baseCommitHash, message)
+	if err != nil {
+		return err
+	}
+	err = editByBranchName(newBranchName)
+	if err != nil {
+		return fmt.Errorf("editing description of branch %q: %w", newBranchName, err)
+	}
+
+	err = executeRestack(plan)
+	if err != nil {
+		return fmt.Errorf("executing restack: %w", err)
+	}
+	return nil
+}
+
+// Creates the new branch at the base of the branch and commits the changes of the branch that the user selects.
+// The new branch is deleted and the original branch checked out again if the selection is empty or complete.
+func commitSplitChanges(branchName string, newBranchName string, baseCommitHash string, message string) error {
+	tmpFileName := fmt.Sprintf("%s%s_", splitPatchFilePrefix, branchName)
+	tmpFileName = strings.ReplaceAll(tmpFileName, string(os.PathSeparator), "-")
+	tmpFile, err := os.CreateTemp(os.TempDir(), tmpFileName)
+	if err != nil {
+		return fmt.Errorf("creating temp file for patch: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+	_, err = shell.Run(
+		shell.Opt{},
+		fmt.Sprintf(
+			"git diff --binary %s %s > %s",
+			baseCommitHash,
+			shellescape.Quote(branchName),
+			tmpFile.Name(),
+		),
+	)
+	if err != nil {
+		return fmt.Errorf("getting patch: %w", err)
+	}
+	// Files added by the branch are left untracked in the working copy if they are not selected.
+	addedFiles, err := shell.RunAndCollectLines(
+		shell.Opt{},
+		fmt.Sprintf(
+			"git diff --name-only --no-renames --diff-filter=A %s %s",
+			baseCommitHash,
+			shellescape.Quote(branchName),
+		),
+	)
+	if err != nil {
+		return fmt.Errorf("listing the files added by branch %q: %w", branchName, err)
+	}
+
+	quotedAddedFiles := strings.Join(
+		lo.Map(addedFiles, func(file string, _ int) string { return shellescape.Quote(file) }),
+		" ",
+	)
+
+	// `git apply` runs relative to the working directory.
+	// Run it relative to the root of the repo to ensure the patch created above is accepted.
+	cmdStr := fmt.Sprintf(
+		"git switch -q -c %s %s && cd $(git rev-parse --show-toplevel) && git apply %s",
+		shellescape.Quote(newBranchName),
+		baseCommitHash,
+		tmpFile.Name(),
+	)
+	if len(addedFiles) > 0 {
+		// New files are marked as intent-to-add so that `git add -p` presents them.
+		cmdStr += " && git add -N -- " + quotedAddedFiles
+	}
+	_, err = shell.Run(shell.Opt{StreamOutputToStdout: true, PrintCommand: true}, cmdStr)
+	if err != nil {
+		return fmt.Errorf("applying the changes of branch %q: %w", branchName, err)
+	}
+
+	selectionErr := selectSplitChanges(branchName)
+	if selectionErr == nil {
+		_, err = shell.Run(
+			shell.Opt{StreamOutputToStdout: true, PrintCommand: true},
+			fmt.Sprintf("git commit -q -m %s", shellescape.Quote(message)),
+		)
+		if err != nil {
+			return fmt.Errorf("committing the selected changes: %w", err)
+		}
+	}
+
+	// Discard the changes that were not selected.
+	cmdStr = "git reset -q --hard"
+	if len(addedFiles) > 0 {
+		cmdStr += " && cd $(git rev-parse --show-toplevel) && git clean -fq -- " + quotedAddedFiles
+	}
+	_, err = shell.Run(shell.Opt{StreamOutputToStdout: true, PrintCommand: true}, cmdStr)
+	if err != nil {
+		return fmt.Errorf("discarding the changes that were not selected: %w", err)
+	}
+	if selectionErr == nil {
+		return nil
+	}
+
+	_, err = shell.Run(
+		shell.Opt{StreamOutputToStdout: true, PrintCommand: true},
+		fmt.Sprintf("git switch -q %s", shellescape.Quote(branchName)),
+	)
+	if err != nil {
+		return fmt.Errorf("checking out branch %q: %w", branchName, err)
+	}
+	err = deleteBranches([]string{newBranchName})
+	if err != nil {
+		return fmt.Errorf("deleting branch %q: %w", newBranchName, err)
+	}
+	return selectionErr
+}
+
+// Lets the user stage the changes to move to the new branch.
+// Returns an error if nothing or everything is selected, since one of the branches would be empty.
+func selectSplitChanges(branchName string) error {
+	_, err := shell.Run(shell.Opt{Interactive: true}, "git add -p")
+	if err != nil {
+		return fmt.Errorf("selecting changes: %w", err)
+	}
+	_, err = shell.Run(shell.Opt{}, "git diff --cached --quiet")
+	if err == nil {
+		return fmt.Errorf("no changes selected")
+	}
+	_, err = shell.Run(shell.Opt{}, "git diff --quiet")
+	if err == nil {
+		return fmt.Errorf("all changes selected: nothing would be left on branch %q", branchName)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestSplit(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.WriteFile("a.txt", "a\n")
+	repo.WriteFile("b.txt", "b\n")
+	repo.Git("add", "--all")
+	repo.Git("commit", "-m", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("c.txt", "c\n", "b1")
+	repo.Checkout("a")
+	// Select the changes to a.txt but not to b.txt.
+	setStdin(t, "y\nn\n")
+
+	g.Expect(runHg("split", "-n", "a0", "-m", "first half")).To(Succeed())
+
+	g.Expect(repo.CurrentBranch()).To(Equal("a"))
+	g.Expect(repo.Git("log", "-1", "--format=%s", "a0")).To(Equal("first half"))
+	g.Expect(repo.Git("ls-tree", "--name-only", "a0")).To(Equal("README.md\na.txt"))
+	g.Expect(repo.Git("config", "branch.a0.description")).To(Equal("first half"))
+	g.Expect(repo.IsAncestor("main", "a0")).To(BeTrue())
+	g.Expect(repo.IsAncestor("a0", "a")).To(BeTrue())
+	g.Expect(repo.IsAncestor("a", "b")).To(BeTrue())
+	g.Expect(repo.Git("diff", "a0", "a", "--name-only")).To(Equal("b.txt"))
+	g.Expect(repo.Status()).To(BeEmpty())
+}
+
+func TestSplit_failsIfNothingIsSelected(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	aHash := repo.Hash("a")
+	setStdin(t, "n\n")
+
+	g.Expect(runHg("split")).To(MatchError(ContainSubstring("no changes selected")))
+
+	g.Expect(repo.CurrentBranch()).To(Equal("a"))
+	g.Expect(repo.Hash("a")).To(Equal(aHash))
+	g.Expect(repo.BranchExists("a-split")).To(BeFalse())
+	g.Expect(repo.Status()).To(BeEmpty())
+}
+
+// setStdin makes the given input available on stdin for interactive commands.
+func setStdin(t *testing.T, input string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdin")
+	err := os.WriteFile(path, []byte(input), 0o644)
+	if err != nil {
+		t.Fatalf("writing stdin: %s", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("opening stdin: %s", err)
+	}
+	stdin := os.Stdin
+	os.Stdin = file
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		file.Close()
+	})
+}
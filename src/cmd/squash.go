@@ -22,7 +22,9 @@ func newSquashCmd() *cobra.Command {
 		Args:    cobra.MaximumNArgs(1),
 		Aliases: []string{"sq"},
 		RunE: func(_ *cobra.Command, args []string) error {
-			return runSquash(args, force)
+			return recordOperation(func() error {
+				return runSquash(args, force)
+			})
 		},
 	}
 	cmd.Flags().
@@ -128,6 +130,16 @@ func runSquashOnBranch(repoData *git.RepoData, branchName string, force bool) er
 	if err != nil {
 		return fmt.Errorf("getting squash details: %w", err)
 	}
+	if dryRun {
+		printDryRun(
+			"squash %s: diff from %s committed onto %s with message %q",
+			branchName,
+			squashDetails.commitToCalculatePatchFrom,
+			squashDetails.revToPatchAt,
+			squashDetails.commitMessage,
+		)
+		return nil
+	}
 
 	// Prepare patch file.
 	tmpDir := os.TempDir()
@@ -154,17 +166,17 @@ func runSquashOnBranch(repoData *git.RepoData, branchName string, force bool) er
 		return fmt.Errorf("getting patch: %w", err)
 	}
 
-	// Checkout parent branch.
-	err = updateRev(squashDetails.branchNameToPatchAt, nil)
+	// Checkout parent branch, or the last pushed commit.
+	err = updateRev(squashDetails.revToPatchAt, nil)
 	if err != nil {
 		return fmt.Errorf(
-			"checking out parent branch %q: %w",
-			squashDetails.branchNameToPatchAt,
+			"checking out %q: %w",
+			squashDetails.revToPatchAt,
 			err,
 		)
 	}
 
-	// Recreate branch name at the parent.
+	// Recreate branch name at the parent, or the last pushed commit.
 	err = createBookmark(branchName, "")
 	if err != nil {
 		return fmt.Errorf("creating bookmark for branch %q at the parent: %w", branchName, err)
@@ -192,8 +204,9 @@ func runSquashOnBranch(repoData *git.RepoData, branchName string, force bool) er
 
 type squashDetails struct {
 	commitToCalculatePatchFrom string
-	branchNameToPatchAt        string
-	commitMessage              string
+	// Branch name or commit hash that the squashed commit is created on.
+	revToPatchAt  string
+	commitMessage string
 }
 
 func getSquashDetails(
@@ -208,92 +221,119 @@ func getSquashDetails(
 	}
 
 	parentBranchName := parentBranch.CommitMetadata.CleanedBranchNames()[0]
+	commitMessage := "unknown"
+	if node.CommitMetadata.BranchDescription != nil {
+		// Possible for there to be no branch description if none was yet.
+		commitMessage = node.CommitMetadata.BranchDescription.Title
+	}
+	wholeBranch := squashDetails{
+		commitToCalculatePatchFrom: node.BaseCommitHash(),
+		revToPatchAt:               parentBranchName,
+		commitMessage:              commitMessage,
+	}
 
-	originNode, ok := repoData.BranchNameToNode["origin/"+targetBranchName]
-	if !ok || force {
-		// If no origin/BRANCHNAME local branch, branch hasn't been pushed yet, so all commits on the branch are safe to squash.
-		commitToStartPatchAt := parentBranch.CommitMetadata.ShortCommitHash
-		commitMessage := "unknown"
-		if node.CommitMetadata.BranchDescription != nil {
-			// Possible for there to be no branch description if none was yet.
-			commitMessage = node.CommitMetadata.BranchDescription.Title
-		}
-		return squashDetails{
-			commitToCalculatePatchFrom: commitToStartPatchAt,
-			branchNameToPatchAt:        parentBranchName,
-			commitMessage:              commitMessage,
-		}, nil
-	}
-
-	if originNode.CommitMetadata.ShortCommitHash != node.CommitMetadata.ShortCommitHash {
-		_, err := shell.Run(
-			shell.Opt{},
-			fmt.Sprintf(
-				"git merge-base --is-ancestor %s %s",
-				originNode.CommitMetadata.ShortCommitHash,
-				node.CommitMetadata.ShortCommitHash,
-			),
+	originCommitHash := git.GetRemoteBranchCommitHash(targetBranchName)
+	if originCommitHash == "" || force {
+		// If there is no origin/BRANCHNAME remote branch, the branch hasn't been pushed yet, so all commits on the branch are safe to squash.
+		return wholeBranch, nil
+	}
+	if originCommitHash == node.CommitMetadata.CommitHash {
+		return squashDetails{}, fmt.Errorf(
+			"not squashing since all commits on the branch have already been pushed. pass -f to force a squash",
 		)
-		isOriginAncestorOfBranch := err == nil
-		result, err := shell.Run(
-			shell.Opt{},
-			fmt.Sprintf(
-				"git log --merges %s..%s",
-				originNode.CommitMetadata.ShortCommitHash,
-				node.CommitMetadata.ShortCommitHash,
-			),
+	}
+
+	lastPushedCommitHash, err := getLastPushedCommit(node, originCommitHash)
+	if err != nil {
+		return squashDetails{}, err
+	}
+	if lastPushedCommitHash == "" {
+		// None of the commits on the branch were pushed: there must have been a previous squash,
+		// so origin/BRANCHNAME can be ignored and we can squash the entire branch.
+		return wholeBranch, nil
+	}
+
+	result, err := shell.Run(
+		shell.Opt{},
+		fmt.Sprintf("git log --merges %s..%s", lastPushedCommitHash, node.CommitMetadata.CommitHash),
+	)
+	if err != nil {
+		return squashDetails{}, fmt.Errorf("calling git log to check for merge commits: %w", err)
+	}
+	if len(result) > 0 {
+		return squashDetails{}, fmt.Errorf(
+			"not squashing since there are merge commits on the branch after the commit has been pushed. pass -f to force a squash",
 		)
-		if err != nil {
-			return squashDetails{}, fmt.Errorf(
-				"calling git log to check for merge commits",
-			)
-		}
-		hasMergeCommits := len(result) > 0
+	}
 
-		if hasMergeCommits {
-			return squashDetails{}, fmt.Errorf(
-				"not squashing since there are merge commits on the branch after the commit has been pushed. pass -f to force a squash",
-			)
-		}
+	// The local commits that haven't been pushed yet are safe to squash on top of the pushed ones.
+	prettyFormat := "%s"
+	out, err := shell.Run(
+		shell.Opt{},
+		fmt.Sprintf(
+			"git log --pretty=format:%s --reverse %s..%s",
+			prettyFormat,
+			lastPushedCommitHash,
+			node.CommitMetadata.CommitHash,
+		),
+	)
+	if err != nil {
+		return squashDetails{}, fmt.Errorf("running git log: %w", err)
+	}
+	return squashDetails{
+		commitToCalculatePatchFrom: lastPushedCommitHash,
+		revToPatchAt:               lastPushedCommitHash,
+		commitMessage:              strings.TrimSpace(out),
+	}, nil
+}
 
-		if isOriginAncestorOfBranch {
-			// If origin/BRANCHNAME local branch does not point to BRANCHNAME and is an ancestor of BRANCHNAME,
-			// there are local commits that haven't been pushed yet that are safe to squash.
-			commitToStartPatchAt := originNode.CommitMetadata.ShortCommitHash
-			prettyFormat := "%s"
-			out, err := shell.Run(
-				shell.Opt{},
-				fmt.Sprintf(
-					"git log --pretty=format:%s --reverse %s..%s",
-					prettyFormat,
-					commitToStartPatchAt,
-					node.CommitMetadata.ShortCommitHash,
-				),
+// Returns the last commit of the branch that was pushed to origin/BRANCHNAME, or an empty string if none was.
+// Restacking with a rebase rewrites the pushed commits, which are then found by comparing their patches.
+func getLastPushedCommit(node *git.TreeNode, originCommitHash string) (string, error) {
+	isAncestor, err := git.IsAncestor(originCommitHash, node.CommitMetadata.CommitHash)
+	if err != nil {
+		return "", err
+	}
+	if isAncestor {
+		return originCommitHash, nil
+	}
+
+	// Format is "<+ or -> <commit hash>" for each commit of the branch, from oldest to newest,
+	// where "-" means that an equivalent commit was pushed.
+	lines, err := shell.RunAndCollectLines(
+		shell.Opt{},
+		fmt.Sprintf(
+			"git cherry %s %s %s",
+			originCommitHash,
+			node.CommitMetadata.CommitHash,
+			node.BaseCommitHash(),
+		),
+	)
+	if err != nil {
+		return "", fmt.Errorf("comparing the branch with the pushed commits: %w", err)
+	}
+	var lastPushedCommitHash string
+	var hasUnpushedCommit bool
+	for _, line := range lines {
+		sign, commitHash, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		if sign == "+" {
+			hasUnpushedCommit = true
+			continue
+		}
+		if hasUnpushedCommit {
+			return "", fmt.Errorf(
+				"not squashing since commits that have not been pushed come before commits that have been pushed. pass -f to force a squash",
 			)
-			if err != nil {
-				return squashDetails{}, fmt.Errorf("running git log: %w", err)
-			}
-			commitMessage := strings.TrimSpace(out)
-			return squashDetails{
-				commitToCalculatePatchFrom: commitToStartPatchAt,
-				branchNameToPatchAt:        parentBranchName,
-				commitMessage:              commitMessage,
-			}, nil
 		}
-		// If origin/BRANCHNAME local branch exists but is not an ancestor of BRANCHNAME,
-		// there must have been a previous squash so this origin/BRANCHNAME local branch can be ignored
-		// and we can squash the entire branch.
-		commitToStartPatchAt := parentBranch.CommitMetadata.ShortCommitHash
-		commitMessage := node.CommitMetadata.BranchDescription.Title
-		return squashDetails{
-			commitToCalculatePatchFrom: commitToStartPatchAt,
-			branchNameToPatchAt:        parentBranchName,
-			commitMessage:              commitMessage,
-		}, nil
-	}
-
-	// Else, all commits have been pushed, so it is not safe to squash.
-	return squashDetails{}, fmt.Errorf(
-		"not squashing since all commits on the branch have already been pushed. pass -f to force a squash",
-	)
+		lastPushedCommitHash = commitHash
+	}
+	if lastPushedCommitHash != "" && !hasUnpushedCommit {
+		return "", fmt.Errorf(
+			"not squashing since all commits on the branch have already been pushed. pass -f to force a squash",
+		)
+	}
+	return lastPushedCommitHash, nil
 }
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestSquash_unpushedBranch(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a1\n", "a1")
+	repo.CommitFile("a.txt", "a2\n", "a2")
+	tree := repo.Hash("a^{tree}")
+
+	g.Expect(runHg("squash")).To(Succeed())
+
+	g.Expect(repo.CurrentBranch()).To(Equal("a"))
+	g.Expect(repo.Hash("a^")).To(Equal(repo.Hash("main")))
+	g.Expect(repo.Hash("a^{tree}")).To(Equal(tree))
+	g.Expect(repo.Git("log", "-1", "--format=%s", "a")).To(Equal("Title of a"))
+}
+
+func TestSquash_refusesBranchWithDescendants(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a1\n", "a1")
+	repo.CommitFile("a.txt", "a2\n", "a2")
+	aHash := repo.Hash("a")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.Checkout("a")
+
+	g.Expect(runHg("squash")).To(MatchError(ContainSubstring("has descendant branches")))
+	g.Expect(repo.Hash("a")).To(Equal(aHash))
+}
+
+func TestSquash_keepsPushedCommitsRewrittenByRebase(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a1\n", "a1")
+	repo.Git("push", "-q", "origin", "a")
+	repo.Checkout("main")
+	repo.CommitFile("main.txt", "main\n", "main2")
+	repo.Git("rebase", "-q", "main", "a")
+	rebasedHash := repo.Hash("a")
+	repo.CommitFile("a.txt", "a2\n", "a2")
+	repo.CommitFile("a.txt", "a3\n", "a3")
+	tree := repo.Hash("a^{tree}")
+
+	g.Expect(runHg("squash")).To(Succeed())
+
+	g.Expect(repo.Hash("a^")).To(Equal(rebasedHash))
+	g.Expect(repo.Hash("a^{tree}")).To(Equal(tree))
+	g.Expect(repo.Git("log", "-1", "--format=%B", "a")).To(Equal("a2\na3"))
+}
+
+func TestSquash_refusesPushedBranch(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a1\n", "a1")
+	repo.CommitFile("a.txt", "a2\n", "a2")
+	repo.Git("push", "-q", "origin", "a")
+	aHash := repo.Hash("a")
+
+	g.Expect(runHg("squash")).To(MatchError(ContainSubstring("already been pushed")))
+	g.Expect(repo.Hash("a")).To(Equal(aHash))
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/yapaluc/hg-git/src/config"
+	"github.com/yapaluc/hg-git/src/git"
+
+	"github.com/spf13/cobra"
+)
+
+func newStackCmd() *cobra.Command {
+	var asJSON bool
+	var cmd = &cobra.Command{
+		Use:   "stack [--json]",
+		Short: "Displays the current stack: the draft branches above master that contain the current commit.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runStack(getConfig(cmd), asJSON)
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the stack as JSON")
+	return cmd
+}
+
+func runStack(cfg *config.Config, asJSON bool) error {
+	repoData, err := git.NewRepoData(
+		git.RepoDataIncludeCommitMetadata,
+		git.RepoDataIncludeBranchDescription,
+	)
+	if err != nil {
+		return err
+	}
+	commitHashes, err := repoData.EvalRevset("stack()")
+	if err != nil {
+		return err
+	}
+	var nodes []*git.TreeNode
+	for _, commitHash := range commitHashes {
+		nodes = append(nodes, repoData.CommitHashToNode[commitHash])
+	}
+	children := getLogGraphChildren(repoData, nodes)
+	if asJSON {
+		return printSmartlogJSON(cfg, repoData, children, nodes)
+	}
+
+	currBranch, err := git.GetCurrentBranch()
+	if err != nil {
+		return err
+	}
+	renderer := &graphRenderer{
+		children: children,
+		render: func(node *git.TreeNode) ([]string, error) {
+			summary, err := getNodeSummary(node, currBranch, nil /* prStatuses */)
+			if err != nil {
+				return nil, fmt.Errorf("getting node summary: %w", err)
+			}
+			return []string{summary}, nil
+		},
+	}
+	return renderer.printChildren(repoData.BranchRootNode, "")
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"golang.org/x/term"
+)
+
+// statusBoard displays one status line per item, updated concurrently.
+// On a terminal, the lines are redrawn in place with a spinner for items in progress.
+// Otherwise, each line is printed once when its item finishes.
+type statusBoard struct {
+	mu         sync.Mutex
+	rows       []*statusRow
+	isTerminal bool
+	drawnLines int
+	frame      int
+	stopCh     chan struct{}
+	stoppedCh  chan struct{}
+}
+
+type statusRow struct {
+	board    *statusBoard
+	prefix   string
+	text     string
+	finished bool
+}
+
+func newStatusBoard() *statusBoard {
+	return &statusBoard{
+		// Dry runs print in between the rows, which would garble redrawn rows.
+		isTerminal: term.IsTerminal(int(os.Stdout.Fd())) && !dryRun,
+		stopCh:     make(chan struct{}),
+		stoppedCh:  make(chan struct{}),
+	}
+}
+
+// addRow must be called before start.
+func (b *statusBoard) addRow(prefix string) *statusRow {
+	row := &statusRow{board: b, prefix: prefix, text: "waiting"}
+	b.rows = append(b.rows, row)
+	return row
+}
+
+func (b *statusBoard) start() {
+	if !b.isTerminal {
+		close(b.stoppedCh)
+		return
+	}
+	go func() {
+		defer close(b.stoppedCh)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			b.mu.Lock()
+			b.draw()
+			b.mu.Unlock()
+			select {
+			case <-b.stopCh:
+				b.mu.Lock()
+				b.draw()
+				b.mu.Unlock()
+				return
+			case <-ticker.C:
+				b.frame++
+			}
+		}
+	}()
+}
+
+func (b *statusBoard) stop() {
+	close(b.stopCh)
+	<-b.stoppedCh
+}
+
+// Must be called with the lock held.
+func (b *statusBoard) draw() {
+	var sb strings.Builder
+	if b.drawnLines > 0 {
+		// Move the cursor back to the first line.
+		fmt.Fprintf(&sb, "\033[%dA", b.drawnLines)
+	}
+	frames := spinner.CharSets[9]
+	for _, row := range b.rows {
+		// Clear the line before redrawing it.
+		sb.WriteString("\r\033[2K")
+		sb.WriteString(row.prefix)
+		if row.finished {
+			sb.WriteString(row.text)
+		} else {
+			fmt.Fprintf(&sb, "%s %s", frames[b.frame%len(frames)], row.text)
+		}
+		sb.WriteString("\n")
+	}
+	b.drawnLines = len(b.rows)
+	fmt.Print(sb.String())
+}
+
+// Sets the text of an item in progress.
+func (r *statusRow) set(text string) {
+	r.board.mu.Lock()
+	defer r.board.mu.Unlock()
+	if !r.finished {
+		r.text = text
+	}
+}
+
+// Sets the final text of an item.
+func (r *statusRow) finish(text string) {
+	r.board.mu.Lock()
+	defer r.board.mu.Unlock()
+	if r.finished {
+		return
+	}
+	r.text = text
+	r.finished = true
+	if !r.board.isTerminal {
+		fmt.Println(r.prefix + text)
+	}
+}
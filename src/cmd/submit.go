@@ -1,19 +1,20 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
-	"regexp"
+	"sort"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/samber/lo"
+	"github.com/yapaluc/hg-git/src/config"
 	"github.com/yapaluc/hg-git/src/git"
 	"github.com/yapaluc/hg-git/src/github"
 	"github.com/yapaluc/hg-git/src/shell"
 	"github.com/yapaluc/hg-git/src/util"
 
 	"github.com/alessio/shellescape"
-	"github.com/briandowns/spinner"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
@@ -21,24 +22,50 @@ import (
 func newSubmitCmd() *cobra.Command {
 	var draft bool
 	var force bool
+	var forceWithLease bool
 	var noVerify bool
 	var pushOnly bool
+	var atomic bool
+	var stack bool
 	var cmd = &cobra.Command{
-		Use:   "submit [-n draft]",
+		Use:   "submit [-n draft] [-s stack | branch...]",
 		Short: "Submits GitHub Pull Requests for the current stack (current branch and its ancestors).",
-		Args:  cobra.NoArgs,
-		RunE: func(_ *cobra.Command, args []string) error {
-			return runSubmit(submitCfg{
-				draft:    draft,
-				force:    force,
-				noVerify: noVerify,
-				pushOnly: pushOnly,
+		Long:  "Submits GitHub Pull Requests for the current stack (current branch and its ancestors). With branch arguments, submits the given branches and their ancestors instead. With --stack, submits the whole tree of branches containing the current branch, including its descendants and forks.",
+		Args:  cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if stack && len(args) > 0 {
+				return fmt.Errorf("branches cannot be given with --stack")
+			}
+			conf := getConfig(cmd)
+			if !cmd.Flags().Changed("draft") {
+				draft = conf.Draft
+			}
+			// Branches restacked by rewriting their history can only be pushed by force.
+			strategy, err := getRestackStrategy(conf, "")
+			if err != nil {
+				return err
+			}
+			return runSubmit(conf, args, stack, submitCfg{
+				draft:          draft,
+				force:          force,
+				forceWithLease: forceWithLease || strategy.rewritesHistory(),
+				noVerify:       noVerify,
+				pushOnly:       pushOnly,
+				atomic:         atomic,
+				remote:         conf.PushRemote,
+				pushesToFork:   conf.PushesToFork(),
 			})
 		},
 	}
-	cmd.Flags().BoolVarP(&draft, "draft", "n", false, "Create Pull Request as a draft")
+	cmd.Flags().BoolVarP(&draft, "draft", "n", false, "Create Pull Request as a draft. Defaults to the draft setting")
+	cmd.Flags().
+		BoolVarP(&stack, "stack", "s", false, "Submit the whole stack containing the current branch, including descendants")
 	cmd.Flags().BoolVarP(&force, "force", "f", false, "Force push")
+	cmd.Flags().
+		BoolVar(&forceWithLease, "force-with-lease", false, "Force push unless the remote branches changed since they were last fetched. The default if the restack strategy rewrites history")
 	cmd.Flags().BoolVar(&noVerify, "no-verify", false, "Bypass pre-push hooks")
+	cmd.Flags().
+		BoolVar(&atomic, "atomic", false, "Push all branches atomically: either all of them are updated on the remote or none")
 	cmd.Flags().
 		BoolVarP(&pushOnly, "push-only", "p", false, "Push branches only, do not create/manage Pull Requests")
 	return cmd
@@ -47,12 +74,17 @@ func newSubmitCmd() *cobra.Command {
 type submitCfg struct {
 	draft           bool
 	force           bool
+	forceWithLease  bool
 	noVerify        bool
 	pushOnly        bool
+	atomic          bool
+	remote          string
+	pushesToFork    bool
 	gitMasterBranch string
+	client          github.Client
 }
 
-func runSubmit(cfg submitCfg) error {
+func runSubmit(conf *config.Config, branches []string, wholeStack bool, cfg submitCfg) error {
 	repoData, err := git.NewRepoData(
 		git.RepoDataIncludeCommitMetadata,
 		git.RepoDataIncludeBranchDescription,
@@ -62,30 +94,75 @@ func runSubmit(cfg submitCfg) error {
 	}
 	cfg.gitMasterBranch = repoData.MasterBranch
 
-	currBranch, err := git.GetCurrentBranch()
+	client, err := newGitHubClient(conf)
 	if err != nil {
 		return err
 	}
+	prCache := newPRCache(client)
+	cfg.client = prCache
 
-	node, ok := repoData.BranchNameToNode[currBranch]
-	if !ok {
-		return fmt.Errorf("missing node for branch %q", currBranch)
+	if len(branches) == 0 {
+		currBranch, err := git.GetCurrentBranch()
+		if err != nil {
+			return err
+		}
+		branches = []string{currBranch}
+	}
+	var nodes []*git.TreeNode
+	for _, branch := range branches {
+		branchName, err := resolveRevToBranchName(branch)
+		if err != nil {
+			return err
+		}
+		node, ok := repoData.BranchNameToNode[branchName]
+		if !ok {
+			return fmt.Errorf("missing node for branch %q", branchName)
+		}
+		if wholeStack {
+			if node.CommitMetadata.IsEffectiveMaster() {
+				return fmt.Errorf("branch %q is not part of a stack", branchName)
+			}
+			nodes = append(nodes, getStackDescendants(node)...)
+		} else {
+			nodes = append(nodes, node)
+		}
 	}
 
-	stack, err := getStack(node)
+	stack, err := getStack(nodes)
 	if err != nil {
 		return fmt.Errorf("getting stack: %w", err)
 	}
 
-	// Process branches in reverse, starting from the root
-	for i := len(stack) - 1; i >= 0; i-- {
-		err := processBranch(cfg, stack[i])
+	if !cfg.pushOnly {
+		err = prefetchStackPRs(prCache, stack)
 		if err != nil {
-			return fmt.Errorf("processing branch %s: %w", stack[i].branchName, err)
+			// PRs are fetched one by one instead.
+			color.Yellow("Could not prefetch PRs: %s", err)
 		}
 	}
 
-	return nil
+	return runSubmitPipeline(cfg, stack)
+}
+
+// Fetches the PRs of the stack and the PRs they reference in two batched requests.
+func prefetchStackPRs(prCache *prCache, stack []*stackEntry) error {
+	var branchNames []string
+	var prNums []int
+	for _, stackEntry := range stack {
+		branchNames = append(branchNames, stackEntry.branchName)
+		// Children are linked as next PRs.
+		for _, child := range stackEntry.node.BranchChildren {
+			branchNames = append(branchNames, child.CommitMetadata.CleanedBranchNames()...)
+		}
+		if prURL, _ := stackEntry.node.CommitMetadata.PRURL(); prURL != "" {
+			prNums = append(prNums, github.PRNumFromPRURL(prURL))
+		}
+	}
+	err := prCache.prefetch(branchNames, prNums)
+	if err != nil {
+		return err
+	}
+	return prCache.prefetchReferenced()
 }
 
 type stackEntry struct {
@@ -93,15 +170,29 @@ type stackEntry struct {
 	node       *git.TreeNode
 }
 
-func getStack(node *git.TreeNode) ([]*stackEntry, error) {
-	var stack []*stackEntry
-	for node != nil {
-		if node.CommitMetadata.IsEffectiveMaster() {
-			break
+// Returns the given nodes and their ancestors up to master, ordered so that parents come before their children.
+func getStack(nodes []*git.TreeNode) ([]*stackEntry, error) {
+	included := make(map[*git.TreeNode]bool)
+	var roots []*git.TreeNode
+	for _, node := range nodes {
+		for ; !included[node] && !node.CommitMetadata.IsEffectiveMaster(); node = node.BranchParent {
+			included[node] = true
+			if node.BranchParent == nil || node.BranchParent.CommitMetadata.IsEffectiveMaster() {
+				roots = append(roots, node)
+				break
+			}
 		}
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].CommitMetadata.Timestamp < roots[j].CommitMetadata.Timestamp
+	})
+
+	var stack []*stackEntry
+	var dfs func(node *git.TreeNode) error
+	dfs = func(node *git.TreeNode) error {
 		branchNames := node.CommitMetadata.CleanedBranchNames()
 		if len(branchNames) > 1 {
-			return nil, fmt.Errorf(
+			return fmt.Errorf(
 				"multiple branch names for branch %q - there should only be one branch name for no ambiguity in pushing to remote",
 				node.CommitMetadata.ShortCommitHash,
 			)
@@ -110,47 +201,71 @@ func getStack(node *git.TreeNode) ([]*stackEntry, error) {
 			branchName: branchNames[0],
 			node:       node,
 		})
-		node = node.BranchParent
+		for _, child := range sortedChildren(node) {
+			if !included[child] {
+				continue
+			}
+			err := dfs(child)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, root := range roots {
+		err := dfs(root)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return stack, nil
 }
 
-func processBranch(cfg submitCfg, stackEntry *stackEntry) error {
-	sp := spinner.New(
-		spinner.CharSets[9],
-		100*time.Millisecond,
-		spinner.WithColor("reset"),
-	)
-	prefix := color.GreenString("%s: ", stackEntry.branchName)
-	sp.Prefix = prefix
-	sp.Suffix = " processing"
-	sp.Start()
-	defer sp.Stop()
+// Returns all the branches of the stack containing the node: the root of the stack and its descendants.
+func getStackDescendants(node *git.TreeNode) []*git.TreeNode {
+	for !node.BranchParent.CommitMetadata.IsEffectiveMaster() && node.BranchParent.BranchParent != nil {
+		node = node.BranchParent
+	}
+	var nodes []*git.TreeNode
+	var dfs func(node *git.TreeNode)
+	dfs = func(node *git.TreeNode) {
+		nodes = append(nodes, node)
+		for _, child := range node.BranchChildren {
+			dfs(child)
+		}
+	}
+	dfs(node)
+	return nodes
+}
 
+// Returns the final status of the branch if it should not be pushed nor have its PR updated.
+func getSkipStatus(cfg submitCfg, stackEntry *stackEntry) (string, error) {
 	if isPrIgnored(stackEntry.branchName) {
-		sp.FinalMSG = prefix + "(ignored)\n"
-		return nil
+		return "(ignored)", nil
 	}
 
 	// If this branch has already been merged, skip it.
-	prData, err := fetchPRFromBranchDescription(stackEntry.node)
+	prData, err := fetchPRFromBranchDescription(cfg.client, stackEntry.node)
 	if err != nil {
-		return fmt.Errorf(
+		return "", fmt.Errorf(
 			"fetching PR from branch description of branch %q: %w",
 			stackEntry.branchName,
 			err,
 		)
 	}
 	if prData != nil && prData.State == "MERGED" {
-		sp.FinalMSG = prefix + "(merged)\n"
-		return nil
-	}
-
-	wasPushed, err := pushBranch(stackEntry.branchName, cfg, sp)
-	if err != nil {
-		return fmt.Errorf("pushing branch %q: %w", stackEntry.branchName, err)
+		return "(merged)", nil
 	}
+	return "", nil
+}
 
+// Processes a branch that has been pushed. Returns the final status of the branch.
+func processBranch(
+	cfg submitCfg,
+	stackEntry *stackEntry,
+	wasPushed bool,
+	row *statusRow,
+) (string, error) {
 	if cfg.pushOnly {
 		var finalStatus status
 		if wasPushed {
@@ -164,22 +279,25 @@ func processBranch(cfg submitCfg, stackEntry *stackEntry) error {
 		if !parent.CommitMetadata.IsEffectiveMaster() {
 			parentBranch = parent.CommitMetadata.CleanedBranchNames()[0]
 		}
-		branchURL, err := github.BranchURLFromBranchName(stackEntry.branchName, parentBranch)
+		branchURL, err := github.BranchURLFromBranchName(
+			cfg.client,
+			stackEntry.branchName,
+			parentBranch,
+		)
 		if err != nil {
 			branchURL = ""
 		}
 		branchLink := util.Linkify(stackEntry.branchName, branchURL)
-		sp.FinalMSG = prefix + fmt.Sprintf(
-			"%s (%s)\n",
+		return fmt.Sprintf(
+			"%s (%s)",
 			color.New(color.Bold).Sprint(branchLink),
 			finalStatus.String(),
-		)
-		return nil
+		), nil
 	}
 
-	prURL, prStatus, err := createOrUpdatePR(cfg, stackEntry, sp)
+	prURL, prStatus, err := createOrUpdatePR(cfg, stackEntry, row)
 	if err != nil {
-		return fmt.Errorf("creating or updating PR for %q: %w", stackEntry.branchName, err)
+		return "", fmt.Errorf("creating or updating PR for %q: %w", stackEntry.branchName, err)
 	}
 
 	var finalStatus status
@@ -197,47 +315,96 @@ func processBranch(cfg submitCfg, stackEntry *stackEntry) error {
 	}
 
 	prLink := util.Linkify(github.PRStrFromPRURL(prURL), prURL)
-	sp.FinalMSG = prefix + fmt.Sprintf(
-		"%s (%s)\n",
+	if prURL == "" {
+		// Created in a dry run.
+		prLink = "new PR"
+	}
+	return fmt.Sprintf(
+		"%s (%s)",
 		color.New(color.Bold).Sprint(prLink),
 		finalStatus.String(),
-	)
-	return nil
+	), nil
 }
 
-func pushBranch(branchName string, cfg submitCfg, sp *spinner.Spinner) (bool, error) {
-	sp.Suffix = " pushing to remote"
-	var forceFlag string
+// Pushes all the branches with a single git push.
+// Returns whether each branch was updated on the remote, and the error of each branch that was rejected.
+func pushBranches(
+	cfg submitCfg,
+	branchNames []string,
+) (map[string]bool, map[string]error, error) {
+	if len(branchNames) == 0 {
+		return nil, nil, nil
+	}
+	var flags string
 	if cfg.force {
-		forceFlag = " -f"
+		flags += " -f"
+	} else if cfg.forceWithLease {
+		flags += " --force-with-lease"
 	}
-	var noVerifyFlag string
 	if cfg.noVerify {
-		noVerifyFlag = " --no-verify"
+		flags += " --no-verify"
 	}
+	if cfg.atomic {
+		flags += " --atomic"
+	}
+	if dryRun {
+		// Reports what would be pushed in the same format.
+		flags += " --dry-run"
+	}
+	quotedBranchNames := lo.Map(branchNames, func(branchName string, _ int) string {
+		return shellescape.Quote(branchName)
+	})
 	out, err := shell.Run(
 		shell.Opt{CombinedStdoutStderrOutput: true},
 		fmt.Sprintf(
-			"git push origin %s%s%s",
-			shellescape.Quote(branchName),
-			forceFlag,
-			noVerifyFlag,
+			"git push --porcelain%s %s %s",
+			flags,
+			shellescape.Quote(cfg.remote),
+			strings.Join(quotedBranchNames, " "),
 		),
 	)
-	if err != nil {
-		if strings.Contains(out, "(non-fast-forward)") {
-			return false, fmt.Errorf(
-				"running git push. you may want to pull the latest changes or rerun this command with -f/--force if you want to force push: %w",
-				err,
-			)
+
+	// Porcelain format is "<flag>\t<from>:<to>\t<summary>" for each ref.
+	// See https://git-scm.com/docs/git-push#_output
+	wasPushed := make(map[string]bool)
+	pushErrs := make(map[string]error)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || len(fields[0]) != 1 {
+			continue
+		}
+		from, _, _ := strings.Cut(fields[1], ":")
+		branchName, ok := strings.CutPrefix(from, "refs/heads/")
+		if !ok {
+			continue
+		}
+		summary := fields[2]
+		switch fields[0] {
+		case " ", "+", "*":
+			wasPushed[branchName] = true
+		case "=":
+			wasPushed[branchName] = false
+		case "!":
+			if strings.Contains(summary, "(stale info)") {
+				pushErrs[branchName] = fmt.Errorf(
+					"git push: %s. the remote branch changed since it was last fetched. you may want to pull the latest changes or rerun this command with -f/--force if you want to overwrite them",
+					summary,
+				)
+			} else if strings.Contains(summary, "(non-fast-forward)") || strings.Contains(summary, "(fetch first)") {
+				pushErrs[branchName] = fmt.Errorf(
+					"git push: %s. you may want to pull the latest changes or rerun this command with -f/--force if you want to force push",
+					summary,
+				)
+			} else {
+				pushErrs[branchName] = fmt.Errorf("git push: %s", summary)
+			}
 		}
-		return false, fmt.Errorf("running git push: %w: %s", err, out)
 	}
-
-	if strings.Contains(out, "Everything up-to-date") {
-		return false, nil
+	if err != nil && len(pushErrs) == 0 {
+		// The push failed as a whole, e.g. because of a pre-push hook or a network error.
+		return nil, nil, fmt.Errorf("running git push: %w: %s", err, out)
 	}
-	return true, nil
+	return wasPushed, pushErrs, nil
 }
 
 type status struct {
@@ -257,7 +424,7 @@ var statusCleanupNeeded = status{"cleanup needed"}
 func createOrUpdatePR(
 	cfg submitCfg,
 	stackEntry *stackEntry,
-	sp *spinner.Spinner,
+	row *statusRow,
 ) (string, status, error) {
 	parent := stackEntry.node.BranchParent
 	if parent == nil {
@@ -267,9 +434,9 @@ func createOrUpdatePR(
 	// Validate parent branch.
 	var parentPRData *github.PullRequest
 	if !parent.CommitMetadata.IsEffectiveMaster() {
-		sp.Suffix = " fetching parent PR"
+		row.set("fetching parent PR")
 		var err error
-		parentPRData, err = getPRDataForNode(parent)
+		parentPRData, err = getPRDataForNode(cfg.client, parent)
 		if err != nil {
 			return "", statusUnknown, fmt.Errorf(
 				"fetching PR data for parent branch of %q: %w",
@@ -279,8 +446,8 @@ func createOrUpdatePR(
 		}
 	}
 
-	sp.Suffix = " fetching current PR"
-	prData, err := github.FetchPRForBranch(stackEntry.branchName)
+	row.set("fetching current PR")
+	prData, err := cfg.client.FetchPRForBranch(stackEntry.branchName)
 	if err != nil {
 		return "", statusUnknown, fmt.Errorf(
 			"fetching PR data for branch %q: %w",
@@ -292,7 +459,7 @@ func createOrUpdatePR(
 	var prURL string
 	var status status
 	if prData == nil {
-		prURL, status, err = createPR(cfg, stackEntry, parentPRData, sp)
+		prURL, status, err = createPR(cfg, stackEntry, parentPRData, row)
 		if err != nil {
 			return "", statusUnknown, fmt.Errorf(
 				"creating PR for branch %q: %w",
@@ -301,22 +468,13 @@ func createOrUpdatePR(
 			)
 		}
 	} else {
-		prURL, status, err = updatePR(cfg, stackEntry, prData, parentPRData, sp)
+		prURL, status, err = updatePR(cfg, stackEntry, prData, parentPRData, row)
 		if err != nil {
 			return "", statusUnknown, fmt.Errorf("updating PR for branch %q: %w", stackEntry.branchName, err)
 		}
 	}
 
-	err = updateNextInParentPR(prURL, parentPRData, sp)
-	if err != nil {
-		return "", statusUnknown, fmt.Errorf(
-			"updating next in parent PR of %q: %w",
-			stackEntry.branchName,
-			err,
-		)
-	}
-
-	err = addPRURLToBranchDescription(stackEntry, prURL, sp)
+	err = addPRURLToBranchDescription(stackEntry, prURL, row)
 	if err != nil {
 		return "", statusUnknown, fmt.Errorf(
 			"adding PR URL to branch description of branch %q: %w",
@@ -332,9 +490,9 @@ func createPR(
 	cfg submitCfg,
 	stackEntry *stackEntry,
 	parentPRData *github.PullRequest,
-	sp *spinner.Spinner,
+	row *statusRow,
 ) (string, status, error) {
-	sp.Suffix = " creating PR"
+	row.set("creating PR")
 
 	commitMetadata := stackEntry.node.CommitMetadata
 	if commitMetadata.BranchDescription == nil {
@@ -352,26 +510,13 @@ func createPR(
 		PreviousPR:  parentPRNum,
 		Description: commitMetadata.BranchDescription.Body,
 	}
-	args := []string{
-		"--head",
-		stackEntry.branchName,
-		"--title",
-		shellescape.Quote(commitMetadata.BranchDescription.Title),
-		"--body",
-		shellescape.Quote(prBody.ToMarkdown()),
-	}
-	if parentPRData != nil {
-		args = append(args, "--base")
-		args = append(args, parentPRData.HeadRefName)
-	}
-	if cfg.draft {
-		args = append(args, "--draft")
-	}
-
-	prURL, err := shell.Run(
-		shell.Opt{StripTrailingNewline: true},
-		fmt.Sprintf("gh pr create %s", strings.Join(args, " ")),
-	)
+	prData, err := cfg.client.CreatePR(github.CreatePROpts{
+		Head:  stackEntry.branchName,
+		Base:  cfg.getPRBase(parentPRData),
+		Title: commitMetadata.BranchDescription.Title,
+		Body:  prBody.ToMarkdown(),
+		Draft: cfg.draft,
+	})
 	if err != nil {
 		return "", statusUnknown, fmt.Errorf(
 			"creating PR for branch %q: %w",
@@ -380,7 +525,17 @@ func createPR(
 		)
 	}
 
-	return prURL, statusCreated, nil
+	return prData.URL, statusCreated, nil
+}
+
+// Returns the base branch of a PR, given the PR of its parent branch if it has one.
+// PRs from a fork can only be based on branches of the upstream repo, so they are all based on master,
+// and the stack is only tracked in the PR bodies.
+func (cfg submitCfg) getPRBase(parentPRData *github.PullRequest) string {
+	if parentPRData == nil || cfg.pushesToFork {
+		return cfg.gitMasterBranch
+	}
+	return parentPRData.HeadRefName
 }
 
 func updatePR(
@@ -388,9 +543,9 @@ func updatePR(
 	stackEntry *stackEntry,
 	prData *github.PullRequest,
 	parentPRData *github.PullRequest,
-	sp *spinner.Spinner,
+	row *statusRow,
 ) (string, status, error) {
-	var args []string
+	var opts github.EditPROpts
 	commitMetadata := stackEntry.node.CommitMetadata
 	if commitMetadata.BranchDescription == nil {
 		return "", statusUnknown, fmt.Errorf(
@@ -398,21 +553,14 @@ func updatePR(
 			stackEntry.branchName,
 		)
 	}
-	var parentBranch string
-	if parentPRData == nil {
-		parentBranch = cfg.gitMasterBranch
-	} else {
-		parentBranch = parentPRData.HeadRefName
-	}
+	parentBranch := cfg.getPRBase(parentPRData)
 	if parentBranch != prData.BaseRefName {
-		args = append(args, "--base")
-		args = append(args, shellescape.Quote(parentBranch))
+		opts.Base = &parentBranch
 	}
 	if commitMetadata.BranchDescription.Title != prData.Title {
-		args = append(args, "--title")
-		args = append(args, shellescape.Quote(commitMetadata.BranchDescription.Title))
+		opts.Title = &commitMetadata.BranchDescription.Title
 	}
-	updatedPRBody, err := getUpdatedPRBody(stackEntry, prData, parentPRData)
+	updatedPRBody, err := getUpdatedPRBody(stackEntry, prData)
 	if err != nil {
 		return "", statusUnknown, fmt.Errorf(
 			"getting updated PR body for branch %q: %w",
@@ -421,27 +569,18 @@ func updatePR(
 		)
 	}
 	if updatedPRBody != prData.Body {
-		args = append(args, "--body")
-		args = append(args, shellescape.Quote(updatedPRBody))
+		opts.Body = &updatedPRBody
 	}
 
-	if len(args) == 0 {
+	if opts.Base == nil && opts.Title == nil && opts.Body == nil {
 		return prData.URL, statusSkipped, nil
 	}
 
-	sp.Suffix = " updating PR fields"
-	out, err := shell.Run(
-		shell.Opt{CombinedStdoutStderrOutput: true},
-		fmt.Sprintf(
-			"gh pr edit %s %s",
-			shellescape.Quote(stackEntry.branchName),
-			strings.Join(args, " "),
-		),
-	)
+	row.set("updating PR fields")
+	err = cfg.client.EditPR(prData.Number, opts)
 	if err != nil {
 		// Gracefully handle when the parent branch has been merged.
-		r := regexp.MustCompile("Proposed base branch '.+' was not found")
-		if r.MatchString(out) {
+		if errors.Is(err, github.ErrBaseBranchNotFound) {
 			return prData.URL, statusCleanupNeeded, nil
 		}
 		return "", statusUnknown, fmt.Errorf(
@@ -454,98 +593,237 @@ func updatePR(
 	return prData.URL, statusUpdated, nil
 }
 
-func getUpdatedPRBody(
-	stackEntry *stackEntry,
-	prData *github.PullRequest,
-	parentPRData *github.PullRequest,
-) (string, error) {
+// Updates the description of the PR body. The stack listing is updated once all the PRs exist.
+func getUpdatedPRBody(stackEntry *stackEntry, prData *github.PullRequest) (string, error) {
 	prBody, err := github.NewPrBody(prData.Body)
 	if err != nil {
 		return "", fmt.Errorf("parsing PR body of branch %q: %w", stackEntry.branchName, err)
 	}
-
 	prBody.Description = stackEntry.node.CommitMetadata.BranchDescription.Body
+	return prBody.ToMarkdown(), nil
+}
 
-	// If previous PR was merged, keep it. Else, replace it with the new previous URL.
-	var newPreviousPR int
-	if parentPRData != nil {
-		newPreviousPR = parentPRData.Number
-	}
-	if prBody.PreviousPR != 0 {
-		previousPRData, err := github.FetchPRByNum(prBody.PreviousPR)
-		if err != nil {
-			return "", fmt.Errorf("fetching previous PR at URL %q: %w", prBody.PreviousPR, err)
+// syncStackPRBodies updates the stack listing in the body of every open PR of the stacks
+// containing the submitted branches, including branches that were not submitted.
+// Returns the final status.
+func syncStackPRBodies(cfg submitCfg, stack []*stackEntry, row *statusRow) (string, error) {
+	row.set("fetching the PRs of the stack")
+	var roots []*git.TreeNode
+	var branchNames []string
+	var prNums []int
+	for _, stackEntry := range stack {
+		parent := stackEntry.node.BranchParent
+		if parent != nil && !parent.CommitMetadata.IsEffectiveMaster() {
+			continue
 		}
-		if previousPRData.State == "MERGED" {
-			newPreviousPR = prBody.PreviousPR
+		roots = append(roots, stackEntry.node)
+		for _, node := range getStackDescendants(stackEntry.node) {
+			branchNames = append(branchNames, node.CommitMetadata.CleanedBranchNames()[0])
+			if prURL, _ := node.CommitMetadata.PRURL(); prURL != "" {
+				prNums = append(prNums, github.PRNumFromPRURL(prURL))
+			}
 		}
 	}
-	prBody.PreviousPR = newPreviousPR
+	_, _, err := cfg.client.FetchPRs(branchNames, prNums)
+	if err != nil {
+		return "", fmt.Errorf("fetching PRs of the stack: %w", err)
+	}
 
-	// Remove "Next" PRs with a base branch not pointing to this branch.
-	var newNextPRs []int
-	for _, nextPR := range prBody.NextPRs {
-		nextPRData, err := github.FetchPRByNum(nextPR)
+	type prUpdate struct {
+		pr    *github.PullRequest
+		stack []github.PrStackItem
+	}
+	var updates []prUpdate
+	for _, root := range roots {
+		prStack, openPRs, err := getPRStack(cfg.client, root)
 		if err != nil {
-			return "", fmt.Errorf("fetching next PR at URL %q: %w", nextPR, err)
+			return "", err
+		}
+		if len(prStack) < 2 {
+			// A single PR is not a stack.
+			prStack = nil
 		}
-		if nextPRData.BaseRefName == stackEntry.branchName {
-			newNextPRs = append(newNextPRs, nextPR)
+		for _, pr := range openPRs {
+			updates = append(updates, prUpdate{pr: pr, stack: prStack})
 		}
 	}
-	prBody.NextPRs = newNextPRs
 
-	return prBody.ToMarkdown(), nil
+	row.set("updating the stack in PR bodies")
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	var numUpdated int
+	for _, update := range updates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			updated, err := updatePRStack(cfg.client, update.pr, update.stack)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("updating stack in PR %d: %w", update.pr.Number, err))
+			} else if updated {
+				numUpdated++
+			}
+		}()
+	}
+	wg.Wait()
+	if len(errs) != 0 {
+		return "", errors.Join(errs...)
+	}
+	if numUpdated == 0 {
+		return fmt.Sprintf("(%s)", statusSkipped), nil
+	}
+	return fmt.Sprintf("(%s)", statusUpdated), nil
 }
 
-func updateNextInParentPR(
-	prURL string,
-	parentPRData *github.PullRequest,
-	sp *spinner.Spinner,
-) error {
-	if parentPRData == nil {
+// Returns the stack listing of the tree rooted at the given node, preceded by its merged ancestors,
+// and the open PRs of the tree.
+func getPRStack(
+	client github.Client,
+	root *git.TreeNode,
+) ([]github.PrStackItem, []*github.PullRequest, error) {
+	var prStack []github.PrStackItem
+	var openPRs []*github.PullRequest
+	var dfs func(node *git.TreeNode, depth int) error
+	dfs = func(node *git.TreeNode, depth int) error {
+		branchName := node.CommitMetadata.CleanedBranchNames()[0]
+		if !isPrIgnored(branchName) {
+			pr, err := getPRForStack(client, node)
+			if err != nil {
+				return err
+			}
+			// Branches without a PR are left out and their children take their place.
+			// PRs created in a dry run do not exist, so they have no number yet.
+			if pr != nil && pr.Number != 0 {
+				prStack = append(prStack, github.PrStackItem{
+					PRNum:  pr.Number,
+					Depth:  depth,
+					Merged: pr.State == "MERGED",
+				})
+				if pr.State == "OPEN" {
+					openPRs = append(openPRs, pr)
+				}
+				depth++
+			}
+		}
+		for _, child := range sortedChildren(node) {
+			err := dfs(child, depth)
+			if err != nil {
+				return err
+			}
+		}
 		return nil
 	}
-	if isPrIgnored(parentPRData.HeadRefName) {
-		sp.Suffix = " ignoring parent PR for purposes of forward reference"
-		return nil
+	err := dfs(root, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(prStack) == 0 {
+		return nil, nil, nil
 	}
 
-	parentPrBody, err := github.NewPrBody(parentPRData.Body)
+	// Branches of merged PRs are deleted by cleanup, so their PRs are only known from the PR bodies.
+	rootPR, err := client.FetchPRByNum(prStack[0].PRNum)
 	if err != nil {
-		return fmt.Errorf("getting PR body of PR URL %q: %w", parentPRData.URL, err)
+		return nil, nil, fmt.Errorf("fetching PR %d: %w", prStack[0].PRNum, err)
 	}
-	prNum := github.PRNumFromPRURL(prURL)
-	if lo.Contains(parentPrBody.NextPRs, prNum) {
-		return nil
+	ancestors, err := getMergedAncestorPRs(client, rootPR)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting merged ancestors of PR %d: %w", rootPR.Number, err)
 	}
-	parentPrBody.NextPRs = append(parentPrBody.NextPRs, prNum)
+	for i := range prStack {
+		prStack[i].Depth += len(ancestors)
+	}
+	mergedItems := lo.Map(ancestors, func(prNum int, i int) github.PrStackItem {
+		return github.PrStackItem{PRNum: prNum, Depth: i, Merged: true}
+	})
+	return append(mergedItems, prStack...), openPRs, nil
+}
 
-	sp.Suffix = " updating parent PR with forward reference"
-	_, err = shell.Run(
-		shell.Opt{},
-		fmt.Sprintf(
-			"gh pr edit %s --body %s",
-			shellescape.Quote(parentPRData.URL),
-			shellescape.Quote(parentPrBody.ToMarkdown()),
-		),
-	)
+// Returns the open PR of the branch, or its merged PR, or nil.
+func getPRForStack(client github.Client, node *git.TreeNode) (*github.PullRequest, error) {
+	branchName := node.CommitMetadata.CleanedBranchNames()[0]
+	pr, err := client.FetchPRForBranch(branchName)
+	if err != nil {
+		return nil, fmt.Errorf("fetching PR data for branch %q: %w", branchName, err)
+	}
+	if pr != nil {
+		return pr, nil
+	}
+	pr, err = fetchPRFromBranchDescription(client, node)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"fetching PR data from branch description of branch %q: %w",
+			branchName,
+			err,
+		)
+	}
+	if pr != nil && pr.State == "MERGED" {
+		return pr, nil
+	}
+	return nil, nil
+}
+
+// Returns the merged PRs that the PR body lists as ancestors of the PR, ordered from the trunk.
+func getMergedAncestorPRs(client github.Client, pr *github.PullRequest) ([]int, error) {
+	prBody, err := github.NewPrBody(pr.Body)
 	if err != nil {
-		return fmt.Errorf("editing parent PR %q to reference %q: %w", parentPRData.URL, prURL, err)
+		return nil, fmt.Errorf("parsing PR body: %w", err)
+	}
+	var ancestors []int
+	if len(prBody.Stack) != 0 {
+		depth := -1
+		for i := len(prBody.Stack) - 1; i >= 0; i-- {
+			item := prBody.Stack[i]
+			if item.PRNum == pr.Number {
+				depth = item.Depth
+			} else if depth != -1 && item.Depth < depth {
+				ancestors = append([]int{item.PRNum}, ancestors...)
+				depth = item.Depth
+			}
+		}
+	} else if prBody.PreviousPR != 0 {
+		ancestors = []int{prBody.PreviousPR}
 	}
 
-	return nil
+	return lo.Filter(ancestors, func(prNum int, _ int) bool {
+		ancestorPR, err := client.FetchPRByNum(prNum)
+		// An ancestor that cannot be fetched is dropped.
+		return err == nil && ancestorPR.State == "MERGED"
+	}), nil
+}
+
+// Returns whether the PR body was changed.
+func updatePRStack(client github.Client, pr *github.PullRequest, prStack []github.PrStackItem) (bool, error) {
+	prBody, err := github.NewPrBody(pr.Body)
+	if err != nil {
+		return false, fmt.Errorf("parsing PR body: %w", err)
+	}
+	prBody.SetStack(prStack, pr.Number)
+	body := prBody.ToMarkdown()
+	if body == pr.Body {
+		return false, nil
+	}
+	err = client.EditPR(pr.Number, github.EditPROpts{Body: &body})
+	if err != nil {
+		return false, fmt.Errorf("editing PR body: %w", err)
+	}
+	return true, nil
 }
 
 func addPRURLToBranchDescription(
 	stackEntry *stackEntry,
 	prURL string,
-	sp *spinner.Spinner,
+	row *statusRow,
 ) error {
-	sp.Suffix = " adding PR URL to local branch description"
+	row.set("adding PR URL to local branch description")
 
 	branchDescription := stackEntry.node.CommitMetadata.BranchDescription
 	branchDescription.PrURL = prURL
+	// git config cannot be written concurrently.
+	gitConfigMu.Lock()
+	defer gitConfigMu.Unlock()
 	err := writeBranchDescription(stackEntry.branchName, branchDescription.String())
 	if err != nil {
 		return fmt.Errorf(
@@ -557,7 +835,7 @@ func addPRURLToBranchDescription(
 	return nil
 }
 
-func getPRDataForNode(node *git.TreeNode) (*github.PullRequest, error) {
+func getPRDataForNode(client github.Client, node *git.TreeNode) (*github.PullRequest, error) {
 	branchName := node.CommitMetadata.CleanedBranchNames()[0]
 
 	// Handle ignored PRs.
@@ -566,7 +844,7 @@ func getPRDataForNode(node *git.TreeNode) (*github.PullRequest, error) {
 	}
 
 	// Try the branch name.
-	prData, err := github.FetchPRForBranch(branchName)
+	prData, err := client.FetchPRForBranch(branchName)
 	if err != nil {
 		return nil, fmt.Errorf("fetching PR data for branch %q: %w", branchName, err)
 	}
@@ -575,7 +853,7 @@ func getPRDataForNode(node *git.TreeNode) (*github.PullRequest, error) {
 	}
 
 	// Try the PR URL in the branch description (for merged PRs).
-	prData, err = fetchPRFromBranchDescription(node)
+	prData, err = fetchPRFromBranchDescription(client, node)
 	if err != nil {
 		return nil, fmt.Errorf(
 			"fetching PR data from branch description of branch %q: %w",
@@ -590,12 +868,15 @@ func getPRDataForNode(node *git.TreeNode) (*github.PullRequest, error) {
 	return nil, fmt.Errorf("no PR found for branch %q", branchName)
 }
 
-func fetchPRFromBranchDescription(node *git.TreeNode) (*github.PullRequest, error) {
+func fetchPRFromBranchDescription(
+	client github.Client,
+	node *git.TreeNode,
+) (*github.PullRequest, error) {
 	prURL, _ := node.CommitMetadata.PRURL()
 	if prURL == "" {
 		return nil, nil
 	}
-	prData, err := github.FetchPRByURLOrNum(prURL)
+	prData, err := client.FetchPRByURLOrNum(prURL)
 	if err != nil {
 		return nil, fmt.Errorf("fetching PR data for PR URL %q: %w", prURL, err)
 	}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/samber/lo"
+
+	"github.com/fatih/color"
+)
+
+// Serializes writes to git config, which fail if another process holds the config lock.
+var gitConfigMu sync.Mutex
+
+// submitTask tracks the processing of one branch.
+type submitTask struct {
+	stackEntry *stackEntry
+	row        *statusRow
+	// Closed once the branch has been processed, since children need the PR of their parent to exist.
+	done chan struct{}
+	// Set before done is closed if the branch could not be processed.
+	failed bool
+}
+
+// Marks the branch as processed with the given final status.
+func (t *submitTask) finish(finalStatus string) {
+	t.row.finish(finalStatus)
+	close(t.done)
+}
+
+func (t *submitTask) fail(err error) error {
+	t.failed = true
+	t.row.finish(color.RedString("(failed)"))
+	close(t.done)
+	return fmt.Errorf("processing branch %s: %w", t.stackEntry.branchName, err)
+}
+
+// runSubmitPipeline pushes all the branches at once, then creates or updates their PRs concurrently.
+// A branch is processed as soon as its parent PR exists. Branches whose parent failed are not processed.
+// Finally, the stack listing is updated in the bodies of all the PRs of the stack.
+// The stack must be ordered from the root.
+func runSubmitPipeline(cfg submitCfg, stack []*stackEntry) error {
+	board := newStatusBoard()
+	tasks := make(map[string]*submitTask)
+	for _, stackEntry := range stack {
+		tasks[stackEntry.branchName] = &submitTask{
+			stackEntry: stackEntry,
+			row:        board.addRow(color.GreenString("%s: ", stackEntry.branchName)),
+			done:       make(chan struct{}),
+		}
+	}
+	var stackRow *statusRow
+	if !cfg.pushOnly {
+		stackRow = board.addRow(color.GreenString("stack: "))
+	}
+	board.start()
+	defer board.stop()
+
+	var errs []error
+	var errsMu sync.Mutex
+	addErr := func(err error) {
+		errsMu.Lock()
+		defer errsMu.Unlock()
+		errs = append(errs, err)
+	}
+
+	var toPush []*submitTask
+	for _, stackEntry := range stack {
+		task := tasks[stackEntry.branchName]
+		task.row.set("processing")
+		skipStatus, err := getSkipStatus(cfg, stackEntry)
+		if err != nil {
+			addErr(task.fail(err))
+			continue
+		}
+		if skipStatus != "" {
+			task.finish(skipStatus)
+			continue
+		}
+		toPush = append(toPush, task)
+	}
+
+	for _, task := range toPush {
+		task.row.set("pushing to remote")
+	}
+	wasPushed, pushErrs, err := pushBranches(cfg, lo.Map(toPush, func(task *submitTask, _ int) string {
+		return task.stackEntry.branchName
+	}))
+	if err != nil {
+		for _, task := range toPush {
+			task.fail(err)
+		}
+		if stackRow != nil {
+			stackRow.finish(color.RedString("(failed)"))
+		}
+		return fmt.Errorf("pushing branches: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	for _, task := range toPush {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			branchName := task.stackEntry.branchName
+
+			// Wait for the parent PR to exist.
+			parent := task.stackEntry.node.BranchParent
+			if !parent.CommitMetadata.IsEffectiveMaster() {
+				if parentTask, ok := tasks[parent.CommitMetadata.CleanedBranchNames()[0]]; ok {
+					task.row.set("waiting for parent PR")
+					<-parentTask.done
+					if parentTask.failed {
+						task.failed = true
+						task.finish(color.YellowString("(skipped because the parent branch failed)"))
+						return
+					}
+				}
+			}
+
+			if pushErr, ok := pushErrs[branchName]; ok {
+				addErr(task.fail(fmt.Errorf("pushing branch %q: %w", branchName, pushErr)))
+				return
+			}
+			finalStatus, err := processBranch(
+				cfg,
+				task.stackEntry,
+				wasPushed[branchName],
+				task.row,
+			)
+			if err != nil {
+				addErr(task.fail(err))
+				return
+			}
+			task.finish(finalStatus)
+		}()
+	}
+	wg.Wait()
+
+	// The stack listing of each PR depends on the PRs of the whole stack.
+	if stackRow != nil {
+		finalStatus, err := syncStackPRBodies(cfg, stack, stackRow)
+		if err != nil {
+			stackRow.finish(color.RedString("(failed)"))
+			addErr(fmt.Errorf("updating the stack in PR bodies: %w", err))
+		} else {
+			stackRow.finish(finalStatus)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/github"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestSubmit_createsStackedPRs(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+
+	g.Expect(runHg("submit")).To(Succeed())
+
+	prs := gh.PRs()
+	g.Expect(prs).To(HaveLen(2))
+	g.Expect(prs[0].HeadRefName).To(Equal("a"))
+	g.Expect(prs[0].BaseRefName).To(Equal("main"))
+	g.Expect(prs[0].Title).To(Equal("Title of a"))
+	g.Expect(prs[1].HeadRefName).To(Equal("b"))
+	g.Expect(prs[1].BaseRefName).To(Equal("a"))
+
+	prBody, err := github.NewPrBody(prs[1].Body)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(prBody.Description).To(Equal("Description of b"))
+	g.Expect(prBody.Stack).To(Equal([]github.PrStackItem{
+		{PRNum: 1, Depth: 0},
+		{PRNum: 2, Depth: 1},
+	}))
+	g.Expect(prBody.CurrentPR).To(Equal(2))
+	prBody, err = github.NewPrBody(prs[0].Body)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(prBody.NextPRs).To(Equal([]int{2}))
+
+	g.Expect(repo.OriginGit("rev-parse", "b")).To(Equal(repo.Hash("b")))
+	g.Expect(repo.Git("config", "branch.a.description")).To(ContainSubstring("PR: " + prs[0].URL))
+}
+
+func TestSubmit_updatesExistingPRs(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	g.Expect(runHg("submit")).To(Succeed())
+
+	repo.CommitFile("b.txt", "b2\n", "b2")
+	repo.Git("config", "branch.b.description", "New title of b\n\nNew description of b\n\nPR: "+gh.PR(2).URL)
+	g.Expect(runHg("submit")).To(Succeed())
+
+	prs := gh.PRs()
+	g.Expect(prs).To(HaveLen(2))
+	g.Expect(prs[1].Title).To(Equal("New title of b"))
+	prBody, err := github.NewPrBody(prs[1].Body)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(prBody.Description).To(Equal("New description of b"))
+	g.Expect(prBody.PreviousPR).To(Equal(1))
+	g.Expect(repo.OriginGit("rev-parse", "b")).To(Equal(repo.Hash("b")))
+}
+
+func TestSubmit_listsMergedAncestors(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	repo.CreateBranch("a")
+	aHash := repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	g.Expect(runHg("submit")).To(Succeed())
+
+	// Merge a, then clean it up so that b is based on main.
+	gh.MergePR(1)
+	repo.OriginGit("update-ref", "refs/heads/main", aHash)
+	repo.OriginGit("update-ref", "-d", "refs/heads/a")
+	g.Expect(runHg("cleanup")).To(Succeed())
+	g.Expect(runHg("submit")).To(Succeed())
+
+	pr := gh.PR(2)
+	g.Expect(pr.BaseRefName).To(Equal("main"))
+	prBody, err := github.NewPrBody(pr.Body)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(prBody.Stack).To(Equal([]github.PrStackItem{
+		{PRNum: 1, Depth: 0, Merged: true},
+		{PRNum: 2, Depth: 1},
+	}))
+}
+
+func TestSubmit_pushOnly(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+
+	g.Expect(runHg("submit", "-p")).To(Succeed())
+
+	g.Expect(gh.PRs()).To(BeEmpty())
+	g.Expect(repo.OriginGit("rev-parse", "a")).To(Equal(repo.Hash("a")))
+}
+
+func TestSubmit_forcePushesWithLeaseAfterRebaseRestack(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	testutil.InstallFakeGH(t, repo)
+	repo.Git("config", "hggit.restackStrategy", string(restackStrategyRebase))
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	g.Expect(runHg("submit", "-p")).To(Succeed())
+	repo.Checkout("a")
+	repo.WriteFile("a.txt", "a amended\n")
+	g.Expect(runHg("amend", "-m", "a2")).To(Succeed())
+	g.Expect(repo.IsAncestor("origin/b", "b")).To(BeFalse())
+
+	g.Expect(runHg("submit", "-p", "b")).To(Succeed())
+
+	g.Expect(repo.OriginGit("rev-parse", "b")).To(Equal(repo.Hash("b")))
+}
+
+func TestSubmit_fork(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	gh := testutil.InstallFakeGH(t, repo)
+	forkURL := "https://github.com/fork-owner/repo.git"
+	forkDir := filepath.Join(t.TempDir(), "fork.git")
+	g.Expect(exec.Command("git", "init", "-q", "--bare", forkDir).Run()).To(Succeed())
+	repo.Git("remote", "add", "fork", forkURL)
+	// Pushes to the fork go to the local bare repo while its URL is still read as a GitHub URL.
+	repo.Git("config", "url."+forkDir+".insteadOf", forkURL)
+	repo.Git("config", "hggit.pushRemote", "fork")
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+
+	g.Expect(runHg("submit")).To(Succeed())
+
+	prs := gh.PRs()
+	g.Expect(prs).To(HaveLen(2))
+	for _, pr := range prs {
+		g.Expect(pr.HeadRepositoryOwner.Login).To(Equal("fork-owner"))
+		g.Expect(pr.BaseRefName).To(Equal("main"))
+	}
+	g.Expect(prs[1].HeadRefName).To(Equal("b"))
+	prBody, err := github.NewPrBody(prs[1].Body)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(prBody.PreviousPR).To(Equal(1))
+	g.Expect(repo.OriginGit("branch", "--list", "b")).To(BeEmpty())
+	g.Expect(repo.Git("--git-dir", forkDir, "rev-parse", "b")).To(Equal(repo.Hash("b")))
+
+	// PRs opened from the fork are found again and updated.
+	repo.CommitFile("b.txt", "b2\n", "b2")
+	g.Expect(runHg("submit")).To(Succeed())
+	g.Expect(gh.PRs()).To(HaveLen(2))
+	g.Expect(repo.Git("--git-dir", forkDir, "rev-parse", "b")).To(Equal(repo.Hash("b")))
+
+	out, err := runHgAndCaptureOutput(t, "sl")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).ToNot(ContainSubstring("fork/"))
+}
@@ -19,7 +19,11 @@ func newUncommitCmd() *cobra.Command {
 		Short: "Uncommit the current branch.",
 		Long:  "Uncommit the current branch so that all of its changes are unstaged.",
 		Args:  cobra.NoArgs,
-		RunE:  runUncommit,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return recordOperation(func() error {
+				return runUncommit(cmd, args)
+			})
+		},
 	}
 	return cmd
 }
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestUncommit(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CommitFile("README.md", "changed\n", "a2")
+
+	g.Expect(runHg("uncommit")).To(Succeed())
+
+	g.Expect(repo.BranchExists("a")).To(BeFalse())
+	g.Expect(repo.Hash("HEAD")).To(Equal(repo.Hash("main")))
+	g.Expect(repo.Status()).To(Equal(" M README.md\n?? a.txt"))
+	g.Expect(repo.ReadFile("a.txt")).To(Equal("a\n"))
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/yapaluc/hg-git/src/git"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func newUndoCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "undo [operation id]",
+		Short: "Undoes the last stack-mutating operation.",
+		Long:  "Undoes the last stack-mutating operation, or all operations back to and including the given one (see `hg oplog`). Branches, HEAD and branch descriptions touched by the operation are restored to their previous state. Undone operations can be reapplied with `hg redo`.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runUndo(args)
+		},
+	}
+}
+
+func runUndo(args []string) error {
+	oplog, err := git.LoadOplog()
+	if err != nil {
+		return err
+	}
+	if oplog.Position == 0 {
+		return fmt.Errorf("nothing to undo")
+	}
+
+	target := oplog.Position - 1
+	if len(args) > 0 {
+		target, err = findOplogEntry(oplog, args[0])
+		if err != nil {
+			return err
+		}
+		if target >= oplog.Position {
+			return fmt.Errorf("operation %s has already been undone", args[0])
+		}
+	}
+
+	for i := oplog.Position - 1; i >= target; i-- {
+		entry := oplog.Entries[i]
+		color.Green("Undoing operation %d: %s", entry.ID, entry.Command)
+		err := git.RestoreRepoSnapshot(entry.Before, entry.ChangedBranches())
+		if err != nil {
+			return fmt.Errorf("undoing operation %d: %w", entry.ID, err)
+		}
+		oplog.Position = i
+		err = oplog.Save()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the index of the oplog entry with the given ID.
+func findOplogEntry(oplog *git.Oplog, rawID string) (int, error) {
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid operation id %q", rawID)
+	}
+	i := oplog.IndexOf(id)
+	if i == -1 {
+		return 0, fmt.Errorf("operation %d not found in oplog", id)
+	}
+	return i, nil
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestUndo_amendThenRedo(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.Checkout("a")
+	aHash, bHash := repo.Hash("a"), repo.Hash("b")
+
+	repo.WriteFile("a.txt", "a2\n")
+	g.Expect(runHg("amend", "-m", "a2")).To(Succeed())
+	amendedAHash, restackedBHash := repo.Hash("a"), repo.Hash("b")
+	g.Expect(amendedAHash).ToNot(Equal(aHash))
+
+	g.Expect(runHg("undo")).To(Succeed())
+	g.Expect(repo.Hash("a")).To(Equal(aHash))
+	g.Expect(repo.Hash("b")).To(Equal(bHash))
+	g.Expect(repo.CurrentBranch()).To(Equal("a"))
+	g.Expect(repo.ReadFile("a.txt")).To(Equal("a\n"))
+	g.Expect(repo.Status()).To(BeEmpty())
+	g.Expect(runHg("undo")).To(MatchError(ContainSubstring("nothing to undo")))
+
+	g.Expect(runHg("redo")).To(Succeed())
+	g.Expect(repo.Hash("a")).To(Equal(amendedAHash))
+	g.Expect(repo.Hash("b")).To(Equal(restackedBHash))
+	g.Expect(repo.ReadFile("a.txt")).To(Equal("a2\n"))
+	g.Expect(runHg("redo")).To(MatchError(ContainSubstring("nothing to redo")))
+}
+
+func TestUndo_restoresBranchDescriptions(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.Checkout("a")
+	aDesc := repo.Git("config", "branch.a.description")
+	bDesc := repo.Git("config", "branch.b.description")
+
+	g.Expect(runHg("fold", "--from", "b")).To(Succeed())
+	foldedDesc := repo.Git("config", "branch.a.description")
+	g.Expect(foldedDesc).ToNot(Equal(aDesc))
+
+	g.Expect(runHg("undo")).To(Succeed())
+	g.Expect(repo.BranchExists("b")).To(BeTrue())
+	g.Expect(repo.Git("config", "branch.a.description")).To(Equal(aDesc))
+	g.Expect(repo.Git("config", "branch.b.description")).To(Equal(bDesc))
+
+	g.Expect(runHg("redo")).To(Succeed())
+	g.Expect(repo.BranchExists("b")).To(BeFalse())
+	g.Expect(repo.Git("config", "branch.a.description")).To(Equal(foldedDesc))
+}
+
+func TestUndo_toOperationAndNewOperationDropsRedo(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	aHash := repo.Hash("a")
+	var amendedHashes []string
+	for _, content := range []string{"a2\n", "a3\n"} {
+		repo.WriteFile("a.txt", content)
+		g.Expect(runHg("amend", "-m", "amend")).To(Succeed())
+		amendedHashes = append(amendedHashes, repo.Hash("a"))
+	}
+
+	out, err := runHgAndCaptureOutput(t, "oplog")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(MatchRegexp(`^@ 2 .*\no 1 `))
+
+	// Undoing back to the first operation undoes both.
+	g.Expect(runHg("undo", "1")).To(Succeed())
+	g.Expect(repo.Hash("a")).To(Equal(aHash))
+	out, err = runHgAndCaptureOutput(t, "oplog")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(MatchRegexp(`^x 2 .*\nx 1 `))
+
+	// Redoing up to the first operation leaves the second one undone.
+	g.Expect(runHg("redo", "1")).To(Succeed())
+	g.Expect(repo.Hash("a")).To(Equal(amendedHashes[0]))
+	g.Expect(runHg("redo", "1")).To(MatchError(ContainSubstring("has not been undone")))
+	g.Expect(runHg("undo", "2")).To(MatchError(ContainSubstring("already been undone")))
+
+	// A new operation replaces the undone ones, which can no longer be redone.
+	repo.WriteFile("a.txt", "a4\n")
+	g.Expect(runHg("amend", "-m", "amend")).To(Succeed())
+	g.Expect(runHg("redo")).To(MatchError(ContainSubstring("nothing to redo")))
+	out, err = runHgAndCaptureOutput(t, "oplog")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(MatchRegexp(`^@ 3 .*\no 1 `))
+	g.Expect(out).ToNot(MatchRegexp(`(?m)^. 2 `))
+}
@@ -14,6 +14,7 @@ func newUpdateCmd() *cobra.Command {
 	var cmd = &cobra.Command{
 		Use:     "update <rev>",
 		Short:   "Checkout the given rev. Rev can be a branch name or a commit hash. Snaps to a branch name if possible.",
+		Long:    "Checkout the given rev. Rev can be a branch name, a commit hash or a revset matching a single commit, e.g. `.^` or `heads(stack())`. Snaps to a branch name if possible.",
 		Aliases: []string{"up"},
 		Args:    cobra.ExactArgs(1),
 		RunE: func(_ *cobra.Command, args []string) error {
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestUpdate_revsets(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.CreateBranch("c")
+	repo.CommitFile("c.txt", "c\n", "c1")
+
+	g.Expect(runHg("update", ".~2")).To(Succeed())
+	g.Expect(repo.CurrentBranch()).To(Equal("a"))
+
+	g.Expect(runHg("update", "heads(stack())")).To(Succeed())
+	g.Expect(repo.CurrentBranch()).To(Equal("c"))
+
+	g.Expect(runHg("update", "children(a)")).To(Succeed())
+	g.Expect(repo.CurrentBranch()).To(Equal("b"))
+
+	g.Expect(runHg("update", "stack()")).To(MatchError(ContainSubstring("matches 3 commits")))
+}
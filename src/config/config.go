@@ -0,0 +1,378 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yapaluc/hg-git/src/shell"
+
+	"github.com/fatih/color"
+	"gopkg.in/yaml.v3"
+)
+
+// Name of the config file in the repo root, meant to be committed and shared with the team.
+const RepoConfigFileName = ".hg-git.yaml"
+
+// Source of the settings that are not set anywhere.
+const SourceDefault = "default"
+
+const gitConfigPrefix = "hggit."
+
+// Values of restackStrategy.
+var restackStrategies = []string{"merge", "rebase", "rebase-update-refs"}
+
+// Config holds the hg-git settings.
+// Settings are read, from lowest to highest precedence, from ~/.config/hg-git/config.yaml,
+// .hg-git.yaml in the repo root, and git config under hggit.
+type Config struct {
+	// Remote that branches are pushed to and that the trunk is tracked from,
+	// unless pushRemote or baseRemote is set.
+	Remote string `yaml:"remote"`
+	// Remote that branches are pushed to, e.g. a personal fork. Defaults to remote.
+	PushRemote string `yaml:"pushRemote"`
+	// Remote of the repository that PRs are opened against and that the trunk is tracked from,
+	// e.g. the upstream repository of a fork. Defaults to remote.
+	BaseRemote string `yaml:"baseRemote"`
+	// Message of the commit created by `amend -f`.
+	AmendMessage string `yaml:"amendMessage"`
+	// Message of the merge commits created when restacking with the merge strategy.
+	// The name of the merged branch is appended in parentheses.
+	SyncMessage string `yaml:"syncMessage"`
+	// Refs with these prefixes are not treated as branches, in addition to the branches of the remote.
+	HiddenBranchPrefixes []string `yaml:"hiddenBranchPrefixes"`
+	// Whether submit creates draft PRs when -n is not given.
+	Draft bool `yaml:"draft"`
+	// How branches are restacked when --strategy is not given: merge, rebase or rebase-update-refs.
+	RestackStrategy string `yaml:"restackStrategy"`
+	// Log templates by lower-case name, for the -T flag of log.
+	Templates map[string]string `yaml:"templates"`
+
+	// Where each setting that is not a default was read from, by key.
+	sources map[string]string
+}
+
+// Setting is a setting with its effective value, as shown by `hg config`.
+type Setting struct {
+	Key string
+	// Values of the setting. Only lists have several values.
+	Values []string
+	Source string
+}
+
+// Default returns the config used when no setting is set.
+func Default() *Config {
+	return &Config{
+		Remote:               "origin",
+		PushRemote:           "origin",
+		BaseRemote:           "origin",
+		AmendMessage:         "update",
+		SyncMessage:          "Sync changes from upstream",
+		HiddenBranchPrefixes: []string{"refs/branchless/", "tag: "},
+		RestackStrategy:      "merge",
+		Templates:            map[string]string{},
+		sources:              map[string]string{},
+	}
+}
+
+// Load reads the config from the config files and git config.
+// The repo config file is only read from inside a git repo.
+func Load() (*Config, error) {
+	cfg := Default()
+
+	userConfigDir, err := getUserConfigDir()
+	if err == nil {
+		err = cfg.applyFile(filepath.Join(userConfigDir, "hg-git", "config.yaml"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	repoRoot, err := shell.Run(
+		shell.Opt{StripTrailingNewline: true, SuppressStderrStreaming: true},
+		"git rev-parse --show-toplevel",
+	)
+	if err == nil {
+		err = cfg.applyFile(filepath.Join(repoRoot, RepoConfigFileName))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.applyGitConfig()
+
+	// Remotes that are not set default to remote, and are reported as set where remote is.
+	remoteSource, remoteIsSet := cfg.sources["remote"]
+	if _, ok := cfg.sources["pushRemote"]; !ok {
+		cfg.PushRemote = cfg.Remote
+		if remoteIsSet {
+			cfg.sources["pushRemote"] = remoteSource
+		}
+	}
+	if _, ok := cfg.sources["baseRemote"]; !ok {
+		cfg.BaseRemote = cfg.Remote
+		if remoteIsSet {
+			cfg.sources["baseRemote"] = remoteSource
+		}
+	}
+	return cfg, nil
+}
+
+// PushesToFork returns true if branches are pushed to another remote than the one PRs are opened against.
+func (c *Config) PushesToFork() bool {
+	return c.PushRemote != c.BaseRemote
+}
+
+// AllHiddenBranchPrefixes returns the prefixes of the refs that are not treated as branches,
+// including the branches of the remotes.
+func (c *Config) AllHiddenBranchPrefixes() []string {
+	var prefixes []string
+	for _, remote := range []string{c.Remote, c.PushRemote, c.BaseRemote} {
+		if !slices.Contains(prefixes, remote+"/") {
+			prefixes = append(prefixes, remote+"/")
+		}
+	}
+	return append(prefixes, c.HiddenBranchPrefixes...)
+}
+
+// Settings returns all settings with their effective value, templates last.
+func (c *Config) Settings() []Setting {
+	settings := []Setting{
+		c.setting("remote", c.Remote),
+		c.setting("pushRemote", c.PushRemote),
+		c.setting("baseRemote", c.BaseRemote),
+		c.setting("amendMessage", c.AmendMessage),
+		c.setting("syncMessage", c.SyncMessage),
+		c.setting("hiddenBranchPrefixes", c.HiddenBranchPrefixes...),
+		c.setting("draft", strconv.FormatBool(c.Draft)),
+		c.setting("restackStrategy", c.RestackStrategy),
+	}
+	names := make([]string, 0, len(c.Templates))
+	for name := range c.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		settings = append(settings, c.setting("templates."+name, c.Templates[name]))
+	}
+	return settings
+}
+
+// Get returns the setting with the given key, which is case-insensitive as in git config.
+func (c *Config) Get(key string) (Setting, bool) {
+	for _, setting := range c.Settings() {
+		if strings.EqualFold(setting.Key, key) {
+			return setting, true
+		}
+	}
+	return Setting{}, false
+}
+
+func (c *Config) setting(key string, values ...string) Setting {
+	source, ok := c.sources[key]
+	if !ok {
+		source = SourceDefault
+	}
+	return Setting{Key: key, Values: values, Source: source}
+}
+
+// Follows the XDG base directory spec on all platforms, like git and gh.
+func getUserConfigDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("getting home directory: %w", err)
+	}
+	return filepath.Join(home, ".config"), nil
+}
+
+// Reads the settings of a YAML config file, if it exists.
+// A file that cannot be parsed fails every command, while unknown keys and invalid values are ignored
+// with a warning like in git config.
+func (c *Config) applyFile(path string) error {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	var settings map[string]any
+	err = yaml.Unmarshal(content, &settings)
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		err := c.applyFileSetting(key, settings[key], path)
+		if err != nil {
+			warnIgnoredSetting(key, path, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) applyFileSetting(key string, value any, path string) error {
+	if key == "templates" {
+		templates, ok := value.(map[string]any)
+		if !ok && value != nil {
+			return fmt.Errorf("templates must be a map of names to templates")
+		}
+		names := make([]string, 0, len(templates))
+		for name := range templates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			err := c.set("templates."+name, []string{fmt.Sprint(templates[name])}, path)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	values, err := getYAMLValues(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return c.set(key, values, path)
+}
+
+func getYAMLValues(value any) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values, nil
+	case map[string]any:
+		return nil, fmt.Errorf("expected a value or a list of values")
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
+
+// Reads the settings under hggit in git config, from all git config files.
+// Unknown keys and invalid values are ignored with a warning instead of failing every command,
+// as config files may be shared with other versions of hg-git.
+func (c *Config) applyGitConfig() {
+	out, err := shell.Run(
+		shell.Opt{SuppressStderrStreaming: true},
+		`git config -z --show-origin --get-regexp '^hggit\.'`,
+	)
+	if err != nil {
+		// git config exits with code 1 if there is no match.
+		return
+	}
+
+	// Each entry is "origin\0key\nvalue\0". Multi-valued keys have one entry per value.
+	var keys []string
+	keyToValues := make(map[string][]string)
+	keyToSource := make(map[string]string)
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		origin := fields[i]
+		key, value, _ := strings.Cut(fields[i+1], "\n")
+		key = strings.TrimPrefix(key, gitConfigPrefix)
+		if _, ok := keyToValues[key]; !ok {
+			keys = append(keys, key)
+		}
+		keyToValues[key] = append(keyToValues[key], value)
+		keyToSource[key] = "git config " + strings.TrimPrefix(origin, "file:")
+	}
+	for _, key := range keys {
+		err := c.set(key, keyToValues[key], keyToSource[key])
+		if err != nil {
+			warnIgnoredSetting(gitConfigPrefix+key, keyToSource[key], err)
+		}
+	}
+}
+
+// Warns that a setting is ignored, in which case the setting keeps its value from the previous sources.
+func warnIgnoredSetting(key string, source string, err error) {
+	fmt.Fprintln(os.Stderr, color.YellowString("Ignoring %s (%s): %s", key, source, err))
+}
+
+// Sets a setting from its values. Keys are case-insensitive as in git config,
+// which lists keys in lower case.
+func (c *Config) set(key string, values []string, source string) error {
+	var value string
+	if len(values) > 0 {
+		value = values[len(values)-1]
+	}
+
+	var canonicalKey string
+	switch strings.ToLower(key) {
+	case "remote":
+		canonicalKey = "remote"
+		c.Remote = value
+	case "pushremote":
+		canonicalKey = "pushRemote"
+		c.PushRemote = value
+	case "baseremote":
+		canonicalKey = "baseRemote"
+		c.BaseRemote = value
+	case "amendmessage":
+		canonicalKey = "amendMessage"
+		c.AmendMessage = value
+	case "syncmessage":
+		canonicalKey = "syncMessage"
+		c.SyncMessage = value
+	case "hiddenbranchprefixes":
+		canonicalKey = "hiddenBranchPrefixes"
+		c.HiddenBranchPrefixes = values
+	case "draft":
+		canonicalKey = "draft"
+		draft, err := parseBool(value)
+		if err != nil {
+			return fmt.Errorf("draft: %w", err)
+		}
+		c.Draft = draft
+	case "restackstrategy":
+		canonicalKey = "restackStrategy"
+		if value != "" && !slices.Contains(restackStrategies, value) {
+			return fmt.Errorf(
+				"restackStrategy: unknown restack strategy %q. expected merge, rebase or rebase-update-refs",
+				value,
+			)
+		}
+		c.RestackStrategy = value
+	default:
+		name, ok := strings.CutPrefix(strings.ToLower(key), "templates.")
+		if !ok || name == "" {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		canonicalKey = "templates." + name
+		c.Templates[name] = value
+	}
+	c.sources[canonicalKey] = source
+	return nil
+}
+
+// Accepts the boolean values of git config as well as YAML.
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid boolean %q", value)
+	}
+}
@@ -0,0 +1,142 @@
+package git
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/yapaluc/hg-git/src/shell"
+
+	"github.com/alessio/shellescape"
+)
+
+const branchParentsFileName = "branch_parents.json"
+
+// branchParent is the branch that a branch was last seen stacked on, along with the tip of that branch at the time.
+// The branch graph links each branch to its closest ancestor branch, so once the parent branch moves with plain git,
+// this is what tells that the branch still belongs on top of it and needs to be restacked.
+type branchParent struct {
+	BranchName     string
+	BaseCommitHash string
+}
+
+// Returns the branch parents keyed by branch name.
+// The file is rewritten each time the branch graph is built, so any failure to read it is treated as no record.
+func loadBranchParents(runner shell.Runner) map[string]branchParent {
+	branchParents := make(map[string]branchParent)
+	path, err := getBranchParentsPath(runner)
+	if err != nil {
+		return branchParents
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return branchParents
+	}
+	_ = json.Unmarshal(content, &branchParents)
+	return branchParents
+}
+
+func saveBranchParents(runner shell.Runner, branchParents map[string]branchParent) error {
+	content, err := json.Marshal(branchParents)
+	if err != nil {
+		return fmt.Errorf("encoding branch parents: %w", err)
+	}
+	path, err := getBranchParentsPath(runner)
+	if err != nil {
+		return err
+	}
+	// Write to a temp file first so that concurrent readers never see a partial file.
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, content, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing branch parents: %w", err)
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return fmt.Errorf("renaming branch parents: %w", err)
+	}
+	return nil
+}
+
+// Returns the branch parent of each branch of the graph, keeping the previous record of stale branches
+// so that they stay stale until they are restacked.
+// Branches based on master or on its history are not recorded, since they are never stale.
+func (rd *RepoData) getBranchParents(previous map[string]branchParent) map[string]branchParent {
+	branchParents := make(map[string]branchParent)
+	for branchName, node := range rd.BranchNameToNode {
+		if node.IsStale() {
+			if previousParent, ok := previous[branchName]; ok {
+				branchParents[branchName] = previousParent
+			}
+			continue
+		}
+		parent := node.BranchParent
+		if parent == rd.BranchRootNode || parent.CommitMetadata.IsPartOfMaster ||
+			parent == rd.BranchNameToNode[rd.MasterBranch] {
+			continue
+		}
+		parentBranch := rd.branchNameOf(parent, previous[branchName].BranchName)
+		if parentBranch == "" {
+			continue
+		}
+		branchParents[branchName] = branchParent{
+			BranchName:     parentBranch,
+			BaseCommitHash: parent.CommitMetadata.CommitHash,
+		}
+	}
+	return branchParents
+}
+
+// Returns the name of a branch pointing at the node, preferring the given name,
+// then the first name in alphabetical order.
+func (rd *RepoData) branchNameOf(node *TreeNode, preferredName string) string {
+	if rd.BranchNameToNode[preferredName] == node {
+		return preferredName
+	}
+	var name string
+	for branchName, branchNode := range rd.BranchNameToNode {
+		if branchNode == node && (name == "" || branchName < name) {
+			name = branchName
+		}
+	}
+	return name
+}
+
+// Saves the branch parents if they changed.
+func (rd *RepoData) updateBranchParents(previous map[string]branchParent) error {
+	branchParents := rd.getBranchParents(previous)
+	if reflect.DeepEqual(branchParents, previous) {
+		return nil
+	}
+	return saveBranchParents(rd.runner, branchParents)
+}
+
+// findFormerBranchTip returns the most recent former tip of the branch, according to its reflog,
+// that the given commit is based on. The reflog is only a hint to find where a stale branch was based,
+// so an expired or disabled reflog is not an error.
+func findFormerBranchTip(runner shell.Runner, graph *commitGraph, branchName string, commitHash string) (string, bool) {
+	lines, err := shell.RunAndCollectLinesWith(
+		runner,
+		shell.Opt{SuppressStderrStreaming: true},
+		fmt.Sprintf("git log -g --format=%%H %s", shellescape.Quote("refs/heads/"+branchName)),
+	)
+	if err != nil {
+		return "", false
+	}
+	for _, formerTip := range lines {
+		if formerTip != commitHash && graph.isOutsideMaster(formerTip) && graph.isAncestor(formerTip, commitHash) {
+			return formerTip, true
+		}
+	}
+	return "", false
+}
+
+func getBranchParentsPath(runner shell.Runner) (string, error) {
+	dir, err := getHgGitDir(runner)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, branchParentsFileName), nil
+}
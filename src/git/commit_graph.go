@@ -0,0 +1,170 @@
+package git
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yapaluc/hg-git/src/shell"
+
+	"github.com/alessio/shellescape"
+)
+
+// commitGraph is an in-memory view of the commits that are reachable from local branches but not from master.
+// Boundary commits are the commits on master's history that those commits are based on.
+type commitGraph struct {
+	commits map[string]*graphCommit
+}
+
+type graphCommit struct {
+	// Position in topological order. Descendants always have a lower index than their ancestors.
+	index    int
+	parents  []string
+	boundary bool
+}
+
+func newCommitGraph(runner shell.Runner, masterCommitHash string) (*commitGraph, error) {
+	// Format is:
+	//
+	//	<commit hash> <parent hashes separated by spaces>
+	//	-<boundary commit hash> <parent hashes separated by spaces>
+	lines, err := shell.RunAndCollectLinesWith(
+		runner,
+		shell.Opt{},
+		fmt.Sprintf(
+			"git rev-list --topo-order --parents --boundary --branches ^%s",
+			shellescape.Quote(masterCommitHash),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing commits not in master: %w", err)
+	}
+
+	graph := &commitGraph{commits: make(map[string]*graphCommit, len(lines))}
+	for i, line := range lines {
+		boundary := strings.HasPrefix(line, "-")
+		fields := strings.Fields(strings.TrimPrefix(line, "-"))
+		if len(fields) == 0 {
+			continue
+		}
+		graph.commits[fields[0]] = &graphCommit{
+			index:    i,
+			parents:  fields[1:],
+			boundary: boundary,
+		}
+	}
+	return graph, nil
+}
+
+// Returns true if the commit is reachable from a branch but not from master.
+func (g *commitGraph) isOutsideMaster(commitHash string) bool {
+	commit, ok := g.commits[commitHash]
+	return ok && !commit.boundary
+}
+
+func (g *commitGraph) isBoundary(commitHash string) bool {
+	commit, ok := g.commits[commitHash]
+	return ok && commit.boundary
+}
+
+// closestAncestor returns the most recent strict ancestor of the given commit (in topological order)
+// that is either a boundary commit or satisfies isCandidate.
+// Returns false if no such ancestor exists, e.g. for a branch with a history unrelated to master.
+func (g *commitGraph) closestAncestor(commitHash string, isCandidate func(string) bool) (string, bool) {
+	commit, ok := g.commits[commitHash]
+	if !ok {
+		return "", false
+	}
+
+	var closest *graphCommit
+	var closestHash string
+	visited := map[string]bool{commitHash: true}
+	toVisit := append([]string{}, commit.parents...)
+	for len(toVisit) > 0 {
+		hash := toVisit[len(toVisit)-1]
+		toVisit = toVisit[:len(toVisit)-1]
+		if visited[hash] {
+			continue
+		}
+		visited[hash] = true
+
+		ancestor, ok := g.commits[hash]
+		if !ok {
+			// Parent of a boundary commit.
+			continue
+		}
+		if ancestor.boundary || isCandidate(hash) {
+			// Anything further up is an ancestor of this commit, so it cannot be closer.
+			if closest == nil || ancestor.index < closest.index {
+				closest = ancestor
+				closestHash = hash
+			}
+			continue
+		}
+		toVisit = append(toVisit, ancestor.parents...)
+	}
+	return closestHash, closest != nil
+}
+
+// isAncestor returns true if the first commit is an ancestor of the second one, or the same commit.
+// Only commits outside of master are walked, which is enough to compare two such commits.
+func (g *commitGraph) isAncestor(ancestorHash string, descendantHash string) bool {
+	ancestor, ok := g.commits[ancestorHash]
+	if !ok {
+		return false
+	}
+	visited := make(map[string]bool)
+	toVisit := []string{descendantHash}
+	for len(toVisit) > 0 {
+		hash := toVisit[len(toVisit)-1]
+		toVisit = toVisit[:len(toVisit)-1]
+		if hash == ancestorHash {
+			return true
+		}
+		commit, ok := g.commits[hash]
+		// Commits are visited before their ancestors, so the ancestor cannot be further up.
+		if visited[hash] || !ok || commit.boundary || commit.index > ancestor.index {
+			continue
+		}
+		visited[hash] = true
+		toVisit = append(toVisit, commit.parents...)
+	}
+	return false
+}
+
+// Sorts the given commits, which must all be part of master's history, from most to least recent.
+func sortMasterAncestors(runner shell.Runner, masterCommitHash string, commitHashes []string) error {
+	if len(commitHashes) < 2 {
+		return nil
+	}
+
+	base, err := runner.Run(
+		shell.Opt{StripTrailingNewline: true},
+		fmt.Sprintf("git merge-base --octopus %s", strings.Join(commitHashes, " ")),
+	)
+	if err != nil {
+		return fmt.Errorf("finding common ancestor of master ancestors: %w", err)
+	}
+	lines, err := shell.RunAndCollectLinesWith(
+		runner,
+		shell.Opt{},
+		fmt.Sprintf(
+			"git rev-list --topo-order %s ^%s",
+			shellescape.Quote(masterCommitHash),
+			shellescape.Quote(base),
+		),
+	)
+	if err != nil {
+		return fmt.Errorf("listing master history: %w", err)
+	}
+
+	positions := make(map[string]int, len(lines)+1)
+	for i, line := range lines {
+		positions[line] = i
+	}
+	positions[base] = len(lines)
+	sort.SliceStable(commitHashes, func(i, j int) bool {
+		return positions[commitHashes[i]] < positions[commitHashes[j]]
+	})
+	return nil
+}
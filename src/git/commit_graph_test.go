@@ -0,0 +1,47 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/shell"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestCommitGraph(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	main := repo.Hash("main")
+	repo.CreateBranch("a")
+	a1 := repo.CommitFile("a.txt", "a\n", "a1")
+	a2 := repo.CommitFile("a.txt", "a2\n", "a2")
+	repo.Checkout("main")
+	repo.CreateBranch("b")
+	b1 := repo.CommitFile("b.txt", "b\n", "b1")
+	repo.Git("merge", "-q", "--no-edit", "a")
+	merge := repo.Hash("b")
+
+	graph, err := newCommitGraph(shell.BashRunner{}, main)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(graph.isOutsideMaster(a1)).To(BeTrue())
+	g.Expect(graph.isOutsideMaster(main)).To(BeFalse())
+	g.Expect(graph.isBoundary(main)).To(BeTrue())
+
+	g.Expect(graph.isAncestor(a1, merge)).To(BeTrue())
+	g.Expect(graph.isAncestor(b1, merge)).To(BeTrue())
+	g.Expect(graph.isAncestor(merge, merge)).To(BeTrue())
+	g.Expect(graph.isAncestor(b1, a2)).To(BeFalse())
+
+	// Both parents of a merge are walked.
+	isA1 := func(hash string) bool { return hash == a1 }
+	closest, ok := graph.closestAncestor(merge, isA1)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(closest).To(Equal(a1))
+	closest, ok = graph.closestAncestor(b1, isA1)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(closest).To(Equal(main))
+	_, ok = graph.closestAncestor(main, isA1)
+	g.Expect(ok).To(BeFalse())
+}
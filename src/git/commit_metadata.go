@@ -3,6 +3,7 @@ package git
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -34,8 +35,15 @@ type commitMetadata struct {
 }
 
 // Mutates the commitMetadata of each node in the given map.
-func populateCommitMetadata(commitHashToNode map[string]*TreeNode, masterBranch string) error {
-	revList, err := getRevList(lo.Keys(commitHashToNode))
+func populateCommitMetadata(
+	runner shell.Runner,
+	commitHashToNode map[string]*TreeNode,
+	masterBranch string,
+) error {
+	commitHashes := lo.Keys(commitHashToNode)
+	// Sorted so that the same repository always runs the same commands.
+	sort.Strings(commitHashes)
+	revList, err := getRevList(runner, commitHashes)
 	if err != nil {
 		return fmt.Errorf("getting rev list: %w", err)
 	}
@@ -74,9 +82,9 @@ func populateCommitMetadata(commitHashToNode map[string]*TreeNode, masterBranch
 //	<commit title>
 //	<multi-line commit body>
 //	__ENDBODY__
-func getRevList(commitHashes []string) ([]string, error) {
+func getRevList(runner shell.Runner, commitHashes []string) ([]string, error) {
 	prettyFormat := "%h%n%an%n%cr%n%ct%n%D%n%s%n%b%n" + endBodyMarker
-	lines, err := shell.RunAndCollectLines(shell.Opt{}, fmt.Sprintf(
+	lines, err := shell.RunAndCollectLinesWith(runner, shell.Opt{}, fmt.Sprintf(
 		// --no-walk=sorted limits the results to only the given commits.
 		// By default, `git rev-list`` includes all commits reachable from the given commits.
 		"git rev-list --pretty=format:%s %s --no-walk=sorted",
@@ -128,10 +136,11 @@ func newCommitMetadata(
 }
 
 func (cm *commitMetadata) CleanedBranchNames() []string {
+	hiddenPrefixes := cfg.AllHiddenBranchPrefixes()
 	return lo.Filter(cm.BranchNames, func(branchName string, _ int) bool {
-		return !strings.HasPrefix(branchName, "refs/branchless/") &&
-			!strings.HasPrefix(branchName, "origin/") &&
-			!strings.HasPrefix(branchName, "tag: ")
+		return !lo.SomeBy(hiddenPrefixes, func(prefix string) bool {
+			return strings.HasPrefix(branchName, prefix)
+		})
 	})
 }
 
@@ -163,7 +172,7 @@ func (cm *commitMetadata) PRURL() (string, string) {
 		// Suppress this error in case there are weird titles.
 		return "", ""
 	}
-	remoteURL, err := GetRemoteURL()
+	remoteURL, err := GetRemoteURL(cfg.BaseRemote)
 	if err != nil {
 		// Suppress this error in case there is no remote.
 		return "", ""
@@ -0,0 +1,11 @@
+package git
+
+import "github.com/yapaluc/hg-git/src/config"
+
+// Settings used by the git package, e.g. the remote to read the master branch from.
+var cfg = config.Default()
+
+// Configure sets the settings used by the git package. Called once the config is loaded.
+func Configure(c *config.Config) {
+	cfg = c
+}
@@ -20,27 +20,23 @@ func GetCurrentBranch() (string, error) {
 
 // https://stackoverflow.com/a/45560221
 func GetMasterBranch() (string, error) {
-	branch, err := shell.Run(
-		shell.Opt{},
-		`git branch -a | awk '/remotes\/origin\/HEAD/ {print $NF}'`,
+	out, err := shell.Run(
+		shell.Opt{SuppressStderrStreaming: true},
+		fmt.Sprintf("git symbolic-ref --short %s", shellescape.Quote(remoteHeadRef())),
 	)
-	if err != nil {
-		return "", fmt.Errorf("getting master branch name: %w", err)
-	}
-	candidateName := strings.TrimPrefix(strings.TrimSpace(branch), "origin/")
-	if candidateName == "" {
-		// https://stackoverflow.com/questions/28666357/how-to-get-default-git-branch#comment105620968_44750379
-		return "", fmt.Errorf(
-			"getting master branch name: remotes/origin/HEAD ref not found. try running `git remote set-head origin --auto` to sync the ref from upstream",
-		)
+	// git symbolic-ref fails if the ref doesn't exist.
+	candidateName := strings.TrimPrefix(strings.TrimSpace(out), cfg.BaseRemote+"/")
+	if err != nil || candidateName == "" {
+		return "", missingRemoteHeadError()
 	}
 	return candidateName, nil
 }
 
-func GetRemoteURL() (string, error) {
+// Returns the URL of the given remote, without the .git suffix.
+func GetRemoteURL(remote string) (string, error) {
 	remoteURL, err := shell.Run(
 		shell.Opt{},
-		"git config --get remote.origin.url",
+		fmt.Sprintf("git config --get %s", shellescape.Quote("remote."+remote+".url")),
 	)
 	if err != nil {
 		return "", fmt.Errorf("getting remote url: %w", err)
@@ -52,21 +48,23 @@ func GetRemoteURL() (string, error) {
 	return remoteURL, nil
 }
 
+// Returns the ref that points to the default branch of the base remote.
+func remoteHeadRef() string {
+	return "refs/remotes/" + cfg.BaseRemote + "/HEAD"
+}
+
+func missingRemoteHeadError() error {
+	// https://stackoverflow.com/questions/28666357/how-to-get-default-git-branch#comment105620968_44750379
+	return fmt.Errorf(
+		"getting master branch name: remotes/%s/HEAD ref not found. try running `git remote set-head %s --auto` to sync the ref from upstream",
+		cfg.BaseRemote,
+		cfg.BaseRemote,
+	)
+}
+
+// Resolves a revset that matches a single commit to its commit hash, e.g. ".^" for the parent branch.
 func ResolveRev(rev string) (string, error) {
-	if rev == ".^" {
-		// Find the previous branch.
-		repoData, err := NewRepoData()
-		if err != nil {
-			return "", err
-		}
-
-		currBranch, err := GetCurrentBranch()
-		if err != nil {
-			return "", err
-		}
-		rev = repoData.BranchNameToNode[currBranch].BranchParent.CommitMetadata.CommitHash
-	}
-	return rev, nil
+	return ResolveRevset(rev)
 }
 
 func ResolveCommitRef(commitRef string) (string, error) {
@@ -88,15 +86,17 @@ type branchNameResolution struct {
 	CommitHash string
 }
 
+// The rev can be any revset that matches a single commit.
 func ResolveBranchName(rev string, excludeBranch *string) (*branchNameResolution, error) {
-	if rev == "." {
-		rev = "HEAD"
+	commitHash, err := ResolveRevset(rev)
+	if err != nil {
+		return nil, err
 	}
 	branches, err := shell.RunAndCollectLines(
 		shell.Opt{},
 		fmt.Sprintf(
 			"git branch --points-at %s --format %s",
-			shellescape.Quote(rev),
+			shellescape.Quote(commitHash),
 			shellescape.Quote("%(refname:short)"),
 		),
 	)
@@ -109,10 +109,71 @@ func ResolveBranchName(rev string, excludeBranch *string) (*branchNameResolution
 		})
 	}
 	if len(branches) == 0 {
-		return &branchNameResolution{CommitHash: rev}, nil
+		return &branchNameResolution{CommitHash: commitHash}, nil
 	}
 	if len(branches) == 1 || !lo.Contains(branches, rev) {
 		return &branchNameResolution{BranchName: branches[0]}, nil
 	}
 	return &branchNameResolution{BranchName: rev}, nil
 }
+
+// Returns true if ancestorRef is an ancestor of (or the same commit as) descendantRef.
+func IsAncestor(ancestorRef string, descendantRef string) (bool, error) {
+	_, err := shell.Run(
+		shell.Opt{},
+		fmt.Sprintf(
+			"git merge-base --is-ancestor %s %s",
+			shellescape.Quote(ancestorRef),
+			shellescape.Quote(descendantRef),
+		),
+	)
+	if err == nil {
+		return true, nil
+	}
+	// git merge-base exits with code 1 if it is not an ancestor, and another code on failure.
+	if exitCode, ok := shell.ExitCode(err); ok && exitCode == 1 {
+		return false, nil
+	}
+	return false, fmt.Errorf("checking if %q is an ancestor of %q: %w", ancestorRef, descendantRef, err)
+}
+
+// Returns the commit hash of the given branch, or an empty string if the branch does not exist.
+func GetBranchCommitHash(branchName string) string {
+	commitHash, err := shell.Run(
+		shell.Opt{StripTrailingNewline: true},
+		fmt.Sprintf("git rev-parse --quiet --verify %s", shellescape.Quote("refs/heads/"+branchName)),
+	)
+	if err != nil {
+		return ""
+	}
+	return commitHash
+}
+
+// Returns the commit hash of the branch on the push remote as of the last fetch or push,
+// or an empty string if the branch was never pushed.
+func GetRemoteBranchCommitHash(branchName string) string {
+	commitHash, err := shell.Run(
+		shell.Opt{StripTrailingNewline: true},
+		fmt.Sprintf(
+			"git rev-parse --quiet --verify %s",
+			shellescape.Quote("refs/remotes/"+cfg.PushRemote+"/"+branchName),
+		),
+	)
+	if err != nil {
+		return ""
+	}
+	return commitHash
+}
+
+func IsMergeInProgress() bool {
+	_, err := shell.Run(shell.Opt{}, "git rev-parse --quiet --verify MERGE_HEAD")
+	return err == nil
+}
+
+func IsRebaseInProgress() bool {
+	_, err := shell.Run(
+		shell.Opt{},
+		`test -d "$(git rev-parse --git-path rebase-merge)" || test -d "$(git rev-parse --git-path rebase-apply)"`,
+	)
+	return err == nil
+}
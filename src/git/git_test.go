@@ -0,0 +1,37 @@
+package git
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/shell"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestIsAncestor_replaysExitCode(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+
+	recorder := shell.NewRecordingRunner(shell.BashRunner{})
+	restore := shell.SetDefaultRunner(recorder)
+	g.Expect(IsAncestor("a", "b")).To(BeTrue())
+	g.Expect(IsAncestor("b", "a")).To(BeFalse())
+	restore()
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	g.Expect(recorder.Save(path)).To(Succeed())
+	fixtures, err := shell.LoadFixtures(path)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	replay := shell.NewFakeRunner(fixtures...)
+	defer shell.SetDefaultRunner(replay)()
+	g.Expect(IsAncestor("a", "b")).To(BeTrue())
+	// git merge-base exits with code 1, which is not a failure.
+	g.Expect(IsAncestor("b", "a")).To(BeFalse())
+	g.Expect(replay.Unused()).To(BeEmpty())
+}
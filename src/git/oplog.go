@@ -0,0 +1,112 @@
+package git
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const oplogFileName = "oplog.json"
+
+// Oldest entries are dropped beyond this limit.
+const maxOplogEntries = 100
+
+// Oplog is the journal of stack-mutating operations, used by `hg undo` and `hg redo`.
+type Oplog struct {
+	Entries []*OplogEntry
+	// Number of entries that are currently applied.
+	// Entries from this position onwards have been undone and can be redone.
+	Position int
+}
+
+type OplogEntry struct {
+	ID        int
+	Command   string
+	Timestamp int64
+	Before    *RepoSnapshot
+	After     *RepoSnapshot
+}
+
+// ChangedBranches returns the branches that the operation changed.
+func (e *OplogEntry) ChangedBranches() []string {
+	return ChangedBranches(e.Before, e.After)
+}
+
+func LoadOplog() (*Oplog, error) {
+	path, err := getOplogPath()
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Oplog{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading oplog: %w", err)
+	}
+	var oplog Oplog
+	err = json.Unmarshal(content, &oplog)
+	if err != nil {
+		return nil, fmt.Errorf("decoding oplog %q: %w", path, err)
+	}
+	return &oplog, nil
+}
+
+func (o *Oplog) Save() error {
+	path, err := getOplogPath()
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(o)
+	if err != nil {
+		return fmt.Errorf("encoding oplog: %w", err)
+	}
+	err = os.WriteFile(path, content, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing oplog: %w", err)
+	}
+	return nil
+}
+
+// Record appends an operation to the journal.
+// Operations that were undone can no longer be redone after a new operation is recorded.
+func (o *Oplog) Record(command string, before *RepoSnapshot, after *RepoSnapshot) *OplogEntry {
+	id := 1
+	if len(o.Entries) > 0 {
+		id = o.Entries[len(o.Entries)-1].ID + 1
+	}
+	entry := &OplogEntry{
+		ID:        id,
+		Command:   command,
+		Timestamp: time.Now().Unix(),
+		Before:    before,
+		After:     after,
+	}
+	o.Entries = append(o.Entries[:o.Position], entry)
+	if len(o.Entries) > maxOplogEntries {
+		o.Entries = o.Entries[len(o.Entries)-maxOplogEntries:]
+	}
+	o.Position = len(o.Entries)
+	return entry
+}
+
+// Returns the index of the entry with the given ID, or -1 if not found.
+func (o *Oplog) IndexOf(id int) int {
+	for i, entry := range o.Entries {
+		if entry.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func getOplogPath() (string, error) {
+	dir, err := GetHgGitDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, oplogFileName), nil
+}
@@ -0,0 +1,41 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+)
+
+func TestOplogRecord_dropsUndoneEntries(t *testing.T) {
+	g := gomega.NewWithT(t)
+	oplog := &Oplog{}
+	for _, command := range []string{"amend", "rebase", "fold"} {
+		oplog.Record(command, &RepoSnapshot{}, &RepoSnapshot{})
+	}
+	g.Expect(oplog.Position).To(Equal(3))
+
+	// Undo the last two operations.
+	oplog.Position = 1
+	entry := oplog.Record("split", &RepoSnapshot{}, &RepoSnapshot{})
+
+	g.Expect(entry.ID).To(Equal(4))
+	g.Expect(oplog.Position).To(Equal(2))
+	g.Expect(oplog.Entries).To(HaveLen(2))
+	g.Expect(oplog.Entries[0].Command).To(Equal("amend"))
+	g.Expect(oplog.Entries[1]).To(Equal(entry))
+}
+
+func TestOplogRecord_dropsOldestEntriesBeyondLimit(t *testing.T) {
+	g := gomega.NewWithT(t)
+	oplog := &Oplog{}
+	for i := 0; i < maxOplogEntries+5; i++ {
+		oplog.Record("amend", &RepoSnapshot{}, &RepoSnapshot{})
+	}
+
+	g.Expect(oplog.Entries).To(HaveLen(maxOplogEntries))
+	g.Expect(oplog.Position).To(Equal(maxOplogEntries))
+	g.Expect(oplog.Entries[0].ID).To(Equal(6))
+	g.Expect(oplog.IndexOf(6)).To(Equal(0))
+	g.Expect(oplog.IndexOf(5)).To(Equal(-1))
+}
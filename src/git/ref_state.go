@@ -0,0 +1,119 @@
+package git
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/yapaluc/hg-git/src/shell"
+
+	"github.com/alessio/shellescape"
+	"github.com/samber/lo"
+)
+
+// refState is a snapshot of HEAD and every ref in the repository.
+// The branch graph and commit metadata can only change when the ref state changes.
+type refState struct {
+	headCommitHash string
+	// Full ref name of the current branch, or "HEAD" if detached.
+	headRef string
+	refs    []refEntry
+}
+
+type refEntry struct {
+	CommitHash string
+	RefName    string
+	// Target of a symbolic ref, e.g. refs/remotes/origin/HEAD -> refs/remotes/origin/main.
+	SymRef string
+}
+
+// Format is:
+//
+//	<HEAD commit hash>
+//	<HEAD symbolic ref, or "HEAD" if detached>
+//	<commit hash> <ref name> <symbolic ref target or empty>
+//	...
+func readRefState(runner shell.Runner) (*refState, error) {
+	out, err := runner.Run(
+		shell.Opt{StripTrailingNewline: true},
+		fmt.Sprintf(
+			"git rev-parse HEAD --symbolic-full-name HEAD && git for-each-ref --format=%s",
+			shellescape.Quote("%(objectname) %(refname) %(symref)"),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("reading refs: %w", err)
+	}
+
+	lines := strings.Split(out, "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("unexpected output when reading refs: %q", out)
+	}
+	state := &refState{
+		headCommitHash: lines[0],
+		headRef:        lines[1],
+	}
+	for _, line := range lines[2:] {
+		fields := strings.Split(line, " ")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected output from git for-each-ref: %q", line)
+		}
+		state.refs = append(state.refs, refEntry{
+			CommitHash: fields[0],
+			RefName:    fields[1],
+			SymRef:     fields[2],
+		})
+	}
+	return state, nil
+}
+
+// Returns the commit hash of each local branch, keyed by branch name.
+func (r *refState) branchCommitHashes() map[string]string {
+	branchNameToCommitHash := make(map[string]string)
+	for _, ref := range r.refs {
+		if branchName, ok := strings.CutPrefix(ref.RefName, "refs/heads/"); ok {
+			branchNameToCommitHash[branchName] = ref.CommitHash
+		}
+	}
+	return branchNameToCommitHash
+}
+
+// Returns the current branch name, or an empty string if HEAD is detached.
+func (r *refState) headBranch() string {
+	branchName, _ := strings.CutPrefix(r.headRef, "refs/heads/")
+	if branchName == r.headRef {
+		return ""
+	}
+	return branchName
+}
+
+// Equivalent to GetMasterBranch, without running another command.
+func (r *refState) masterBranch() (string, error) {
+	for _, ref := range r.refs {
+		if ref.RefName == remoteHeadRef() {
+			return strings.TrimPrefix(ref.SymRef, "refs/remotes/"+cfg.BaseRemote+"/"), nil
+		}
+	}
+	return "", missingRemoteHeadError()
+}
+
+// The cache key only covers the refs that the branch graph and commit metadata are computed from,
+// so that checking out another branch or stashing changes keeps the cache.
+// HEAD is applied when loading the repo data instead.
+// Tags are included since they are part of the decorations of commits.
+func (r *refState) cacheKey() string {
+	var sb strings.Builder
+	// The base remote determines the master branch.
+	sb.WriteString(cfg.BaseRemote + "\n")
+	for _, ref := range r.refs {
+		if !lo.SomeBy([]string{"refs/heads/", "refs/remotes/", "refs/tags/"}, func(prefix string) bool {
+			return strings.HasPrefix(ref.RefName, prefix)
+		}) {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%s %s %s\n", ref.CommitHash, ref.RefName, ref.SymRef))
+	}
+	sum := sha256.Sum256([]byte(sb.String()))
+	return hex.EncodeToString(sum[:])
+}
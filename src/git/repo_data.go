@@ -3,13 +3,13 @@ package git
 import (
 	"fmt"
 	"regexp"
-	"strings"
+	"sort"
 
 	"github.com/yapaluc/hg-git/src/shell"
 	"github.com/yapaluc/hg-git/src/util"
-)
 
-const branchGraphLimit = 29
+	"github.com/samber/lo"
+)
 
 type RepoData struct {
 	MasterBranch   string
@@ -17,12 +17,18 @@ type RepoData struct {
 	// Commit hash to node. Each node is unique.
 	CommitHashToNode map[string]*TreeNode
 	// Branch name to node. Nodes may be duplicated.
+	// Only local branches are keys. Nodes for ancestors of master have no branch name,
+	// and are found through CommitHashToNode and IsPartOfMaster instead.
 	BranchNameToNode map[string]*TreeNode
+
+	runner               shell.Runner
+	hasBranchDescription bool
 }
 
 type repoDataParams struct {
 	IncludeCommitMetadata    bool
 	IncludeBranchDescription bool
+	Runner                   shell.Runner
 }
 
 type RepoDataOption func(params *repoDataParams)
@@ -35,222 +41,270 @@ func RepoDataIncludeBranchDescription(params *repoDataParams) {
 	params.IncludeBranchDescription = true
 }
 
+// RepoDataWithRunner runs the git commands with the given runner instead of the default one.
+func RepoDataWithRunner(runner shell.Runner) RepoDataOption {
+	return func(params *repoDataParams) {
+		params.Runner = runner
+	}
+}
+
 func NewRepoData(opts ...RepoDataOption) (*RepoData, error) {
-	params := repoDataParams{}
+	params := repoDataParams{Runner: shell.DefaultRunner()}
 	for _, opt := range opts {
 		opt(&params)
 	}
-	repoData := &RepoData{
-		BranchRootNode: &TreeNode{
-			CommitMetadata: &commitMetadata{
-				CommitHash: "rootnode",
-			},
-			BranchChildren: make(map[string]*TreeNode),
-		},
-		CommitHashToNode: make(map[string]*TreeNode),
-		BranchNameToNode: make(map[string]*TreeNode),
-	}
-
-	// Find master branch.
-	masterBranch, err := GetMasterBranch()
+	// The state of all refs determines the branch graph, so it doubles as the cache key.
+	refs, err := readRefState(params.Runner)
 	if err != nil {
-		return nil, fmt.Errorf("getting master branch: %w", err)
+		return nil, err
 	}
-	repoData.MasterBranch = masterBranch
+	cacheKey := refs.cacheKey()
+	cache := loadRepoDataCache(params.Runner, cacheKey)
 
-	// Build branch graph.
-	err = repoData.buildBranchGraph()
-	if err != nil {
-		return nil, fmt.Errorf("building branch graph: %w", err)
+	repoData := newEmptyRepoData(params.Runner)
+	restoredFromCache := cache != nil && repoData.restoreFromCache(cache) == nil
+	hasCommitMetadata := restoredFromCache && cache.HasCommitMetadata
+
+	if !restoredFromCache {
+		// Start over in case a corrupted cache was partially restored.
+		repoData = newEmptyRepoData(params.Runner)
+
+		// Find master branch.
+		masterBranch, err := refs.masterBranch()
+		if err != nil {
+			return nil, fmt.Errorf("getting master branch: %w", err)
+		}
+		repoData.MasterBranch = masterBranch
+
+		// Build branch graph.
+		branchParents := loadBranchParents(params.Runner)
+		err = repoData.buildBranchGraph(refs.branchCommitHashes(), branchParents)
+		if err != nil {
+			return nil, fmt.Errorf("building branch graph: %w", err)
+		}
+		if !dryRun {
+			// Like the cache, the record of branch parents only helps detecting stale branches later on.
+			_ = repoData.updateBranchParents(branchParents)
+		}
 	}
 
 	// Add commit metadata.
-	if params.IncludeCommitMetadata {
+	if params.IncludeCommitMetadata && !hasCommitMetadata {
 		err = repoData.addCommitMetadata()
 		if err != nil {
 			return nil, fmt.Errorf("adding commit metadata: %w", err)
 		}
+		hasCommitMetadata = true
+	}
+
+	if !dryRun && (!restoredFromCache || hasCommitMetadata != cache.HasCommitMetadata) {
+		// The cache is only an optimization, so failing to write it is not an error.
+		_ = saveRepoDataCache(params.Runner, cacheKey, repoData, hasCommitMetadata)
+	}
+	// HEAD is not part of the cache key, so the checked out commit is marked after loading.
+	if hasCommitMetadata {
+		repoData.markHead(refs.headCommitHash)
 	}
 
 	// Add branch description.
 	if params.IncludeBranchDescription {
-		err = repoData.addBranchDescription()
+		err = repoData.ensureBranchDescription()
 		if err != nil {
-			return nil, fmt.Errorf("adding branch metadata: %w", err)
+			return nil, err
 		}
 	}
 
 	return repoData, nil
 }
 
+func newEmptyRepoData(runner shell.Runner) *RepoData {
+	return &RepoData{
+		BranchRootNode: &TreeNode{
+			CommitMetadata: &commitMetadata{
+				CommitHash: "rootnode",
+			},
+			BranchChildren: make(map[string]*TreeNode),
+		},
+		CommitHashToNode: make(map[string]*TreeNode),
+		BranchNameToNode: make(map[string]*TreeNode),
+		runner:           runner,
+	}
+}
+
 func (rd *RepoData) addCommitMetadata() error {
-	return populateCommitMetadata(rd.CommitHashToNode, rd.MasterBranch)
+	return populateCommitMetadata(rd.runner, rd.CommitHashToNode, rd.MasterBranch)
 }
 
-// NOTE: This only works for up to 29 branches. This is a limitation of `git show-branch`.
-func (rd *RepoData) buildBranchGraph() error {
-	branchLines, err := shell.RunAndCollectLines(
-		shell.Opt{},
-		"git branch",
-	)
-	if err != nil {
-		return fmt.Errorf("getting branch names: %w", err)
-	}
-	if len(branchLines) > branchGraphLimit {
-		return fmt.Errorf(
-			"cannot build branch graph because the number of branches exceeds the limit of `git show-branch` (%d)",
-			branchGraphLimit,
-		)
+func (rd *RepoData) markHead(headCommitHash string) {
+	for commitHash, node := range rd.CommitHashToNode {
+		node.CommitMetadata.IsHead = commitHash == headCommitHash
 	}
+}
 
-	// Find all the branches and their descendants.
-	// Explanation of git show-branch: https://wincent.com/wiki/Understanding_the_output_of_%22git_show-branch%22
-	output, err := shell.Run(
-		shell.Opt{},
-		"git show-branch --no-color",
-	)
-	output = strings.TrimSpace(output)
-	if err != nil {
-		return fmt.Errorf("getting branch data: %w", err)
+// buildBranchGraph links each branch to its branch parent: the closest ancestor commit
+// that is either the tip of another branch or part of master's history.
+// Commits on master's history that branches are based on get their own nodes,
+// which are chained below the master node from most to least recent.
+// A branch whose recorded parent branch has moved to a commit that is not an ancestor of it,
+// e.g. after commits were added to the parent with plain git, is linked to that parent and marked as stale.
+func (rd *RepoData) buildBranchGraph(
+	branchNameToCommitHash map[string]string,
+	branchParents map[string]branchParent,
+) error {
+	masterCommitHash, ok := branchNameToCommitHash[rd.MasterBranch]
+	if !ok {
+		return fmt.Errorf("master branch %q not found among local branches", rd.MasterBranch)
 	}
 
-	split := regexp.MustCompile(`(?m)^-+$`).Split(output, 2)
-
-	if len(split) == 1 {
-		// If there is only one branch, git changes the output format
-		// and omits the prelude and column indicator.
-		// Register a node for the branch and link it to the root node.
-		r := regexp.MustCompile(`^\[(?P<commitref>.+?)\] .*$`)
-		match, err := util.RegexNamedMatches(r, split[0])
-		if err != nil {
-			return fmt.Errorf("extracting short commit hash: %w", err)
-		}
-		node, err := rd.registerNode(match["commitref"])
-		if err != nil {
-			return fmt.Errorf("registering node for %q: %w", match["commitref"], err)
-		}
-		err = node.addBranchParent(rd.BranchRootNode)
-		if err != nil {
-			return fmt.Errorf("adding branch parent for %q: %w", match["commitref"], err)
-		}
-		return nil
+	// Register a node for each branch name.
+	commitHashToBranchNames := make(map[string][]string)
+	for branchName, commitHash := range branchNameToCommitHash {
+		rd.registerNode(branchName, commitHash)
+		commitHashToBranchNames[commitHash] = append(commitHashToBranchNames[commitHash], branchName)
 	}
-
-	prelude := strings.Split(strings.Trim(split[0], "\n"), "\n")
-	body := strings.Split(strings.Trim(split[1], "\n"), "\n")
-
-	// Find the position of each branch name and register a node for each branch name.
-	branchNameToPosition := make(map[string]int)
-	preludeRegex := regexp.MustCompile(`^\s*[*!]\s*\[(?P<branch>.*?)\] .*$`)
-	for i, line := range prelude {
-		match, err := util.RegexNamedMatches(preludeRegex, line)
-		if err != nil {
-			return fmt.Errorf("extracting branch name: %w", err)
-		}
-		branchNameToPosition[match["branch"]] = i
-
-		_, err = rd.registerNode(match["branch"])
-		if err != nil {
-			return fmt.Errorf("registering node for %q: %w", match["branch"], err)
-		}
+	for _, branchNames := range commitHashToBranchNames {
+		sort.Strings(branchNames)
 	}
+	branchCommitHashes := lo.Keys(rd.CommitHashToNode)
+	// Sorted so that the same repository always runs the same commands.
+	sort.Strings(branchCommitHashes)
+	isBranchTip := lo.SliceToMap(branchCommitHashes, func(commitHash string) (string, bool) {
+		return commitHash, true
+	})
 
-	// Process each branch to find its branch parent.
-	bodyLineRegex := regexp.MustCompile(`^(?P<markers>[\s*+-]*) \[(?P<commitref>.+?)\] .*$`)
-	for branchName, position := range branchNameToPosition {
-		// skip master branch - it is processed separately at the end
-		if branchName == rd.MasterBranch {
-			continue
-		}
+	graph, err := newCommitGraph(rd.runner, masterCommitHash)
+	if err != nil {
+		return fmt.Errorf("building commit graph: %w", err)
+	}
 
-		node := rd.BranchNameToNode[branchName]
-		foundBranchItself := false
-	innerLoop:
-		// traverse sequentially to find the first parent branch of the current branch
-		for _, line := range body {
-			match, err := util.RegexNamedMatches(bodyLineRegex, line)
-			if err != nil {
-				return fmt.Errorf("extracting markers and hash: %w", err)
-			}
-			commitRef := match["commitref"]
-			char := match["markers"][position]
-			// current line is not relevant to this branch
-			if char == ' ' {
+	// Returns the recorded parent branch of the given commit's branch and the commit of that parent
+	// it is based on, if the tip of the parent is no longer an ancestor of the branch.
+	// The ancestry checks walk the commit graph, which already lists every commit outside of master.
+	staleParent := func(commitHash string) (branchParent, bool) {
+		for _, branchName := range commitHashToBranchNames[commitHash] {
+			recorded, ok := branchParents[branchName]
+			if !ok {
 				continue
 			}
-			// skip the branch itself
-			if commitRef == branchName {
-				foundBranchItself = true
+			parentTip, ok := branchNameToCommitHash[recorded.BranchName]
+			if !ok || parentTip == commitHash || !graph.isOutsideMaster(parentTip) ||
+				graph.isAncestor(parentTip, commitHash) {
 				continue
 			}
-			if !foundBranchItself {
-				// do not pick anything until we passed the branch itself (this is for cases when a branch points at master)
-				continue
-			}
-			// pick master
-			if commitRef == rd.MasterBranch {
-				err = node.addBranchParent(rd.BranchNameToNode[rd.MasterBranch])
-				if err != nil {
-					return fmt.Errorf("adding branch parent for %q: %w", branchName, err)
+			base := recorded.BaseCommitHash
+			if base == commitHash || !graph.isOutsideMaster(base) || !graph.isAncestor(base, commitHash) {
+				base, ok = findFormerBranchTip(rd.runner, graph, recorded.BranchName, commitHash)
+				if !ok {
+					continue
 				}
-				break innerLoop
 			}
-			// pick an ancestor of master
-			if strings.HasPrefix(commitRef, rd.MasterBranch+"~") ||
-				strings.HasPrefix(commitRef, rd.MasterBranch+"^") {
-				// special case: create a node for an ancestor of master
-				parentNode, err := rd.registerNode(commitRef)
-				if err != nil {
-					return fmt.Errorf("registering node for %q: %w", commitRef, err)
-				}
-				parentNode.CommitMetadata.IsPartOfMaster = true
-				err = node.addBranchParent(parentNode)
-				if err != nil {
-					return fmt.Errorf("adding branch parent for %q: %w", branchName, err)
-				}
-				break innerLoop
-			}
-			// skip ancestors of other branches
-			if strings.Contains(commitRef, "~") || strings.Contains(commitRef, "^") {
+			// The branch was moved onto another branch since, e.g. with git rebase --onto.
+			closestHash, ok := graph.closestAncestor(commitHash, func(hash string) bool {
+				return isBranchTip[hash]
+			})
+			if ok && graph.isOutsideMaster(closestHash) && !graph.isAncestor(closestHash, base) {
 				continue
 			}
-			// else, must be another branch
-			err = node.addBranchParent(rd.BranchNameToNode[commitRef])
-			if err != nil {
-				return fmt.Errorf("adding branch parent for %q: %w", branchName, err)
-			}
-			break innerLoop
+			return branchParent{BranchName: recorded.BranchName, BaseCommitHash: base}, true
 		}
+		return branchParent{}, false
 	}
 
-	// finally, process master branch to connect relevant ancestors of master to the master node
-	node := rd.BranchNameToNode[rd.MasterBranch]
-	for _, line := range body {
-		match, err := util.RegexNamedMatches(bodyLineRegex, line)
+	var masterAncestorHashes []string
+	registerMasterAncestor := func(commitHash string) *TreeNode {
+		node := rd.registerCommit(commitHash)
+		if !node.CommitMetadata.IsPartOfMaster {
+			node.CommitMetadata.IsPartOfMaster = true
+			masterAncestorHashes = append(masterAncestorHashes, commitHash)
+		}
+		return node
+	}
+
+	// Links the branch of the given commit to the closest branch tip or master ancestor.
+	linkToClosestBranchTip := func(commitHash string) error {
+		parentHash, ok := graph.closestAncestor(commitHash, func(hash string) bool {
+			return isBranchTip[hash]
+		})
+		if !ok {
+			// Unrelated history. It is linked to the root node below.
+			return nil
+		}
+
+		var parentNode *TreeNode
+		switch {
+		case parentHash == masterCommitHash:
+			parentNode = rd.CommitHashToNode[masterCommitHash]
+		case graph.isBoundary(parentHash):
+			parentNode = registerMasterAncestor(parentHash)
+		default:
+			parentNode = rd.CommitHashToNode[parentHash]
+		}
+		err := rd.CommitHashToNode[commitHash].addBranchParent(parentNode)
 		if err != nil {
-			return fmt.Errorf("extracting markers and hash: %w", err)
+			return fmt.Errorf("adding branch parent for %q: %w", commitHash, err)
+		}
+		return nil
+	}
+
+	// Process each branch to find its branch parent.
+	staleParents := make(map[string]branchParent)
+	for _, commitHash := range branchCommitHashes {
+		if commitHash == masterCommitHash {
+			continue
 		}
-		commitRef := match["commitref"]
-		char := match["markers"][branchNameToPosition[rd.MasterBranch]]
-		// current line is not relevant to this branch
-		if char == ' ' {
+		// A branch that is not ahead of master is part of master's history.
+		if !graph.isOutsideMaster(commitHash) {
+			registerMasterAncestor(commitHash)
 			continue
 		}
-		// skip the branch itself
-		if commitRef == rd.MasterBranch {
+		if parent, ok := staleParent(commitHash); ok {
+			// Linked once the other branches are, to check that it does not create a cycle.
+			staleParents[commitHash] = parent
 			continue
 		}
-		// if ancestor has been registered, add it as branch parent
-		if masterAncestor, ok := rd.BranchNameToNode[commitRef]; ok {
-			err := node.addBranchParent(masterAncestor)
+		err = linkToClosestBranchTip(commitHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Link stale branches to the branch that they were based on, in a stable order.
+	staleCommitHashes := lo.Keys(staleParents)
+	sort.Strings(staleCommitHashes)
+	for _, commitHash := range staleCommitHashes {
+		staleParent := staleParents[commitHash]
+		parentNode := rd.CommitHashToNode[branchNameToCommitHash[staleParent.BranchName]]
+		node := rd.CommitHashToNode[commitHash]
+		if parentNode.hasAncestor(node) {
+			err = linkToClosestBranchTip(commitHash)
 			if err != nil {
-				return fmt.Errorf(
-					"adding branch parent for master or its ancestor: %w",
-					err,
-				)
+				return err
 			}
-			node = masterAncestor
+			continue
+		}
+		err = node.addBranchParent(parentNode)
+		if err != nil {
+			return fmt.Errorf("adding stale branch parent for %q: %w", commitHash, err)
 		}
+		node.StaleBaseCommitHash = staleParent.BaseCommitHash
+	}
+
+	// Connect the relevant ancestors of master to the master node, from most to least recent.
+	err = sortMasterAncestors(rd.runner, masterCommitHash, masterAncestorHashes)
+	if err != nil {
+		return fmt.Errorf("sorting ancestors of master: %w", err)
+	}
+	node := rd.CommitHashToNode[masterCommitHash]
+	for _, masterAncestorHash := range masterAncestorHashes {
+		masterAncestor := rd.CommitHashToNode[masterAncestorHash]
+		err := node.addBranchParent(masterAncestor)
+		if err != nil {
+			return fmt.Errorf(
+				"adding branch parent for master or its ancestor: %w",
+				err,
+			)
+		}
+		node = masterAncestor
 	}
 
 	// nodes with no branch parent should point at the root node
@@ -269,24 +323,51 @@ func (rd *RepoData) buildBranchGraph() error {
 	return nil
 }
 
-// commitRef is a branch name or a string parseable by `git rev-parse`.
-func (rd *RepoData) registerNode(commitRef string) (*TreeNode, error) {
-	commitHash, err := ResolveCommitRef(commitRef)
+// NodeForCommit returns the node of the commit in the branch graph.
+// Commits outside of the branch graph get a node without parent nor children.
+func (rd *RepoData) NodeForCommit(commitHash string) (*TreeNode, error) {
+	if node, ok := rd.CommitHashToNode[commitHash]; ok {
+		return node, nil
+	}
+	node := newTreeNodeWithCommitHash(commitHash)
+	err := populateCommitMetadata(rd.runner, map[string]*TreeNode{commitHash: node}, rd.MasterBranch)
 	if err != nil {
-		return nil, fmt.Errorf("resolving commit ref %q: %w", commitRef, err)
+		return nil, fmt.Errorf("getting metadata of commit %s: %w", commitHash, err)
 	}
+	return node, nil
+}
+
+func (rd *RepoData) registerNode(branchName string, commitHash string) *TreeNode {
+	node := rd.registerCommit(commitHash)
+	rd.BranchNameToNode[branchName] = node
+	return node
+}
 
+func (rd *RepoData) registerCommit(commitHash string) *TreeNode {
 	if _, ok := rd.CommitHashToNode[commitHash]; !ok {
 		// Create node with minimal commitMetadata.
 		// Node may exist already in case of multiple branches pointing at the same commit.
 		rd.CommitHashToNode[commitHash] = newTreeNodeWithCommitHash(commitHash)
 	}
-	rd.BranchNameToNode[commitRef] = rd.CommitHashToNode[commitHash]
-	return rd.CommitHashToNode[commitHash], nil
+	return rd.CommitHashToNode[commitHash]
+}
+
+// Adds the branch descriptions unless they were already added.
+func (rd *RepoData) ensureBranchDescription() error {
+	if rd.hasBranchDescription {
+		return nil
+	}
+	err := rd.addBranchDescription()
+	if err != nil {
+		return fmt.Errorf("adding branch metadata: %w", err)
+	}
+	rd.hasBranchDescription = true
+	return nil
 }
 
 func (rd *RepoData) addBranchDescription() error {
-	lines, err := shell.RunAndCollectLines(
+	lines, err := shell.RunAndCollectLinesWith(
+		rd.runner,
 		shell.Opt{},
 		`git config --get-regexp 'branch\.(.*)\.description'`,
 	)
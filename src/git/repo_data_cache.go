@@ -0,0 +1,143 @@
+package git
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/yapaluc/hg-git/src/shell"
+)
+
+const repoDataCacheFileName = "repo_data_cache.json"
+
+// Bump whenever the cached format or the way the branch graph is computed changes.
+const repoDataCacheVersion = 3
+
+// repoDataCache is the on-disk form of a RepoData.
+// It is only valid for the ref state it was computed from, identified by Key.
+// Branch descriptions live in git config and are not cached, and neither is HEAD.
+type repoDataCache struct {
+	Version           int
+	Key               string
+	MasterBranch      string
+	HasCommitMetadata bool
+	Nodes             []cachedNode
+	// Branch name to commit hash.
+	BranchNames map[string]string
+}
+
+type cachedNode struct {
+	CommitMetadata commitMetadata
+	// Commit hash of the branch parent.
+	BranchParent        string
+	StaleBaseCommitHash string
+}
+
+// Returns nil if there is no usable cache for the given key.
+// The cache is only an optimization, so any failure to read it is treated as a cache miss.
+func loadRepoDataCache(runner shell.Runner, key string) *repoDataCache {
+	path, err := getRepoDataCachePath(runner)
+	if err != nil {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var cache repoDataCache
+	err = json.Unmarshal(content, &cache)
+	if err != nil || cache.Version != repoDataCacheVersion || cache.Key != key {
+		return nil
+	}
+	return &cache
+}
+
+func saveRepoDataCache(runner shell.Runner, key string, rd *RepoData, hasCommitMetadata bool) error {
+	cache := repoDataCache{
+		Version:           repoDataCacheVersion,
+		Key:               key,
+		MasterBranch:      rd.MasterBranch,
+		HasCommitMetadata: hasCommitMetadata,
+		BranchNames:       make(map[string]string, len(rd.BranchNameToNode)),
+	}
+	for _, node := range rd.CommitHashToNode {
+		commitMetadata := *node.CommitMetadata
+		commitMetadata.BranchDescription = nil
+		commitMetadata.IsHead = false
+		cache.Nodes = append(cache.Nodes, cachedNode{
+			CommitMetadata:      commitMetadata,
+			BranchParent:        node.BranchParent.CommitMetadata.CommitHash,
+			StaleBaseCommitHash: node.StaleBaseCommitHash,
+		})
+	}
+	for branchName, node := range rd.BranchNameToNode {
+		cache.BranchNames[branchName] = node.CommitMetadata.CommitHash
+	}
+
+	content, err := json.Marshal(cache)
+	if err != nil {
+		return fmt.Errorf("encoding repo data cache: %w", err)
+	}
+	path, err := getRepoDataCachePath(runner)
+	if err != nil {
+		return err
+	}
+	// Write to a temp file first so that concurrent readers never see a partial file.
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, content, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing repo data cache: %w", err)
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return fmt.Errorf("renaming repo data cache: %w", err)
+	}
+	return nil
+}
+
+func (rd *RepoData) restoreFromCache(cache *repoDataCache) error {
+	rd.MasterBranch = cache.MasterBranch
+	for _, cachedNode := range cache.Nodes {
+		commitMetadata := cachedNode.CommitMetadata
+		rd.CommitHashToNode[commitMetadata.CommitHash] = &TreeNode{
+			CommitMetadata: &commitMetadata,
+			BranchChildren: make(map[string]*TreeNode),
+		}
+	}
+	for _, cachedNode := range cache.Nodes {
+		node := rd.CommitHashToNode[cachedNode.CommitMetadata.CommitHash]
+		node.StaleBaseCommitHash = cachedNode.StaleBaseCommitHash
+		parent, ok := rd.CommitHashToNode[cachedNode.BranchParent]
+		if !ok {
+			if cachedNode.BranchParent != rd.BranchRootNode.CommitMetadata.CommitHash {
+				return fmt.Errorf(
+					"missing branch parent %s of %s in repo data cache",
+					cachedNode.BranchParent,
+					node,
+				)
+			}
+			parent = rd.BranchRootNode
+		}
+		err := node.addBranchParent(parent)
+		if err != nil {
+			return fmt.Errorf("adding branch parent from repo data cache: %w", err)
+		}
+	}
+	for branchName, commitHash := range cache.BranchNames {
+		node, ok := rd.CommitHashToNode[commitHash]
+		if !ok {
+			return fmt.Errorf("missing node %s for branch %q in repo data cache", commitHash, branchName)
+		}
+		rd.BranchNameToNode[branchName] = node
+	}
+	return nil
+}
+
+func getRepoDataCachePath(runner shell.Runner) (string, error) {
+	dir, err := getHgGitDir(runner)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, repoDataCacheFileName), nil
+}
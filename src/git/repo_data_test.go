@@ -0,0 +1,229 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"github.com/yapaluc/hg-git/src/shell"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestNewRepoData_branchGraph(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.Checkout("a")
+	repo.CreateBranch("c")
+	repo.CommitFile("c.txt", "c\n", "c1")
+	repo.Checkout("main")
+	repo.CommitFile("main.txt", "main\n", "main2")
+
+	for _, attempt := range []string{"without cache", "with cache"} {
+		repoData, err := NewRepoData(RepoDataIncludeCommitMetadata, RepoDataIncludeBranchDescription)
+		g.Expect(err).ToNot(HaveOccurred(), attempt)
+
+		g.Expect(repoData.MasterBranch).To(Equal("main"), attempt)
+		a := repoData.BranchNameToNode["a"]
+		g.Expect(repoData.BranchNameToNode["b"].BranchParent).To(BeIdenticalTo(a), attempt)
+		g.Expect(repoData.BranchNameToNode["c"].BranchParent).To(BeIdenticalTo(a), attempt)
+		g.Expect(a.BranchParent.CommitMetadata.IsEffectiveMaster()).To(BeTrue(), attempt)
+		g.Expect(a.BranchChildren).To(HaveLen(2), attempt)
+		g.Expect(a.CommitMetadata.BranchDescription.Title).To(Equal("Title of a"), attempt)
+	}
+}
+
+func TestNewRepoData_staleBranch(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	oldA := repo.Hash("a")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	repo.CreateBranch("c")
+	repo.CommitFile("c.txt", "c\n", "c1")
+	// Records the branch parents, as any hg command would.
+	_, err := NewRepoData()
+	g.Expect(err).ToNot(HaveOccurred())
+	repo.Checkout("a")
+	repo.WriteFile("a.txt", "a2\n")
+	repo.Git("commit", "-q", "--all", "--amend", "--no-edit")
+
+	for _, attempt := range []string{"without cache", "with cache"} {
+		repoData, err := NewRepoData()
+		g.Expect(err).ToNot(HaveOccurred(), attempt)
+
+		a := repoData.BranchNameToNode["a"]
+		b := repoData.BranchNameToNode["b"]
+		c := repoData.BranchNameToNode["c"]
+		g.Expect(b.BranchParent).To(BeIdenticalTo(a), attempt)
+		g.Expect(b.IsStale()).To(BeTrue(), attempt)
+		g.Expect(b.BaseCommitHash()).To(Equal(oldA), attempt)
+		g.Expect(c.BranchParent).To(BeIdenticalTo(b), attempt)
+		g.Expect(c.IsStale()).To(BeFalse(), attempt)
+		g.Expect(a.IsStale()).To(BeFalse(), attempt)
+	}
+}
+
+func TestNewRepoData_replaysRecordedCommands(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+
+	recorder := shell.NewRecordingRunner(shell.BashRunner{})
+	recorded, err := NewRepoData(RepoDataIncludeCommitMetadata, RepoDataWithRunner(recorder))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// Replay without the cache, which would skip most commands.
+	hgGitDir, err := GetHgGitDir()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(os.RemoveAll(hgGitDir)).To(Succeed())
+	replay := shell.NewFakeRunner(recorder.Fixtures()...)
+	replayed, err := NewRepoData(RepoDataIncludeCommitMetadata, RepoDataWithRunner(replay))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(replay.Unused()).To(BeEmpty())
+	g.Expect(lo.Keys(replayed.BranchNameToNode)).To(ConsistOf(lo.Keys(recorded.BranchNameToNode)))
+	g.Expect(replayed.BranchNameToNode["b"].BranchParent.CommitMetadata.CommitHash).
+		To(Equal(repo.Hash("a")))
+	g.Expect(replayed.BranchNameToNode["b"].CommitMetadata.Title).To(Equal("b1"))
+}
+
+func TestNewRepoData_staleBranchWithoutReflog(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.Git("config", "core.logAllRefUpdates", "false")
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	oldA := repo.Hash("a")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	_, err := NewRepoData()
+	g.Expect(err).ToNot(HaveOccurred())
+	repo.Checkout("a")
+	repo.CommitFile("a.txt", "a2\n", "a2")
+	repo.Git("reflog", "expire", "--expire=now", "--all")
+
+	repoData, err := NewRepoData()
+	g.Expect(err).ToNot(HaveOccurred())
+	b := repoData.BranchNameToNode["b"]
+	g.Expect(b.BranchParent).To(BeIdenticalTo(repoData.BranchNameToNode["a"]))
+	g.Expect(b.IsStale()).To(BeTrue())
+	g.Expect(b.BaseCommitHash()).To(Equal(oldA))
+
+	// Stays stale with the same base after the parent moves again.
+	repo.CommitFile("a.txt", "a3\n", "a3")
+	repoData, err = NewRepoData()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(repoData.BranchNameToNode["b"].BaseCommitHash()).To(Equal(oldA))
+
+	// Not stale once moved off the parent with plain git.
+	repo.Git("rebase", "-q", "--onto", "main", oldA, "b")
+	repoData, err = NewRepoData()
+	g.Expect(err).ToNot(HaveOccurred())
+	b = repoData.BranchNameToNode["b"]
+	g.Expect(b.IsStale()).To(BeFalse())
+	g.Expect(b.BranchParent).To(BeIdenticalTo(repoData.BranchNameToNode["main"]))
+}
+
+func TestNewRepoData_cacheSurvivesCheckout(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	repo.CommitFile("b.txt", "b\n", "b1")
+	_, err := NewRepoData(RepoDataIncludeCommitMetadata)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	repo.Checkout("a")
+	recorder := shell.NewRecordingRunner(shell.BashRunner{})
+	repoData, err := NewRepoData(RepoDataIncludeCommitMetadata, RepoDataWithRunner(recorder))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// The branch graph and commit metadata come from the cache.
+	for _, fixture := range recorder.Fixtures() {
+		g.Expect(fixture.Command).ToNot(ContainSubstring("rev-list"))
+	}
+	g.Expect(repoData.BranchNameToNode["a"].CommitMetadata.IsHead).To(BeTrue())
+	g.Expect(repoData.BranchNameToNode["b"].CommitMetadata.IsHead).To(BeFalse())
+}
+
+func TestNewRepoData_masterAncestors(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	m1 := repo.Hash("main")
+	m2 := repo.CommitFile("main.txt", "m2\n", "m2")
+	repo.CommitFile("main.txt", "m3\n", "m3")
+	repo.Git("branch", "x", m1)
+	repo.Checkout("x")
+	repo.CommitFile("x.txt", "x\n", "x1")
+	repo.Git("branch", "y", m2)
+	repo.Git("branch", "z", m2)
+	repo.Checkout("y")
+	repo.CommitFile("y.txt", "y\n", "y1")
+
+	repoData, err := NewRepoData(RepoDataIncludeCommitMetadata)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// Ancestors of master that branches are based on are chained below master.
+	mainNode := repoData.BranchNameToNode["main"]
+	m2Node := mainNode.BranchParent
+	g.Expect(m2Node.CommitMetadata.CommitHash).To(Equal(m2))
+	g.Expect(m2Node.CommitMetadata.IsPartOfMaster).To(BeTrue())
+	m1Node := m2Node.BranchParent
+	g.Expect(m1Node.CommitMetadata.CommitHash).To(Equal(m1))
+	g.Expect(m1Node.BranchParent).To(BeIdenticalTo(repoData.BranchRootNode))
+
+	g.Expect(repoData.BranchNameToNode["x"].BranchParent).To(BeIdenticalTo(m1Node))
+	g.Expect(repoData.BranchNameToNode["y"].BranchParent).To(BeIdenticalTo(m2Node))
+	// A branch that is not ahead of master is an ancestor of master itself.
+	g.Expect(repoData.BranchNameToNode["z"]).To(BeIdenticalTo(m2Node))
+	// Ancestors of master are not keyed by a name such as main~1.
+	g.Expect(lo.Keys(repoData.BranchNameToNode)).To(ConsistOf("main", "x", "y", "z"))
+}
+
+func TestNewRepoData_manyBranches(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	// More than the 29 branches that git show-branch supports.
+	const numBranches = 40
+	for i := 0; i < numBranches; i++ {
+		branchName := fmt.Sprintf("b%02d", i)
+		repo.CreateBranch(branchName)
+		repo.CommitFile(branchName+".txt", branchName+"\n", branchName)
+	}
+
+	repoData, err := NewRepoData()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(repoData.BranchNameToNode).To(HaveLen(numBranches + 1))
+	g.Expect(repoData.BranchNameToNode["b00"].BranchParent).To(BeIdenticalTo(repoData.BranchNameToNode["main"]))
+	for i := 1; i < numBranches; i++ {
+		node := repoData.BranchNameToNode[fmt.Sprintf("b%02d", i)]
+		g.Expect(node.BranchParent).To(BeIdenticalTo(repoData.BranchNameToNode[fmt.Sprintf("b%02d", i-1)]))
+	}
+}
+
+func TestNewRepoData_unrelatedHistory(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.Git("checkout", "-q", "--orphan", "orphan")
+	repo.CommitFile("orphan.txt", "orphan\n", "orphan1")
+
+	repoData, err := NewRepoData()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(repoData.BranchNameToNode["orphan"].BranchParent).To(BeIdenticalTo(repoData.BranchRootNode))
+	g.Expect(repoData.BranchNameToNode["main"].BranchParent).To(BeIdenticalTo(repoData.BranchRootNode))
+}
@@ -0,0 +1,164 @@
+package git
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yapaluc/hg-git/src/shell"
+
+	"github.com/alessio/shellescape"
+	"github.com/samber/lo"
+)
+
+// RepoSnapshot captures the state that stack-mutating commands can change:
+// branch refs, HEAD and branch descriptions.
+type RepoSnapshot struct {
+	// Branch name to commit hash.
+	Branches map[string]string
+	// Current branch name. Empty if HEAD is detached.
+	HeadBranch     string
+	HeadCommitHash string
+	// Branch name to raw branch description.
+	BranchDescriptions map[string]string
+}
+
+func TakeRepoSnapshot() (*RepoSnapshot, error) {
+	refs, err := readRefState(shell.DefaultRunner())
+	if err != nil {
+		return nil, err
+	}
+	branchDescriptions, err := getRawBranchDescriptions()
+	if err != nil {
+		return nil, err
+	}
+	return &RepoSnapshot{
+		Branches:           refs.branchCommitHashes(),
+		HeadBranch:         refs.headBranch(),
+		HeadCommitHash:     refs.headCommitHash,
+		BranchDescriptions: branchDescriptions,
+	}, nil
+}
+
+// Returns a map of branch name to raw branch description.
+func getRawBranchDescriptions() (map[string]string, error) {
+	out, err := shell.Run(
+		shell.Opt{},
+		`git config -z --get-regexp '^branch\..*\.description$'`,
+	)
+	if err != nil {
+		// git config exits with code 1 if there are no branch descriptions
+		return map[string]string{}, nil
+	}
+
+	// Format is a sequence of NUL-terminated "<key>\n<value>" entries.
+	branchDescriptions := make(map[string]string)
+	for _, entry := range strings.Split(out, "\x00") {
+		key, value, ok := strings.Cut(entry, "\n")
+		if !ok {
+			continue
+		}
+		branchName := strings.TrimSuffix(strings.TrimPrefix(key, "branch."), ".description")
+		branchDescriptions[branchName] = value
+	}
+	return branchDescriptions, nil
+}
+
+// ChangedBranches returns the sorted names of the branches whose commit or description
+// differs between the two snapshots, including branches that only exist in one of them.
+func ChangedBranches(a *RepoSnapshot, b *RepoSnapshot) []string {
+	branchNames := lo.Uniq(lo.Flatten([][]string{
+		lo.Keys(a.Branches),
+		lo.Keys(b.Branches),
+		lo.Keys(a.BranchDescriptions),
+		lo.Keys(b.BranchDescriptions),
+	}))
+	changed := lo.Filter(branchNames, func(branchName string, _ int) bool {
+		return a.Branches[branchName] != b.Branches[branchName] ||
+			a.BranchDescriptions[branchName] != b.BranchDescriptions[branchName]
+	})
+	sort.Strings(changed)
+	return changed
+}
+
+// RestoreRepoSnapshot resets the given branches (commit and description) and HEAD to their state in the snapshot.
+// Branches that did not exist in the snapshot are deleted.
+// Other branches are left untouched so that unrelated changes made since the snapshot are preserved.
+func RestoreRepoSnapshot(snapshot *RepoSnapshot, branchNames []string) error {
+	out, err := shell.Run(shell.Opt{}, "git status --porcelain --untracked-files=no")
+	if err != nil {
+		return fmt.Errorf("checking for uncommitted changes: %w", err)
+	}
+	if strings.TrimSpace(out) != "" {
+		return fmt.Errorf(
+			"there are uncommitted changes. commit, stash or revert them before restoring the repo",
+		)
+	}
+
+	// Detach HEAD so that the current branch can be moved or deleted.
+	_, err = shell.Run(shell.Opt{}, "git switch --quiet --detach")
+	if err != nil {
+		return fmt.Errorf("detaching HEAD: %w", err)
+	}
+
+	// Move all branch refs in a single transaction.
+	var refUpdates []string
+	for _, branchName := range branchNames {
+		if commitHash, ok := snapshot.Branches[branchName]; ok {
+			refUpdates = append(refUpdates, fmt.Sprintf("update refs/heads/%s %s\n", branchName, commitHash))
+		} else {
+			refUpdates = append(refUpdates, fmt.Sprintf("delete refs/heads/%s\n", branchName))
+		}
+	}
+	if len(refUpdates) > 0 {
+		_, err = shell.Run(
+			shell.Opt{},
+			fmt.Sprintf(
+				"printf %%s %s | git update-ref --stdin",
+				shellescape.Quote(strings.Join(refUpdates, "")),
+			),
+		)
+		if err != nil {
+			return fmt.Errorf("updating branch refs: %w", err)
+		}
+	}
+
+	// Restore branch descriptions.
+	for _, branchName := range branchNames {
+		if description, ok := snapshot.BranchDescriptions[branchName]; ok {
+			_, err = shell.Run(
+				shell.Opt{},
+				fmt.Sprintf(
+					"git config branch.%s.description %s",
+					shellescape.Quote(branchName),
+					shellescape.Quote(description),
+				),
+			)
+			if err != nil {
+				return fmt.Errorf("restoring description of branch %q: %w", branchName, err)
+			}
+		} else {
+			// git config exits with code 5 if the description does not exist.
+			_, _ = shell.Run(
+				shell.Opt{},
+				fmt.Sprintf(
+					"git config --unset branch.%s.description",
+					shellescape.Quote(branchName),
+				),
+			)
+		}
+	}
+
+	// Restore HEAD.
+	var cmd string
+	if snapshot.HeadBranch != "" {
+		cmd = fmt.Sprintf("git switch --quiet %s", shellescape.Quote(snapshot.HeadBranch))
+	} else {
+		cmd = fmt.Sprintf("git switch --quiet --detach %s", shellescape.Quote(snapshot.HeadCommitHash))
+	}
+	_, err = shell.Run(shell.Opt{}, cmd)
+	if err != nil {
+		return fmt.Errorf("restoring HEAD: %w", err)
+	}
+	return nil
+}
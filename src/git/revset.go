@@ -0,0 +1,867 @@
+package git
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yapaluc/hg-git/src/github"
+	"github.com/yapaluc/hg-git/src/shell"
+
+	"github.com/alessio/shellescape"
+	"github.com/samber/lo"
+)
+
+// Revsets select commits with a subset of Mercurial's revset language, e.g. ".^", "stack() - ."
+// or "descendants(a) & draft()". Graph functions and operators walk the branch graph,
+// so ".^" is the parent branch rather than the parent commit.
+//
+// Operators, from lowest to highest precedence:
+//
+//	x | y, x + y, x or y    union
+//	x & y, x and y, x - y   intersection and difference
+//	not x, !x               complement
+//	x::y, x::, ::y          descendants of x that are ancestors of y
+//	x^, x~n                 parent branch, n-th ancestor branch
+//
+// Symbols are "." for the checked out commit, branch names and anything `git rev-parse` accepts.
+// Symbols may contain "-", so the difference operator needs spaces around it.
+//
+// The ^ and ~ operators only walk the branch graph after ".", a function or a parenthesized
+// expression, e.g. ".^" or "heads(stack())~1". After any other symbol they are passed to git,
+// so "HEAD~1" and "a^" are parent commits.
+
+// EvalRevset returns the commit hashes matching the revset, ancestors first.
+func (rd *RepoData) EvalRevset(expr string) ([]string, error) {
+	node, err := parseRevset(expr)
+	if err != nil {
+		// Names that are not valid revsets, such as branch names containing "+", are used as is.
+		if commitHash, symbolErr := resolveRevsetSymbol(rd.runner, expr); symbolErr == nil {
+			return []string{commitHash}, nil
+		}
+		return nil, fmt.Errorf("parsing revset %q: %w", expr, err)
+	}
+	e := &revsetEvaluator{rd: rd}
+	set, err := e.eval(node)
+	if err != nil {
+		return nil, fmt.Errorf("evaluating revset %q: %w", expr, err)
+	}
+	return rd.sortRevset(set), nil
+}
+
+// ResolveRevset returns the commit hash of a revset that matches exactly one commit.
+func (rd *RepoData) ResolveRevset(expr string) (string, error) {
+	commitHashes, err := rd.EvalRevset(expr)
+	if err != nil {
+		return "", err
+	}
+	switch len(commitHashes) {
+	case 0:
+		return "", fmt.Errorf("revset %q matches no commit", expr)
+	case 1:
+		return commitHashes[0], nil
+	default:
+		return "", fmt.Errorf("revset %q matches %d commits instead of one", expr, len(commitHashes))
+	}
+}
+
+// ResolveRevset resolves a revset that matches exactly one commit to its commit hash.
+// Plain symbols such as branch names are resolved without building the branch graph.
+func ResolveRevset(expr string) (string, error) {
+	node, err := parseRevset(expr)
+	if err != nil {
+		if commitHash, symbolErr := resolveRevsetSymbol(shell.DefaultRunner(), expr); symbolErr == nil {
+			return commitHash, nil
+		}
+		return "", fmt.Errorf("parsing revset %q: %w", expr, err)
+	}
+	if symbol, ok := node.(*revsetSymbol); ok {
+		return resolveRevsetSymbol(shell.DefaultRunner(), symbol.name)
+	}
+	repoData, err := NewRepoData()
+	if err != nil {
+		return "", err
+	}
+	return repoData.ResolveRevset(expr)
+}
+
+// Tokens.
+
+type revsetTokenKind int
+
+const (
+	revsetTokenSymbol revsetTokenKind = iota
+	revsetTokenString
+	revsetTokenOperator
+	revsetTokenEnd
+)
+
+type revsetToken struct {
+	kind  revsetTokenKind
+	value string
+	pos   int
+}
+
+var revsetOperators = []string{"::", "(", ")", ",", "^", "~", "|", "+", "&", "-", "!"}
+
+// "#" allows PR numbers such as pr(#123).
+func isRevsetSymbolStart(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("._@#", c)
+}
+
+func isRevsetSymbolChar(c rune) bool {
+	return isRevsetSymbolStart(c) || strings.ContainsRune("-/", c)
+}
+
+func tokenizeRevset(expr string) ([]revsetToken, error) {
+	var tokens []revsetToken
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != c; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				sb.WriteRune(runes[j])
+			}
+			if j == len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, revsetToken{kind: revsetTokenString, value: sb.String(), pos: i})
+			i = j + 1
+		case isRevsetSymbolStart(c):
+			j := i
+			for j < len(runes) && isRevsetSymbolChar(runes[j]) {
+				j++
+			}
+			value := string(runes[i:j])
+			if value == "re" && j < len(runes) && runes[j] == ':' {
+				// Unquoted patterns such as re:^feature/ run until the end of the argument.
+				j = endOfRevsetPattern(runes, j)
+				value = strings.TrimSpace(string(runes[i:j]))
+				tokens = append(tokens, revsetToken{kind: revsetTokenString, value: value, pos: i})
+			} else {
+				tokens = append(tokens, revsetToken{kind: revsetTokenSymbol, value: value, pos: i})
+			}
+			i = j
+		default:
+			op, ok := lo.Find(revsetOperators, func(op string) bool {
+				return strings.HasPrefix(string(runes[i:]), op)
+			})
+			if !ok {
+				return nil, fmt.Errorf("unexpected %q at position %d", c, i)
+			}
+			tokens = append(tokens, revsetToken{kind: revsetTokenOperator, value: op, pos: i})
+			i += len([]rune(op))
+		}
+	}
+	return append(tokens, revsetToken{kind: revsetTokenEnd, pos: len(runes)}), nil
+}
+
+// Returns the position of the "," or ")" that ends the function argument starting at start.
+func endOfRevsetPattern(runes []rune, start int) int {
+	depth := 0
+	for i := start; i < len(runes); i++ {
+		switch runes[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(runes)
+}
+
+// Syntax tree.
+
+type revsetNode interface{}
+
+// Symbol or string.
+type revsetSymbol struct {
+	name string
+}
+
+type revsetCall struct {
+	name string
+	args []revsetNode
+}
+
+type revsetBinary struct {
+	op    string
+	left  revsetNode
+	right revsetNode
+}
+
+type revsetNot struct {
+	operand revsetNode
+}
+
+// Either bound may be nil.
+type revsetRange struct {
+	from revsetNode
+	to   revsetNode
+}
+
+type revsetAncestor struct {
+	operand revsetNode
+	// Number of branches to go up.
+	n int
+}
+
+// Parser.
+
+type revsetParser struct {
+	tokens []revsetToken
+	pos    int
+}
+
+func parseRevset(expr string) (revsetNode, error) {
+	tokens, err := tokenizeRevset(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &revsetParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != revsetTokenEnd {
+		return nil, p.unexpected(tok)
+	}
+	return node, nil
+}
+
+func (p *revsetParser) peek() revsetToken {
+	return p.tokens[p.pos]
+}
+
+func (p *revsetParser) next() revsetToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != revsetTokenEnd {
+		p.pos++
+	}
+	return tok
+}
+
+// Consumes the next token if it is one of the given operators or keywords.
+func (p *revsetParser) accept(values ...string) (string, bool) {
+	tok := p.peek()
+	if (tok.kind == revsetTokenOperator || tok.kind == revsetTokenSymbol) && lo.Contains(values, tok.value) {
+		p.pos++
+		return tok.value, true
+	}
+	return "", false
+}
+
+func (p *revsetParser) unexpected(tok revsetToken) error {
+	if tok.kind == revsetTokenEnd {
+		return fmt.Errorf("unexpected end of revset")
+	}
+	return fmt.Errorf("unexpected %q at position %d", tok.value, tok.pos)
+}
+
+func (p *revsetParser) parseOr() (revsetNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("|", "+", "or"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &revsetBinary{op: "|", left: left, right: right}
+	}
+}
+
+func (p *revsetParser) parseAnd() (revsetNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("&", "and", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if op == "and" {
+			op = "&"
+		}
+		left = &revsetBinary{op: op, left: left, right: right}
+	}
+}
+
+func (p *revsetParser) parseNot() (revsetNode, error) {
+	if _, ok := p.accept("not", "!"); ok {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &revsetNot{operand: operand}, nil
+	}
+	return p.parseRange()
+}
+
+func (p *revsetParser) parseRange() (revsetNode, error) {
+	if _, ok := p.accept("::"); ok {
+		to, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		return &revsetRange{to: to}, nil
+	}
+	from, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.accept("::"); !ok {
+		return from, nil
+	}
+	if !p.startsOperand() {
+		return &revsetRange{from: from}, nil
+	}
+	to, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	return &revsetRange{from: from, to: to}, nil
+}
+
+// Returns true if the next token can start an operand, as opposed to ending a "x::" range.
+func (p *revsetParser) startsOperand() bool {
+	tok := p.peek()
+	switch tok.kind {
+	case revsetTokenString:
+		return true
+	case revsetTokenSymbol:
+		return !lo.Contains([]string{"and", "or"}, tok.value)
+	case revsetTokenOperator:
+		return tok.value == "("
+	}
+	return false
+}
+
+func (p *revsetParser) parsePostfix() (revsetNode, error) {
+	isGitSymbol := p.startsGitSymbol()
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("^", "~")
+		if !ok {
+			return node, nil
+		}
+		n := 1
+		number := ""
+		if tok := p.peek(); tok.kind == revsetTokenSymbol {
+			if parsed, err := strconv.Atoi(tok.value); err == nil {
+				p.next()
+				n = parsed
+				number = tok.value
+			}
+		}
+		// Only "." and revset functions walk the branch graph. Other symbols keep git's meaning,
+		// so HEAD~1 is the previous commit even when HEAD is a branch tip.
+		if symbol, ok := node.(*revsetSymbol); ok && isGitSymbol {
+			node = &revsetSymbol{name: symbol.name + op + number}
+			continue
+		}
+		if number == "" && op == "~" {
+			tok := p.peek()
+			return nil, fmt.Errorf("expected a number after \"~\" at position %d", tok.pos)
+		}
+		if op == "^" && n > 1 {
+			return nil, fmt.Errorf("^%d is not supported since a branch has a single parent branch", n)
+		}
+		node = &revsetAncestor{operand: node, n: n}
+	}
+}
+
+// Returns true if the next token is a symbol other than "." that is not a function call.
+func (p *revsetParser) startsGitSymbol() bool {
+	tok := p.peek()
+	switch tok.kind {
+	case revsetTokenString:
+		return true
+	case revsetTokenSymbol:
+		next := p.tokens[p.pos+1]
+		return tok.value != "." && (next.kind != revsetTokenOperator || next.value != "(")
+	}
+	return false
+}
+
+func (p *revsetParser) parsePrimary() (revsetNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case revsetTokenString:
+		return &revsetSymbol{name: tok.value}, nil
+	case revsetTokenSymbol:
+		if _, ok := p.accept("("); !ok {
+			return &revsetSymbol{name: tok.value}, nil
+		}
+		call := &revsetCall{name: tok.value}
+		if _, ok := p.accept(")"); ok {
+			return call, nil
+		}
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if _, ok := p.accept(")"); ok {
+				return call, nil
+			}
+			if _, ok := p.accept(","); !ok {
+				return nil, p.unexpected(p.peek())
+			}
+		}
+	case revsetTokenOperator:
+		if tok.value == "(" {
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.accept(")"); !ok {
+				return nil, p.unexpected(p.peek())
+			}
+			return node, nil
+		}
+	}
+	return nil, p.unexpected(tok)
+}
+
+// Evaluation.
+
+// Set of commit hashes.
+type commitSet map[string]bool
+
+type revsetEvaluator struct {
+	rd *RepoData
+}
+
+func (e *revsetEvaluator) eval(node revsetNode) (commitSet, error) {
+	switch n := node.(type) {
+	case *revsetSymbol:
+		commitHash, err := resolveRevsetSymbol(e.rd.runner, n.name)
+		if err != nil {
+			return nil, err
+		}
+		return commitSet{commitHash: true}, nil
+	case *revsetCall:
+		return e.evalCall(n)
+	case *revsetBinary:
+		left, err := e.eval(n.left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := e.eval(n.right)
+		if err != nil {
+			return nil, err
+		}
+		result := commitSet{}
+		for commitHash := range left {
+			if n.op == "|" || (n.op == "&") == right[commitHash] {
+				result[commitHash] = true
+			}
+		}
+		if n.op == "|" {
+			for commitHash := range right {
+				result[commitHash] = true
+			}
+		}
+		return result, nil
+	case *revsetNot:
+		operand, err := e.eval(n.operand)
+		if err != nil {
+			return nil, err
+		}
+		return e.filter(func(node *TreeNode) bool {
+			return !operand[node.CommitMetadata.CommitHash]
+		}), nil
+	case *revsetRange:
+		result := e.all()
+		if n.from != nil {
+			from, err := e.eval(n.from)
+			if err != nil {
+				return nil, err
+			}
+			result = intersect(result, e.descendants(from))
+		}
+		if n.to != nil {
+			to, err := e.eval(n.to)
+			if err != nil {
+				return nil, err
+			}
+			result = intersect(result, e.ancestors(to))
+		}
+		return result, nil
+	case *revsetAncestor:
+		operand, err := e.eval(n.operand)
+		if err != nil {
+			return nil, err
+		}
+		result := commitSet{}
+		for commitHash := range operand {
+			ancestor, err := e.nthAncestor(commitHash, n.n)
+			if err != nil {
+				return nil, err
+			}
+			result[ancestor] = true
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("unknown revset node %T", node)
+	}
+}
+
+func (e *revsetEvaluator) evalCall(call *revsetCall) (commitSet, error) {
+	// Evaluates the single argument of a function that takes a set.
+	setArg := func(defaultExpr string) (commitSet, error) {
+		switch {
+		case len(call.args) == 0 && defaultExpr != "":
+			return e.eval(&revsetSymbol{name: defaultExpr})
+		case len(call.args) != 1:
+			return nil, fmt.Errorf("%s() takes one argument", call.name)
+		}
+		return e.eval(call.args[0])
+	}
+	noArgs := func() error {
+		if len(call.args) != 0 {
+			return fmt.Errorf("%s() takes no arguments", call.name)
+		}
+		return nil
+	}
+
+	switch call.name {
+	case "all":
+		return e.all(), noArgs()
+	case "draft":
+		return e.filter(func(node *TreeNode) bool { return !e.isPublic(node) }), noArgs()
+	case "public":
+		return e.filter(e.isPublic), noArgs()
+	case "ancestors":
+		set, err := setArg("")
+		if err != nil {
+			return nil, err
+		}
+		return e.ancestors(set), nil
+	case "descendants":
+		set, err := setArg("")
+		if err != nil {
+			return nil, err
+		}
+		return e.descendants(set), nil
+	case "parents":
+		set, err := setArg("")
+		if err != nil {
+			return nil, err
+		}
+		result := commitSet{}
+		for commitHash := range set {
+			node, err := e.node(commitHash)
+			if err != nil {
+				return nil, err
+			}
+			if node.BranchParent != e.rd.BranchRootNode {
+				result[node.BranchParent.CommitMetadata.CommitHash] = true
+			}
+		}
+		return result, nil
+	case "children":
+		set, err := setArg("")
+		if err != nil {
+			return nil, err
+		}
+		result := commitSet{}
+		for commitHash := range set {
+			node, err := e.node(commitHash)
+			if err != nil {
+				return nil, err
+			}
+			for childHash := range node.BranchChildren {
+				result[childHash] = true
+			}
+		}
+		return result, nil
+	case "heads", "roots":
+		set, err := setArg("")
+		if err != nil {
+			return nil, err
+		}
+		result := commitSet{}
+		for commitHash := range set {
+			node, ok := e.rd.CommitHashToNode[commitHash]
+			if !ok {
+				result[commitHash] = true
+				continue
+			}
+			var isHeadOrRoot bool
+			if call.name == "heads" {
+				isHeadOrRoot = !lo.SomeBy(lo.Keys(node.BranchChildren), func(childHash string) bool {
+					return set[childHash]
+				})
+			} else {
+				isHeadOrRoot = !set[node.BranchParent.CommitMetadata.CommitHash]
+			}
+			if isHeadOrRoot {
+				result[commitHash] = true
+			}
+		}
+		return result, nil
+	case "stack":
+		set, err := setArg(".")
+		if err != nil {
+			return nil, err
+		}
+		result := commitSet{}
+		for commitHash := range set {
+			node, err := e.node(commitHash)
+			if err != nil {
+				return nil, err
+			}
+			if e.isPublic(node) {
+				continue
+			}
+			for !e.isPublic(node.BranchParent) && node.BranchParent != e.rd.BranchRootNode {
+				node = node.BranchParent
+			}
+			for commitHash := range e.descendants(commitSet{node.CommitMetadata.CommitHash: true}) {
+				result[commitHash] = true
+			}
+		}
+		return result, nil
+	case "bookmark":
+		if len(call.args) == 0 {
+			return e.bookmarks(func(string) bool { return true }), nil
+		}
+		pattern, err := e.stringArg(call)
+		if err != nil {
+			return nil, err
+		}
+		if re, ok := strings.CutPrefix(pattern, "re:"); ok {
+			r, err := regexp.Compile(re)
+			if err != nil {
+				return nil, fmt.Errorf("compiling bookmark pattern %q: %w", re, err)
+			}
+			return e.bookmarks(r.MatchString), nil
+		}
+		pattern = strings.TrimPrefix(pattern, "literal:")
+		result := e.bookmarks(func(branchName string) bool { return branchName == pattern })
+		if len(result) == 0 {
+			return nil, fmt.Errorf("bookmark %q does not exist", pattern)
+		}
+		return result, nil
+	case "pr":
+		arg, err := e.stringArg(call)
+		if err != nil {
+			return nil, err
+		}
+		prNum, ok := github.ParsePRNum(arg)
+		if !ok {
+			return nil, fmt.Errorf("pr() takes a PR number or URL, got %q", arg)
+		}
+		err = e.rd.ensureBranchDescription()
+		if err != nil {
+			return nil, err
+		}
+		return e.filter(func(node *TreeNode) bool {
+			prURL, _ := node.CommitMetadata.PRURL()
+			return prURL != "" && github.PRNumFromPRURL(prURL) == prNum
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown revset function %q", call.name)
+}
+
+// Returns the single argument of a function that takes a string, such as a pattern.
+func (e *revsetEvaluator) stringArg(call *revsetCall) (string, error) {
+	if len(call.args) != 1 {
+		return "", fmt.Errorf("%s() takes one argument", call.name)
+	}
+	symbol, ok := call.args[0].(*revsetSymbol)
+	if !ok {
+		return "", fmt.Errorf("%s() takes a string argument", call.name)
+	}
+	return symbol.name, nil
+}
+
+// All the nodes of the branch graph.
+func (e *revsetEvaluator) all() commitSet {
+	return e.filter(func(*TreeNode) bool { return true })
+}
+
+func (e *revsetEvaluator) filter(predicate func(node *TreeNode) bool) commitSet {
+	result := commitSet{}
+	for commitHash, node := range e.rd.CommitHashToNode {
+		if predicate(node) {
+			result[commitHash] = true
+		}
+	}
+	return result
+}
+
+func (e *revsetEvaluator) bookmarks(predicate func(branchName string) bool) commitSet {
+	result := commitSet{}
+	for branchName, node := range e.rd.BranchNameToNode {
+		if predicate(branchName) {
+			result[node.CommitMetadata.CommitHash] = true
+		}
+	}
+	return result
+}
+
+// Master and its ancestors.
+func (e *revsetEvaluator) isPublic(node *TreeNode) bool {
+	return node == e.rd.BranchNameToNode[e.rd.MasterBranch] || node.CommitMetadata.IsPartOfMaster
+}
+
+// Returns the node of a commit of the branch graph.
+func (e *revsetEvaluator) node(commitHash string) (*TreeNode, error) {
+	node, ok := e.rd.CommitHashToNode[commitHash]
+	if !ok {
+		return nil, fmt.Errorf("commit %s is not a branch nor part of master's history", commitHash)
+	}
+	return node, nil
+}
+
+// Includes the given commits.
+func (e *revsetEvaluator) ancestors(set commitSet) commitSet {
+	result := commitSet{}
+	for commitHash := range set {
+		result[commitHash] = true
+		node, ok := e.rd.CommitHashToNode[commitHash]
+		if !ok {
+			continue
+		}
+		for node = node.BranchParent; node != e.rd.BranchRootNode; node = node.BranchParent {
+			if result[node.CommitMetadata.CommitHash] {
+				break
+			}
+			result[node.CommitMetadata.CommitHash] = true
+		}
+	}
+	return result
+}
+
+// Includes the given commits.
+func (e *revsetEvaluator) descendants(set commitSet) commitSet {
+	result := commitSet{}
+	var dfs func(node *TreeNode)
+	dfs = func(node *TreeNode) {
+		if result[node.CommitMetadata.CommitHash] {
+			return
+		}
+		result[node.CommitMetadata.CommitHash] = true
+		for _, child := range node.BranchChildren {
+			dfs(child)
+		}
+	}
+	for commitHash := range set {
+		node, ok := e.rd.CommitHashToNode[commitHash]
+		if !ok {
+			result[commitHash] = true
+			continue
+		}
+		dfs(node)
+	}
+	return result
+}
+
+// Goes up n branches. Commits outside of the branch graph follow their first parent instead.
+func (e *revsetEvaluator) nthAncestor(commitHash string, n int) (string, error) {
+	node, ok := e.rd.CommitHashToNode[commitHash]
+	if !ok {
+		return resolveRevsetSymbol(e.rd.runner, fmt.Sprintf("%s~%d", commitHash, n))
+	}
+	for i := 0; i < n; i++ {
+		if node.BranchParent == e.rd.BranchRootNode {
+			return "", fmt.Errorf("commit %s has no parent branch", node.CommitMetadata.CommitHash)
+		}
+		node = node.BranchParent
+	}
+	return node.CommitMetadata.CommitHash, nil
+}
+
+func intersect(a commitSet, b commitSet) commitSet {
+	result := commitSet{}
+	for commitHash := range a {
+		if b[commitHash] {
+			result[commitHash] = true
+		}
+	}
+	return result
+}
+
+// Resolves "." to the checked out commit, and other symbols to the commit of the branch or git rev.
+func resolveRevsetSymbol(runner shell.Runner, name string) (string, error) {
+	rev := name
+	if rev == "." {
+		rev = "HEAD"
+	}
+	commitHash, err := runner.Run(
+		shell.Opt{StripTrailingNewline: true},
+		fmt.Sprintf("git rev-parse --quiet --verify %s", shellescape.Quote(rev+"^{commit}")),
+	)
+	if err != nil || commitHash == "" {
+		return "", fmt.Errorf("unknown revision %q", name)
+	}
+	return commitHash, nil
+}
+
+// Sorts the commits so that ancestors come before their descendants, then by commit time.
+// Commits outside of the branch graph come last.
+func (rd *RepoData) sortRevset(set commitSet) []string {
+	var sorted []string
+	var dfs func(node *TreeNode)
+	dfs = func(node *TreeNode) {
+		if set[node.CommitMetadata.CommitHash] {
+			sorted = append(sorted, node.CommitMetadata.CommitHash)
+		}
+		children := lo.Values(node.BranchChildren)
+		sort.Slice(children, func(i, j int) bool {
+			a := children[i].CommitMetadata
+			b := children[j].CommitMetadata
+			if a.Timestamp != b.Timestamp {
+				return a.Timestamp < b.Timestamp
+			}
+			return a.CommitHash < b.CommitHash
+		})
+		for _, child := range children {
+			dfs(child)
+		}
+	}
+	dfs(rd.BranchRootNode)
+
+	var outside []string
+	for commitHash := range set {
+		if _, ok := rd.CommitHashToNode[commitHash]; !ok {
+			outside = append(outside, commitHash)
+		}
+	}
+	sort.Strings(outside)
+	return append(sorted, outside...)
+}
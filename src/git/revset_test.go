@@ -0,0 +1,125 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/testutil"
+)
+
+func TestParseRevset(t *testing.T) {
+	g := gomega.NewWithT(t)
+	for expr, expected := range map[string]revsetNode{
+		".^":          &revsetAncestor{operand: &revsetSymbol{name: "."}, n: 1},
+		".~2":         &revsetAncestor{operand: &revsetSymbol{name: "."}, n: 2},
+		"feature/a-b": &revsetSymbol{name: "feature/a-b"},
+		"a - b":       &revsetBinary{op: "-", left: &revsetSymbol{name: "a"}, right: &revsetSymbol{name: "b"}},
+		"a | b & c": &revsetBinary{
+			op:    "|",
+			left:  &revsetSymbol{name: "a"},
+			right: &revsetBinary{op: "&", left: &revsetSymbol{name: "b"}, right: &revsetSymbol{name: "c"}},
+		},
+		"not a and b": &revsetBinary{
+			op:    "&",
+			left:  &revsetNot{operand: &revsetSymbol{name: "a"}},
+			right: &revsetSymbol{name: "b"},
+		},
+		"a::b": &revsetRange{from: &revsetSymbol{name: "a"}, to: &revsetSymbol{name: "b"}},
+		"a:: - a": &revsetBinary{
+			op:    "-",
+			left:  &revsetRange{from: &revsetSymbol{name: "a"}},
+			right: &revsetSymbol{name: "a"},
+		},
+		"::.":     &revsetRange{to: &revsetSymbol{name: "."}},
+		"stack()": &revsetCall{name: "stack"},
+		"children(.^)": &revsetCall{
+			name: "children",
+			args: []revsetNode{&revsetAncestor{operand: &revsetSymbol{name: "."}, n: 1}},
+		},
+		"bookmark(re:^feat(ure)?/)": &revsetCall{
+			name: "bookmark",
+			args: []revsetNode{&revsetSymbol{name: "re:^feat(ure)?/"}},
+		},
+		`bookmark("not")`: &revsetCall{name: "bookmark", args: []revsetNode{&revsetSymbol{name: "not"}}},
+		"HEAD~1":          &revsetSymbol{name: "HEAD~1"},
+		"a^^":             &revsetSymbol{name: "a^^"},
+		"a^2~":            &revsetSymbol{name: "a^2~"},
+		"(a)^":            &revsetAncestor{operand: &revsetSymbol{name: "a"}, n: 1},
+		"stack()~2":       &revsetAncestor{operand: &revsetCall{name: "stack"}, n: 2},
+		"(a | b)^": &revsetAncestor{
+			operand: &revsetBinary{op: "|", left: &revsetSymbol{name: "a"}, right: &revsetSymbol{name: "b"}},
+			n:       1,
+		},
+	} {
+		node, err := parseRevset(expr)
+		g.Expect(err).ToNot(HaveOccurred(), expr)
+		g.Expect(node).To(Equal(expected), expr)
+	}
+
+	for _, expr := range []string{"", "a |", "(a", "a b", "f(a,)", ".~", ".^2", "'a", "a # b"} {
+		_, err := parseRevset(expr)
+		g.Expect(err).To(HaveOccurred(), expr)
+	}
+}
+
+func TestEvalRevset(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := testutil.NewRepo(t)
+	repo.CreateBranch("a")
+	a := repo.CommitFile("a.txt", "a\n", "a1")
+	repo.CreateBranch("b")
+	b := repo.CommitFile("b.txt", "b\n", "b1")
+	repo.CreateBranch("c")
+	c := repo.CommitFile("c.txt", "c\n", "c1")
+	repo.Checkout("a")
+	repo.CreateBranch("feature/d")
+	d := repo.CommitFile("d.txt", "d\n", "d1")
+	repo.SetBranchDescription("feature/d", "Title of d", "Description of d\n\nPR: "+testutil.FakeRepoURL+"/pull/42")
+	repo.Checkout("main")
+	repo.CreateBranch("e")
+	e := repo.CommitFile("e.txt", "e\n", "e1")
+	repo.Checkout("b")
+	main := repo.Hash("main")
+
+	repoData, err := NewRepoData(RepoDataIncludeCommitMetadata)
+	g.Expect(err).ToNot(HaveOccurred())
+	for expr, expected := range map[string][]string{
+		".":                       {b},
+		".^":                      {a},
+		".~2":                     {main},
+		"b^ | c":                  {a, c},
+		"children(a)":             {b, d},
+		"descendants(a) - a":      {b, c, d},
+		"a::c":                    {a, b, c},
+		"::b & draft()":           {a, b},
+		"stack()":                 {a, b, c, d},
+		"stack(e)":                {e},
+		"heads(stack())":          {c, d},
+		"roots(draft())":          {a, e},
+		"draft() and not stack()": {e},
+		"public()":                {main},
+		"bookmark(re:^feature/)":  {d},
+		"bookmark(c)":             {c},
+		"pr(42)":                  {d},
+		"pr(#42) | pr(7)":         {d},
+		"parents(c | feature/d)":  {a, b},
+		b[:7]:                     {b},
+		"HEAD":                    {b},
+	} {
+		// Siblings are ordered by commit time, which is the same for all the commits of the test.
+		g.Expect(repoData.EvalRevset(expr)).To(ConsistOf(expected), expr)
+	}
+	// Ancestors come first.
+	g.Expect(repoData.EvalRevset("c | a | main | b")).To(Equal([]string{main, a, b, c}))
+
+	for _, expr := range []string{"unknown", "bookmark(x)", "foo()", "main^^", "stack(1, 2)"} {
+		_, err := repoData.EvalRevset(expr)
+		g.Expect(err).To(HaveOccurred(), expr)
+	}
+
+	g.Expect(ResolveRevset("c^")).To(Equal(b))
+	g.Expect(ResolveRevset("a")).To(Equal(a))
+	_, err = ResolveRevset("children(a)")
+	g.Expect(err).To(MatchError(ContainSubstring("matches 2 commits")))
+}
@@ -0,0 +1,41 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/yapaluc/hg-git/src/shell"
+)
+
+const hgGitDirName = "hg-git"
+
+// Set during a dry run, when the caches under the hg-git directory are not written either.
+var dryRun bool
+
+// SetDryRun is called when a dry run starts and stops.
+func SetDryRun(enabled bool) {
+	dryRun = enabled
+}
+
+// GetHgGitDir returns the absolute path of the directory where hg-git persists its own state,
+// creating it if needed. The directory lives inside the git directory and is shared by all worktrees.
+func GetHgGitDir() (string, error) {
+	return getHgGitDir(shell.DefaultRunner())
+}
+
+func getHgGitDir(runner shell.Runner) (string, error) {
+	gitDir, err := runner.Run(
+		shell.Opt{StripTrailingNewline: true},
+		"git rev-parse --path-format=absolute --git-common-dir",
+	)
+	if err != nil {
+		return "", fmt.Errorf("getting git directory: %w", err)
+	}
+	dir := filepath.Join(gitDir, hgGitDirName)
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return "", fmt.Errorf("creating directory %q: %w", dir, err)
+	}
+	return dir, nil
+}
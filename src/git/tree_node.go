@@ -6,6 +6,22 @@ type TreeNode struct {
 	CommitMetadata *commitMetadata
 	BranchParent   *TreeNode
 	BranchChildren map[string]*TreeNode
+	// Set if the tip of the branch parent is not an ancestor of the branch, e.g. after committing to
+	// or pulling into the parent branch with plain git. This is the former tip of the parent that the branch is based on.
+	StaleBaseCommitHash string
+}
+
+// IsStale returns true if the branch needs to be restacked on its branch parent.
+func (t *TreeNode) IsStale() bool {
+	return t.StaleBaseCommitHash != ""
+}
+
+// BaseCommitHash returns the commit of the branch parent that the branch is based on.
+func (t *TreeNode) BaseCommitHash() string {
+	if t.IsStale() {
+		return t.StaleBaseCommitHash
+	}
+	return t.BranchParent.CommitMetadata.CommitHash
 }
 
 func (t *TreeNode) String() string {
@@ -27,6 +43,16 @@ func (t *TreeNode) addBranchParent(parent *TreeNode) error {
 	return nil
 }
 
+// Returns true if the given node is this node or one of its branch ancestors.
+func (t *TreeNode) hasAncestor(node *TreeNode) bool {
+	for ; t != nil; t = t.BranchParent {
+		if t == node {
+			return true
+		}
+	}
+	return false
+}
+
 func newTreeNodeWithCommitHash(commitHash string) *TreeNode {
 	return &TreeNode{
 		CommitMetadata: &commitMetadata{CommitHash: commitHash},
@@ -0,0 +1,262 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/yapaluc/hg-git/src/shell"
+
+	"github.com/alessio/shellescape"
+)
+
+const pullRequestRequestFields = "url,number,state,title,baseRefName,headRefName,headRepositoryOwner,body"
+
+var baseBranchNotFoundRegexp = regexp.MustCompile("Proposed base branch '.+' was not found")
+
+// cliClient shells out to the gh CLI, which handles auth and repo resolution itself.
+type cliClient struct {
+	runner shell.Runner
+	// Repository of the PRs, or nil to let gh pick it from the git remotes.
+	repo      *Repo
+	headOwner string
+}
+
+// NewCLIClient returns a client that runs the gh CLI with the given runner.
+// If repo is nil, gh picks the repository from the git remotes.
+// headOwner is the owner of the fork that head branches are pushed to, or empty if they are
+// pushed to the repository itself.
+func NewCLIClient(runner shell.Runner, repo *Repo, headOwner string) Client {
+	return &cliClient{runner: runner, repo: repo, headOwner: headOwner}
+}
+
+func (c *cliClient) FetchPRForBranch(branchName string) (*PullRequest, error) {
+	out, err := c.runner.Run(
+		shell.Opt{},
+		fmt.Sprintf(
+			"gh pr list%s -s open -H %s --json %s",
+			c.repoFlag(),
+			shellescape.Quote(branchName),
+			pullRequestRequestFields,
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("calling gh CLI: %w", err)
+	}
+
+	var resp []PullRequest
+	err = json.Unmarshal([]byte(out), &resp)
+	if err != nil {
+		return nil, fmt.Errorf("decoding JSON from gh CLI: %w", err)
+	}
+	// gh cannot filter by the owner of the head branch.
+	for _, pr := range resp {
+		if pr.isFromHeadOwner(c.headOwner) {
+			pr.Body = strings.ReplaceAll(pr.Body, "\r\n", "\n")
+			return &pr, nil
+		}
+	}
+	// No PR.
+	return nil, nil
+}
+
+func (c *cliClient) FetchPRByNum(prNum int) (*PullRequest, error) {
+	return c.FetchPRByURLOrNum(fmt.Sprintf("%d", prNum))
+}
+
+func (c *cliClient) FetchPRByURLOrNum(prURLOrNum string) (*PullRequest, error) {
+	out, err := c.runner.Run(
+		shell.Opt{},
+		fmt.Sprintf(
+			"gh pr view %s%s --json %s",
+			shellescape.Quote(prURLOrNum),
+			c.repoFlag(),
+			pullRequestRequestFields,
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("calling gh CLI: %w", err)
+	}
+
+	var resp PullRequest
+	err = json.Unmarshal([]byte(out), &resp)
+	if err != nil {
+		return nil, fmt.Errorf("decoding JSON from gh CLI: %w", err)
+	}
+	resp.Body = strings.ReplaceAll(resp.Body, "\r\n", "\n")
+	return &resp, nil
+}
+
+func (c *cliClient) FetchPRs(
+	branchNames []string,
+	prNums []int,
+) (map[string]*PullRequest, map[int]*PullRequest, error) {
+	if len(branchNames) == 0 && len(prNums) == 0 {
+		return map[string]*PullRequest{}, map[int]*PullRequest{}, nil
+	}
+	query, variables := buildPRsQuery(branchNames, prNums)
+	out, err := c.graphql(query, variables)
+	// gh exits with an error if the response has errors, which may only be PRs not found.
+	prsByBranch, prsByNum, parseErr := parsePRsResponse([]byte(out), branchNames, prNums, c.headOwner)
+	if parseErr != nil {
+		if err != nil {
+			return nil, nil, fmt.Errorf("calling gh CLI: %w", err)
+		}
+		return nil, nil, fmt.Errorf("fetching PRs: %w", parseErr)
+	}
+	return prsByBranch, prsByNum, nil
+}
+
+func (c *cliClient) FetchPRStatuses(prNums []int) (map[int]*PRStatus, error) {
+	if len(prNums) == 0 {
+		return map[int]*PRStatus{}, nil
+	}
+	out, err := c.graphql(buildPRStatusesQuery(prNums), nil)
+	// gh exits with an error if the response has errors, which may only be PRs not found.
+	statuses, parseErr := parsePRStatusesResponse([]byte(out), prNums)
+	if parseErr != nil {
+		if err != nil {
+			return nil, fmt.Errorf("calling gh CLI: %w", err)
+		}
+		return nil, fmt.Errorf("fetching PR statuses: %w", parseErr)
+	}
+	return statuses, nil
+}
+
+// Runs a GraphQL query on the repository, passed as the $owner and $name variables.
+func (c *cliClient) graphql(query string, variables map[string]string) (string, error) {
+	// With -F, gh replaces {owner} and {repo} with the current repository.
+	repoFlag, owner, name := "-F", "{owner}", "{repo}"
+	if c.repo != nil {
+		repoFlag, owner, name = "-f", c.repo.Owner, c.repo.Name
+	}
+	args := []string{
+		"-f", shellescape.Quote("query=" + query),
+		repoFlag, shellescape.Quote("owner=" + owner),
+		repoFlag, shellescape.Quote("name=" + name),
+	}
+	for name, value := range variables {
+		args = append(args, "-f", shellescape.Quote(name+"="+value))
+	}
+	return c.runner.Run(
+		shell.Opt{SuppressStderrStreaming: true},
+		fmt.Sprintf("gh api graphql %s", strings.Join(args, " ")),
+	)
+}
+
+func (c *cliClient) CreatePR(opts CreatePROpts) (*PullRequest, error) {
+	args := []string{
+		"--head",
+		shellescape.Quote(qualifiedHead(c.headOwner, opts.Head)),
+		"--title",
+		shellescape.Quote(opts.Title),
+		"--body",
+		shellescape.Quote(opts.Body),
+	}
+	if opts.Base != "" {
+		args = append(args, "--base", shellescape.Quote(opts.Base))
+	}
+	if opts.Draft {
+		args = append(args, "--draft")
+	}
+
+	prURL, err := c.runner.Run(
+		shell.Opt{StripTrailingNewline: true},
+		fmt.Sprintf("gh pr create%s %s", c.repoFlag(), strings.Join(args, " ")),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("calling gh CLI: %w", err)
+	}
+	// gh only prints the URL of the new PR.
+	return &PullRequest{
+		BaseRefName:         opts.Base,
+		HeadRefName:         opts.Head,
+		HeadRepositoryOwner: RepositoryOwner{Login: c.headOwner},
+		State:               "OPEN",
+		URL:                 prURL,
+		Number:              PRNumFromPRURL(prURL),
+		Title:               opts.Title,
+		Body:                opts.Body,
+	}, nil
+}
+
+func (c *cliClient) EditPR(prNum int, opts EditPROpts) error {
+	var args []string
+	if opts.Base != nil {
+		args = append(args, "--base", shellescape.Quote(*opts.Base))
+	}
+	if opts.Title != nil {
+		args = append(args, "--title", shellescape.Quote(*opts.Title))
+	}
+	if opts.Body != nil {
+		args = append(args, "--body", shellescape.Quote(*opts.Body))
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	out, err := c.runner.Run(
+		shell.Opt{CombinedStdoutStderrOutput: true},
+		fmt.Sprintf("gh pr edit %d%s %s", prNum, c.repoFlag(), strings.Join(args, " ")),
+	)
+	if err != nil {
+		if baseBranchNotFoundRegexp.MatchString(out) {
+			return fmt.Errorf("editing PR %d: %w: %w", prNum, ErrBaseBranchNotFound, err)
+		}
+		return fmt.Errorf("calling gh CLI: %w: %s", err, out)
+	}
+	return nil
+}
+
+func (c *cliClient) MergePR(prNum int, method MergeMethod) error {
+	out, err := c.runner.Run(
+		shell.Opt{CombinedStdoutStderrOutput: true},
+		fmt.Sprintf("gh pr merge %d%s --%s", prNum, c.repoFlag(), method),
+	)
+	if err != nil {
+		return fmt.Errorf("calling gh CLI: %w: %s", err, out)
+	}
+	return nil
+}
+
+func (c *cliClient) ClosePR(prNum int, comment string) error {
+	cmdStr := fmt.Sprintf("gh pr close %d%s", prNum, c.repoFlag())
+	if comment != "" {
+		cmdStr += " --comment " + shellescape.Quote(comment)
+	}
+	out, err := c.runner.Run(shell.Opt{CombinedStdoutStderrOutput: true}, cmdStr)
+	if err != nil {
+		return fmt.Errorf("calling gh CLI: %w: %s", err, out)
+	}
+	return nil
+}
+
+func (c *cliClient) RepoURL() (string, error) {
+	if c.repo != nil {
+		return c.repo.webURL(), nil
+	}
+	out, err := c.runner.Run(shell.Opt{}, "gh repo view --json url")
+	if err != nil {
+		return "", fmt.Errorf("calling gh CLI: %w", err)
+	}
+
+	var resp struct{ Url string }
+	err = json.Unmarshal([]byte(out), &resp)
+	if err != nil {
+		return "", fmt.Errorf("decoding JSON from gh CLI: %w", err)
+	}
+	return resp.Url, nil
+}
+
+func (c *cliClient) HeadOwner() string {
+	return c.headOwner
+}
+
+// Returns the --repo flag that makes gh use the repository of the client, if known.
+func (c *cliClient) repoFlag() string {
+	if c.repo == nil {
+		return ""
+	}
+	return " --repo " + shellescape.Quote(c.repo.Host+"/"+c.repo.Owner+"/"+c.repo.Name)
+}
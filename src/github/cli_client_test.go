@@ -0,0 +1,69 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/yapaluc/hg-git/src/shell"
+)
+
+func TestCLIClient(t *testing.T) {
+	g := gomega.NewWithT(t)
+	runner := shell.NewFakeRunner(
+		shell.Fixture{
+			Command: "gh pr list -s open -H feature --json " + pullRequestRequestFields,
+			Output:  `[{"number":12,"state":"OPEN","headRefName":"feature","baseRefName":"main","body":"a\r\nb"}]`,
+		},
+		shell.Fixture{
+			Command: "gh pr list -s open -H other --json " + pullRequestRequestFields,
+			Output:  `[]`,
+		},
+		shell.Fixture{
+			Command: "gh pr edit 12 --base gone",
+			Output:  "Proposed base branch 'gone' was not found\n",
+			Error:   "exit status 1",
+		},
+	)
+	client := NewCLIClient(runner, nil, "")
+
+	pr, err := client.FetchPRForBranch("feature")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pr.Number).To(Equal(12))
+	g.Expect(pr.Body).To(Equal("a\nb"))
+
+	pr, err = client.FetchPRForBranch("other")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pr).To(BeNil())
+
+	base := "gone"
+	err = client.EditPR(12, EditPROpts{Base: &base})
+	g.Expect(err).To(MatchError(ErrBaseBranchNotFound))
+	g.Expect(runner.Unused()).To(BeEmpty())
+}
+
+func TestCLIClient_fork(t *testing.T) {
+	g := gomega.NewWithT(t)
+	runner := shell.NewFakeRunner(
+		shell.Fixture{
+			Command: "gh pr list --repo github.com/owner/repo -s open -H feature --json " + pullRequestRequestFields,
+			Output: `[{"number":3,"headRefName":"feature","headRepositoryOwner":{"login":"someone"}},` +
+				`{"number":5,"headRefName":"feature","headRepositoryOwner":{"login":"fork-owner"}}]`,
+		},
+		shell.Fixture{
+			Command: "gh pr create --repo github.com/owner/repo --head fork-owner:other --title t --body b --base main",
+			Output:  "https://github.com/owner/repo/pull/6",
+		},
+	)
+	client := NewCLIClient(runner, &Repo{Host: "github.com", Owner: "owner", Name: "repo"}, "fork-owner")
+
+	pr, err := client.FetchPRForBranch("feature")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pr.Number).To(Equal(5))
+
+	pr, err = client.CreatePR(CreatePROpts{Head: "other", Base: "main", Title: "t", Body: "b"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pr.Number).To(Equal(6))
+	g.Expect(pr.HeadRefName).To(Equal("other"))
+	g.Expect(runner.Unused()).To(BeEmpty())
+}
@@ -0,0 +1,206 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/yapaluc/hg-git/src/shell"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultHost = "github.com"
+
+// Client is the set of GitHub operations used by hg-git.
+type Client interface {
+	// Returns the open PR for the given head branch, or nil if there is none.
+	FetchPRForBranch(branchName string) (*PullRequest, error)
+	FetchPRByNum(prNum int) (*PullRequest, error)
+	// Accepts a PR URL, a PR number or a PR number prefixed with "#".
+	FetchPRByURLOrNum(prURLOrNum string) (*PullRequest, error)
+	// Fetches the open PR of each branch and the PRs with the given numbers in a single request.
+	// Branches without an open PR and PR numbers that do not exist are missing from the result.
+	FetchPRs(branchNames []string, prNums []int) (map[string]*PullRequest, map[int]*PullRequest, error)
+	// Fetches the review, CI and merge status of the PRs with the given numbers in a single request.
+	// PR numbers that do not exist are missing from the result.
+	FetchPRStatuses(prNums []int) (map[int]*PRStatus, error)
+	CreatePR(opts CreatePROpts) (*PullRequest, error)
+	// Returns ErrBaseBranchNotFound if the new base branch does not exist on the remote.
+	EditPR(prNum int, opts EditPROpts) error
+	// Merges the PR into its base branch. The head branch is not deleted.
+	MergePR(prNum int, method MergeMethod) error
+	// Comments on the PR, unless the comment is empty, and closes it. The head branch is not deleted.
+	ClosePR(prNum int, comment string) error
+	// Returns the web URL of the repository.
+	RepoURL() (string, error)
+	// Returns the owner of the fork that head branches are pushed to, or an empty string
+	// if they are pushed to the repository itself.
+	HeadOwner() string
+}
+
+type CreatePROpts struct {
+	Head  string
+	Base  string
+	Title string
+	Body  string
+	Draft bool
+}
+
+// Nil fields are left unchanged.
+type EditPROpts struct {
+	Base  *string
+	Title *string
+	Body  *string
+}
+
+// MergeMethod is how a PR is merged into its base branch.
+type MergeMethod string
+
+const (
+	MergeMethodSquash MergeMethod = "squash"
+	MergeMethodMerge  MergeMethod = "merge"
+	MergeMethodRebase MergeMethod = "rebase"
+)
+
+var MergeMethods = []MergeMethod{MergeMethodSquash, MergeMethodMerge, MergeMethodRebase}
+
+// Returned when a PR is retargeted to a base branch that does not exist,
+// typically because the parent PR was merged and its branch deleted.
+var ErrBaseBranchNotFound = errors.New("base branch not found")
+
+// Repo identifies a repository on a GitHub host.
+type Repo struct {
+	Host  string
+	Owner string
+	Name  string
+}
+
+// NewClient returns a client for the repository at the given git remote URL.
+// headOwner is the owner of the fork that head branches are pushed to, or empty if they are
+// pushed to the repository itself.
+// The REST API is used if a token can be found in the environment or in the gh config,
+// otherwise the gh CLI is used if it is installed.
+func NewClient(remoteURL string, headOwner string) (Client, error) {
+	repo, repoErr := ParseRemoteURL(remoteURL)
+	if repoErr == nil {
+		token, err := findToken(repo.Host)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			return NewRESTClient(apiBaseURL(repo.Host), token, repo, headOwner, nil), nil
+		}
+	}
+	if _, err := exec.LookPath("gh"); err == nil {
+		var cliRepo *Repo
+		if repoErr == nil {
+			cliRepo = &repo
+		}
+		return NewCLIClient(shell.DefaultRunner(), cliRepo, headOwner), nil
+	}
+	if repoErr != nil {
+		return nil, repoErr
+	}
+	return nil, fmt.Errorf(
+		"no GitHub token found for %s. set GH_TOKEN or log in with `gh auth login`",
+		repo.Host,
+	)
+}
+
+// ParseRemoteURL parses HTTPS and SSH git remote URLs, e.g.
+// https://github.com/owner/repo.git, git@github.com:owner/repo.git or ssh://git@github.com/owner/repo.
+func ParseRemoteURL(remoteURL string) (Repo, error) {
+	var host, path string
+	if strings.Contains(remoteURL, "://") {
+		u, err := url.Parse(remoteURL)
+		if err != nil {
+			return Repo{}, fmt.Errorf("parsing remote URL %q: %w", remoteURL, err)
+		}
+		host = u.Hostname()
+		path = u.Path
+	} else {
+		// scp-like syntax: [user@]host:path
+		var ok bool
+		host, path, ok = strings.Cut(remoteURL, ":")
+		if !ok {
+			return Repo{}, fmt.Errorf("unsupported remote URL %q", remoteURL)
+		}
+		if i := strings.LastIndex(host, "@"); i != -1 {
+			host = host[i+1:]
+		}
+	}
+	parts := strings.Split(strings.Trim(strings.TrimSuffix(path, ".git"), "/"), "/")
+	if host == "" || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Repo{}, fmt.Errorf("unsupported remote URL %q", remoteURL)
+	}
+	return Repo{Host: host, Owner: parts[0], Name: parts[1]}, nil
+}
+
+func (r Repo) webURL() string {
+	return fmt.Sprintf("https://%s/%s/%s", r.Host, r.Owner, r.Name)
+}
+
+func apiBaseURL(host string) string {
+	if host == defaultHost {
+		return "https://api.github.com"
+	}
+	// GitHub Enterprise Server.
+	return fmt.Sprintf("https://%s/api/v3", host)
+}
+
+// Looks up a token the same way gh does: environment variables first, then gh's hosts config.
+// Returns an empty string if no token is found.
+func findToken(host string) (string, error) {
+	var envVars []string
+	if host == defaultHost {
+		envVars = []string{"GH_TOKEN", "GITHUB_TOKEN"}
+	} else {
+		envVars = []string{"GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"}
+	}
+	for _, envVar := range envVars {
+		if token := os.Getenv(envVar); token != "" {
+			return token, nil
+		}
+	}
+
+	path := ghHostsConfigPath()
+	if path == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading gh config: %w", err)
+	}
+	var hosts map[string]struct {
+		OAuthToken string `yaml:"oauth_token"`
+	}
+	err = yaml.Unmarshal(content, &hosts)
+	if err != nil {
+		return "", fmt.Errorf("decoding gh config %q: %w", path, err)
+	}
+	// gh may store the token in the system keyring instead, in which case
+	// the gh CLI is used as a fallback.
+	return hosts[host].OAuthToken, nil
+}
+
+func ghHostsConfigPath() string {
+	if dir := os.Getenv("GH_CONFIG_DIR"); dir != "" {
+		return filepath.Join(dir, "hosts.yml")
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gh", "hosts.yml")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "gh", "hosts.yml")
+}
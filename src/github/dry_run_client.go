@@ -0,0 +1,112 @@
+package github
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// dryRunClient fetches PRs with another client and only prints the PRs that would be created or edited.
+type dryRunClient struct {
+	client Client
+	out    io.Writer
+}
+
+// NewDryRunClient returns a client that reads with the given client and prints writes to stdout.
+func NewDryRunClient(client Client) Client {
+	return &dryRunClient{client: client, out: os.Stdout}
+}
+
+func (c *dryRunClient) FetchPRForBranch(branchName string) (*PullRequest, error) {
+	return c.client.FetchPRForBranch(branchName)
+}
+
+func (c *dryRunClient) FetchPRByNum(prNum int) (*PullRequest, error) {
+	return c.client.FetchPRByNum(prNum)
+}
+
+func (c *dryRunClient) FetchPRByURLOrNum(prURLOrNum string) (*PullRequest, error) {
+	return c.client.FetchPRByURLOrNum(prURLOrNum)
+}
+
+func (c *dryRunClient) FetchPRs(
+	branchNames []string,
+	prNums []int,
+) (map[string]*PullRequest, map[int]*PullRequest, error) {
+	return c.client.FetchPRs(branchNames, prNums)
+}
+
+func (c *dryRunClient) FetchPRStatuses(prNums []int) (map[int]*PRStatus, error) {
+	return c.client.FetchPRStatuses(prNums)
+}
+
+// The returned PR has no number or URL since it does not exist.
+func (c *dryRunClient) CreatePR(opts CreatePROpts) (*PullRequest, error) {
+	var draft string
+	if opts.Draft {
+		draft = " as a draft"
+	}
+	fmt.Fprintf(
+		c.out,
+		"[dry-run] create PR for %s onto %s%s\n  title: %s\n%s",
+		opts.Head,
+		opts.Base,
+		draft,
+		opts.Title,
+		indentBody(opts.Body),
+	)
+	return &PullRequest{
+		BaseRefName: opts.Base,
+		HeadRefName: opts.Head,
+		State:       "OPEN",
+		Title:       opts.Title,
+		Body:        opts.Body,
+	}, nil
+}
+
+func (c *dryRunClient) EditPR(prNum int, opts EditPROpts) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[dry-run] edit PR #%d\n", prNum)
+	if opts.Base != nil {
+		fmt.Fprintf(&sb, "  base: %s\n", *opts.Base)
+	}
+	if opts.Title != nil {
+		fmt.Fprintf(&sb, "  title: %s\n", *opts.Title)
+	}
+	if opts.Body != nil {
+		sb.WriteString(indentBody(*opts.Body))
+	}
+	fmt.Fprint(c.out, sb.String())
+	return nil
+}
+
+func (c *dryRunClient) MergePR(prNum int, method MergeMethod) error {
+	fmt.Fprintf(c.out, "[dry-run] %s merge PR #%d\n", method, prNum)
+	return nil
+}
+
+func (c *dryRunClient) ClosePR(prNum int, comment string) error {
+	fmt.Fprintf(c.out, "[dry-run] close PR #%d\n", prNum)
+	if comment != "" {
+		fmt.Fprintf(c.out, "  comment: %s\n", comment)
+	}
+	return nil
+}
+
+func (c *dryRunClient) RepoURL() (string, error) {
+	return c.client.RepoURL()
+}
+
+func (c *dryRunClient) HeadOwner() string {
+	return c.client.HeadOwner()
+}
+
+func indentBody(body string) string {
+	var sb strings.Builder
+	sb.WriteString("  body:\n")
+	for _, line := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+		sb.WriteString("    " + line + "\n")
+	}
+	return sb.String()
+}
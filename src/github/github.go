@@ -1,80 +1,53 @@
 package github
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/url"
 	"strconv"
 	"strings"
-
-	"github.com/yapaluc/hg-git/src/shell"
-
-	"github.com/alessio/shellescape"
 )
 
-const pullRequestRequestFields = "url,number,state,title,baseRefName,headRefName,body"
-
 type PullRequest struct {
 	BaseRefName string
 	HeadRefName string
-	State       string
-	URL         string
-	Number      int
-	Title       string
-	Body        string
+	// Owner of the repository of the head branch, which is a fork for PRs opened from a fork.
+	HeadRepositoryOwner RepositoryOwner
+	State               string
+	URL                 string
+	Number              int
+	Title               string
+	Body                string
 }
 
-func FetchPRForBranch(branchName string) (*PullRequest, error) {
-	out, err := shell.Run(
-		shell.Opt{},
-		fmt.Sprintf(
-			"gh pr list -s open -H %s --json %s",
-			shellescape.Quote(branchName),
-			pullRequestRequestFields,
-		),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("calling gh CLI: %w", err)
-	}
-
-	var resp []PullRequest
-	err = json.Unmarshal([]byte(out), &resp)
-	if err != nil {
-		return nil, fmt.Errorf("decoding JSON from gh CLI: %w", err)
-	}
-	if len(resp) == 0 {
-		// No PR.
-		return nil, nil
-	}
-	pr := &resp[0]
-	pr.Body = strings.ReplaceAll(pr.Body, "\r\n", "\n")
-	return pr, nil
+type RepositoryOwner struct {
+	Login string
 }
 
-func FetchPRByNum(prNum int) (*PullRequest, error) {
-	return FetchPRByURLOrNum(fmt.Sprintf("%d", prNum))
+// Returns true if the head branch of the PR was pushed by the given owner, or if the owner is empty.
+func (pr *PullRequest) isFromHeadOwner(headOwner string) bool {
+	return headOwner == "" || strings.EqualFold(pr.HeadRepositoryOwner.Login, headOwner)
 }
 
-func FetchPRByURLOrNum(prURLOrNum string) (*PullRequest, error) {
-	out, err := shell.Run(
-		shell.Opt{},
-		fmt.Sprintf(
-			"gh pr view %s --json %s",
-			shellescape.Quote(prURLOrNum),
-			pullRequestRequestFields,
-		),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("calling gh CLI: %w", err)
+// Returns the head branch of a PR in the owner:branch format used for PRs opened from a fork,
+// or the branch name if the owner is empty.
+func qualifiedHead(headOwner string, branchName string) string {
+	if headOwner == "" {
+		return branchName
 	}
+	return headOwner + ":" + branchName
+}
 
-	var resp PullRequest
-	err = json.Unmarshal([]byte(out), &resp)
-	if err != nil {
-		return nil, fmt.Errorf("decoding JSON from gh CLI: %w", err)
-	}
-	resp.Body = strings.ReplaceAll(resp.Body, "\r\n", "\n")
-	return &resp, nil
+// PRStatus is the review, CI and merge readiness of a PR.
+type PRStatus struct {
+	Number  int
+	IsDraft bool
+	// APPROVED, CHANGES_REQUESTED or REVIEW_REQUIRED, or empty if no review is required.
+	ReviewDecision string
+	// State of the checks of the last commit: SUCCESS, FAILURE, ERROR, PENDING or EXPECTED,
+	// or empty if there are no checks.
+	CheckState string
+	// MERGEABLE, CONFLICTING or UNKNOWN if GitHub has not computed it yet.
+	Mergeable string
 }
 
 func GetPRDataForIgnoredBranch(branchName string) *PullRequest {
@@ -104,23 +77,36 @@ func PRNumFromNumOrURL(numOrURL string) int {
 	return PRNumFromPRURL(numOrURL)
 }
 
-func BranchURLFromBranchName(branchName string, parentBranchName string) (string, error) {
-	out, err := shell.Run(shell.Opt{}, "gh repo view --json url")
-	if err != nil {
-		return "", fmt.Errorf("calling gh CLI: %w", err)
+// ParsePRNum parses a PR URL, a PR number or a PR number prefixed with "#".
+func ParsePRNum(prURLOrNum string) (int, bool) {
+	s := strings.TrimPrefix(prURLOrNum, "#")
+	if i := strings.LastIndex(s, "/pull/"); i != -1 {
+		s = strings.TrimSuffix(s[i+len("/pull/"):], "/")
 	}
+	prNum, err := strconv.Atoi(s)
+	if err != nil || prNum <= 0 {
+		return 0, false
+	}
+	return prNum, true
+}
 
-	var resp struct{ Url string }
-	err = json.Unmarshal([]byte(out), &resp)
+func BranchURLFromBranchName(
+	client Client,
+	branchName string,
+	parentBranchName string,
+) (string, error) {
+	repoURL, err := client.RepoURL()
 	if err != nil {
-		return "", fmt.Errorf("decoding JSON from gh CLI: %w", err)
+		return "", err
 	}
+	// Branches pushed to a fork are qualified with the owner of the fork.
+	headOwner := client.HeadOwner()
 	var revSet string
 	if parentBranchName != "" {
-		revSet = parentBranchName + "..." + branchName
+		revSet = qualifiedHead(headOwner, parentBranchName) + "..." + qualifiedHead(headOwner, branchName)
 	} else {
-		revSet = branchName
+		revSet = qualifiedHead(headOwner, branchName)
 	}
 	// <REPO_URL>/compare/<REV_SET>
-	return url.JoinPath(resp.Url, "compare", revSet)
+	return url.JoinPath(repoURL, "compare", revSet)
 }
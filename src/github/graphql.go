@@ -0,0 +1,201 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const graphqlPRFields = "number url state title body baseRefName headRefName headRepositoryOwner { login }"
+
+// Number of open PRs fetched per head branch, to find the one pushed by the head owner
+// when other forks have a branch with the same name.
+const graphqlPRsPerBranch = 10
+
+const graphqlPRStatusFields = "number isDraft reviewDecision mergeable " +
+	"commits(last: 1) { nodes { commit { statusCheckRollup { state } } } }"
+
+// GraphQLError is an error returned in the "errors" field of a GraphQL response.
+type GraphQLError struct {
+	Type    string
+	Message string
+	Path    []any
+}
+
+func (e *GraphQLError) Error() string {
+	return fmt.Sprintf("GitHub GraphQL API error: %s", e.Message)
+}
+
+type graphqlResponse struct {
+	Data struct {
+		Repository map[string]json.RawMessage
+	}
+	Errors []*GraphQLError
+}
+
+// Builds a single query that fetches the open PR of each branch and the PRs with the given numbers,
+// using one alias per lookup. Branch names are passed as variables to avoid escaping issues.
+func buildPRsQuery(branchNames []string, prNums []int) (string, map[string]string) {
+	variables := make(map[string]string)
+	var variableDefs []string
+	var fields []string
+	for i, branchName := range branchNames {
+		variable := fmt.Sprintf("b%d", i)
+		variables[variable] = branchName
+		variableDefs = append(variableDefs, fmt.Sprintf("$%s: String!", variable))
+		fields = append(fields, fmt.Sprintf(
+			"%s: pullRequests(headRefName: $%s, states: OPEN, first: %d) { nodes { %s } }",
+			variable,
+			variable,
+			graphqlPRsPerBranch,
+			graphqlPRFields,
+		))
+	}
+	for i, prNum := range prNums {
+		fields = append(fields, fmt.Sprintf(
+			"n%d: pullRequest(number: %d) { %s }",
+			i,
+			prNum,
+			graphqlPRFields,
+		))
+	}
+	query := fmt.Sprintf(
+		"query($owner: String!, $name: String!%s) { repository(owner: $owner, name: $name) { %s } }",
+		strings.Join(append([]string{""}, variableDefs...), ", "),
+		strings.Join(fields, " "),
+	)
+	return query, variables
+}
+
+// Decodes the response of a query built by buildPRsQuery.
+// The PR of each branch is the first one pushed by the head owner, if any.
+// PRs that do not exist are missing from the result instead of causing an error.
+func parsePRsResponse(
+	body []byte,
+	branchNames []string,
+	prNums []int,
+	headOwner string,
+) (map[string]*PullRequest, map[int]*PullRequest, error) {
+	resp, err := decodeGraphQLResponse(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prsByBranch := make(map[string]*PullRequest)
+	for i, branchName := range branchNames {
+		var connection struct{ Nodes []PullRequest }
+		raw := resp.Data.Repository[fmt.Sprintf("b%d", i)]
+		if len(raw) == 0 {
+			continue
+		}
+		err := json.Unmarshal(raw, &connection)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decoding PRs of branch %q: %w", branchName, err)
+		}
+		for _, pr := range connection.Nodes {
+			if !pr.isFromHeadOwner(headOwner) {
+				continue
+			}
+			pr.Body = strings.ReplaceAll(pr.Body, "\r\n", "\n")
+			prsByBranch[branchName] = &pr
+			break
+		}
+	}
+
+	prsByNum := make(map[int]*PullRequest)
+	for i, prNum := range prNums {
+		var pr *PullRequest
+		raw := resp.Data.Repository[fmt.Sprintf("n%d", i)]
+		if len(raw) == 0 {
+			continue
+		}
+		err := json.Unmarshal(raw, &pr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decoding PR %d: %w", prNum, err)
+		}
+		if pr != nil {
+			pr.Body = strings.ReplaceAll(pr.Body, "\r\n", "\n")
+			prsByNum[prNum] = pr
+		}
+	}
+	return prsByBranch, prsByNum, nil
+}
+
+// Builds a single query that fetches the status of the PRs with the given numbers, using one alias per PR.
+func buildPRStatusesQuery(prNums []int) string {
+	var fields []string
+	for i, prNum := range prNums {
+		fields = append(fields, fmt.Sprintf(
+			"n%d: pullRequest(number: %d) { %s }",
+			i,
+			prNum,
+			graphqlPRStatusFields,
+		))
+	}
+	return fmt.Sprintf(
+		"query($owner: String!, $name: String!) { repository(owner: $owner, name: $name) { %s } }",
+		strings.Join(fields, " "),
+	)
+}
+
+// Decodes the response of a query built by buildPRStatusesQuery.
+// PRs that do not exist are missing from the result instead of causing an error.
+func parsePRStatusesResponse(body []byte, prNums []int) (map[int]*PRStatus, error) {
+	resp, err := decodeGraphQLResponse(body)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[int]*PRStatus)
+	for i, prNum := range prNums {
+		var pr *struct {
+			Number         int
+			IsDraft        bool
+			ReviewDecision string
+			Mergeable      string
+			Commits        struct {
+				Nodes []struct {
+					Commit struct {
+						StatusCheckRollup *struct{ State string }
+					}
+				}
+			}
+		}
+		raw := resp.Data.Repository[fmt.Sprintf("n%d", i)]
+		if len(raw) == 0 {
+			continue
+		}
+		err := json.Unmarshal(raw, &pr)
+		if err != nil {
+			return nil, fmt.Errorf("decoding status of PR %d: %w", prNum, err)
+		}
+		if pr == nil {
+			continue
+		}
+		status := &PRStatus{
+			Number:         pr.Number,
+			IsDraft:        pr.IsDraft,
+			ReviewDecision: pr.ReviewDecision,
+			Mergeable:      pr.Mergeable,
+		}
+		if nodes := pr.Commits.Nodes; len(nodes) > 0 && nodes[0].Commit.StatusCheckRollup != nil {
+			status.CheckState = nodes[0].Commit.StatusCheckRollup.State
+		}
+		statuses[prNum] = status
+	}
+	return statuses, nil
+}
+
+// Decodes a GraphQL response, ignoring the errors of objects that were not found.
+func decodeGraphQLResponse(body []byte) (*graphqlResponse, error) {
+	var resp graphqlResponse
+	err := json.Unmarshal(body, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("decoding GraphQL response: %w", err)
+	}
+	for _, graphqlErr := range resp.Errors {
+		if graphqlErr.Type != "NOT_FOUND" {
+			return nil, graphqlErr
+		}
+	}
+	return &resp, nil
+}
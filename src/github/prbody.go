@@ -24,17 +24,36 @@ const stackIndicatorTemplate = `> [!NOTE]
 
 `
 
+const currentPRAnnotation = " ← *This PR*"
+
 const defaultAnnotation = "&nbsp;"
 
 const nonBreakingSpace = "\u00A0"
 
 type PrBody struct {
-	PreviousPR  int
-	NextPRs     []int
+	PreviousPR int
+	NextPRs    []int
+	// The whole stack tree in depth-first order, only set by the newest format.
+	// PreviousPR and NextPRs are derived from it.
+	Stack       []PrStackItem
+	CurrentPR   int
 	Description string
 }
 
+// PrStackItem is a PR in the stack listing of a PR body.
+type PrStackItem struct {
+	PRNum int
+	// 0 for the PRs based on trunk.
+	Depth  int
+	Merged bool
+}
+
 func NewPrBody(rawPrBody string) (*PrBody, error) {
+	prBody4, err := newPrBody4(rawPrBody)
+	if err == nil {
+		return prBody4, nil
+	}
+
 	prBody1, err := newPrBody1(rawPrBody)
 	if err == nil {
 		return prBody1, nil
@@ -151,7 +170,7 @@ func newPrBody2(rawPrBody string) (*PrBody, error) {
 	return &prBody, nil
 }
 
-// New format
+// Old format for backwards compatibility
 func newPrBody3(rawPrBody string) (*PrBody, error) {
 	var prBody PrBody
 	rowPattern := regexp.MustCompile(
@@ -195,6 +214,100 @@ func newPrBody3(rawPrBody string) (*PrBody, error) {
 	return &prBody, nil
 }
 
+// New format
+func newPrBody4(rawPrBody string) (*PrBody, error) {
+	itemPattern := regexp.MustCompile(
+		`^>\s?(?P<indent> *)- (?P<item>\*\*#\d+\*\*|~~#\d+~~|#\d+)(?P<current>` +
+			regexp.QuoteMeta(currentPRAnnotation) + `)?$`,
+	)
+
+	lines := strings.Split(rawPrBody, "\n")
+	headerIndex := lo.IndexOf(lines, "> This PR is part of a stack:")
+	if headerIndex == -1 {
+		return nil, fmt.Errorf("could not find stack listing in PR body: %q", rawPrBody)
+	}
+
+	var stack []PrStackItem
+	var currentPR int
+	lastIndex := headerIndex
+	for i := headerIndex + 1; i < len(lines); i++ {
+		match, err := util.RegexNamedMatches(itemPattern, strings.TrimRight(lines[i], " "))
+		if err != nil {
+			return nil, fmt.Errorf("parsing PR body to find PR stack listing: %w", err)
+		}
+		if match == nil {
+			break
+		}
+		item := PrStackItem{
+			PRNum:  PRNumFromNumOrURL(strings.Trim(match["item"], "*~")),
+			Depth:  len(match["indent"]) / 2,
+			Merged: strings.HasPrefix(match["item"], "~~"),
+		}
+		if match["current"] != "" {
+			currentPR = item.PRNum
+		}
+		stack = append(stack, item)
+		lastIndex = i
+	}
+
+	// If the stack listing was not found, return an error to allow top-level handling of other formats.
+	if len(stack) == 0 || currentPR == 0 {
+		return nil, fmt.Errorf("parsing PR body: %q", rawPrBody)
+	}
+
+	prBody := PrBody{
+		// Everything after the stack listing is the description.
+		Description: strings.TrimSpace(strings.Join(lines[lastIndex+1:], "\n")),
+	}
+	prBody.SetStack(stack, currentPR)
+	return &prBody, nil
+}
+
+// SetStack sets the stack listing and derives the previous and next PRs of the current PR from it.
+// An empty stack clears the stack indicator.
+func (p *PrBody) SetStack(stack []PrStackItem, currentPR int) {
+	p.Stack = stack
+	p.CurrentPR = currentPR
+	p.PreviousPR = 0
+	p.NextPRs = nil
+
+	currentIndex := lo.IndexOf(lo.Map(stack, func(item PrStackItem, _ int) int {
+		return item.PRNum
+	}), currentPR)
+	if currentIndex == -1 {
+		return
+	}
+	depth := stack[currentIndex].Depth
+	for i := currentIndex - 1; i >= 0; i-- {
+		if stack[i].Depth < depth {
+			p.PreviousPR = stack[i].PRNum
+			break
+		}
+	}
+	for _, item := range stack[currentIndex+1:] {
+		if item.Depth <= depth {
+			break
+		}
+		if item.Depth == depth+1 {
+			p.NextPRs = append(p.NextPRs, item.PRNum)
+		}
+	}
+}
+
+func (p *PrBody) toPRStackList() string {
+	lines := lo.Map(p.Stack, func(item PrStackItem, _ int) string {
+		prStr := PRStrFromPRNum(item.PRNum)
+		switch {
+		case item.PRNum == p.CurrentPR:
+			prStr = "**" + prStr + "**" + currentPRAnnotation
+		case item.Merged:
+			prStr = "~~" + prStr + "~~"
+		}
+		return fmt.Sprintf("> %s- %s", strings.Repeat("  ", item.Depth), prStr)
+	})
+	return fmt.Sprintf(stackIndicatorTemplate, strings.Join(lines, "\n"))
+}
+
 func (p *PrBody) toPRStackTable() string {
 	if p.PreviousPR == 0 && len(p.NextPRs) == 0 {
 		return ""
@@ -230,6 +343,9 @@ func (p *PrBody) toPRStackTable() string {
 }
 
 func (p *PrBody) ToMarkdown() string {
+	if len(p.Stack) != 0 {
+		return fmt.Sprintf("%s%s", p.toPRStackList(), p.Description)
+	}
 	return fmt.Sprintf("%s%s", p.toPRStackTable(), p.Description)
 }
 
@@ -135,3 +135,75 @@ func TestPrBodyRoundtrip(t *testing.T) {
 		})
 	}
 }
+
+const rawPrBodyWithStack = `
+> [!NOTE]
+> This PR is part of a stack:
+> - ~~#1~~
+>   - #2
+>     - **#3** ← *This PR*
+>       - #4
+>         - #5
+>       - #6
+>     - #7
+>   - #8
+
+content line 1
+content line 2
+`
+
+func TestNewPrBody_newPrBody4(t *testing.T) {
+	g := gomega.NewWithT(t)
+	prBody, err := NewPrBody(strings.TrimSpace(rawPrBodyWithStack))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(prBody.Description).To(Equal("content line 1\ncontent line 2"))
+	g.Expect(prBody.CurrentPR).To(Equal(3))
+	g.Expect(prBody.PreviousPR).To(Equal(2))
+	g.Expect(prBody.NextPRs).To(Equal([]int{4, 6}))
+	g.Expect(prBody.Stack).To(Equal([]PrStackItem{
+		{PRNum: 1, Depth: 0, Merged: true},
+		{PRNum: 2, Depth: 1},
+		{PRNum: 3, Depth: 2},
+		{PRNum: 4, Depth: 3},
+		{PRNum: 5, Depth: 4},
+		{PRNum: 6, Depth: 3},
+		{PRNum: 7, Depth: 2},
+		{PRNum: 8, Depth: 1},
+	}))
+	g.Expect(prBody.ToMarkdown()).To(Equal(strings.TrimSpace(rawPrBodyWithStack)))
+}
+
+func TestPrBodyRoundtrip_stack(t *testing.T) {
+	testCases := map[string]struct {
+		stack      []PrStackItem
+		currentPR  int
+		previousPR int
+		nextPRs    []int
+	}{
+		"root of the stack": {
+			stack:     []PrStackItem{{PRNum: 1}, {PRNum: 2, Depth: 1}, {PRNum: 3, Depth: 1}},
+			currentPR: 1,
+			nextPRs:   []int{2, 3},
+		},
+		"tip of the stack": {
+			stack:      []PrStackItem{{PRNum: 1, Merged: true}, {PRNum: 2, Depth: 1}},
+			currentPR:  2,
+			previousPR: 1,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			var original PrBody
+			original.Description = "content line 1\ncontent line 2"
+			original.SetStack(tc.stack, tc.currentPR)
+			prBody, err := NewPrBody(original.ToMarkdown())
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(prBody.Description).To(Equal(original.Description))
+			g.Expect(prBody.Stack).To(Equal(tc.stack))
+			g.Expect(prBody.CurrentPR).To(Equal(tc.currentPR))
+			g.Expect(prBody.PreviousPR).To(Equal(tc.previousPR))
+			g.Expect(prBody.NextPRs).To(ConsistOf(tc.nextPRs))
+		})
+	}
+}
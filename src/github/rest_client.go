@@ -0,0 +1,378 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// restClient talks to the GitHub REST API directly.
+type restClient struct {
+	baseURL    string
+	graphqlURL string
+	token      string
+	repo       Repo
+	headOwner  string
+	httpClient *http.Client
+}
+
+// NewRESTClient returns a client for the GitHub REST API at baseURL,
+// e.g. https://api.github.com. headOwner is the owner of the fork that head branches are pushed to,
+// or empty if they are pushed to repo. A default HTTP client is used if httpClient is nil.
+func NewRESTClient(
+	baseURL string,
+	token string,
+	repo Repo,
+	headOwner string,
+	httpClient *http.Client,
+) Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	// https://api.github.com/graphql, or https://<host>/api/graphql for GitHub Enterprise Server.
+	graphqlURL := baseURL + "/graphql"
+	if apiURL, ok := strings.CutSuffix(baseURL, "/v3"); ok {
+		graphqlURL = apiURL + "/graphql"
+	}
+	return &restClient{
+		baseURL:    baseURL,
+		graphqlURL: graphqlURL,
+		token:      token,
+		repo:       repo,
+		headOwner:  headOwner,
+		httpClient: httpClient,
+	}
+}
+
+// APIError is an error response from the GitHub REST API.
+type APIError struct {
+	StatusCode int
+	Message    string
+	Errors     []APIErrorDetail
+}
+
+type APIErrorDetail struct {
+	Resource string
+	Field    string
+	Code     string
+	Message  string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("GitHub API returned %d: %s", e.StatusCode, e.Message)
+	for _, detail := range e.Errors {
+		if detail.Message != "" {
+			msg += "; " + detail.Message
+		} else {
+			msg += fmt.Sprintf("; %s.%s is %s", detail.Resource, detail.Field, detail.Code)
+		}
+	}
+	return msg
+}
+
+// restPullRequest is the PR representation of the REST API.
+type restPullRequest struct {
+	Number   int
+	Title    string
+	Body     *string
+	State    string
+	HTMLURL  string  `json:"html_url"`
+	MergedAt *string `json:"merged_at"`
+	Base     struct{ Ref string }
+	Head     struct {
+		Ref  string
+		User struct{ Login string }
+	}
+}
+
+func (pr *restPullRequest) toPullRequest() *PullRequest {
+	// The REST API only has "open" and "closed" states, unlike the GraphQL API used by gh.
+	state := strings.ToUpper(pr.State)
+	if pr.MergedAt != nil {
+		state = "MERGED"
+	}
+	var body string
+	if pr.Body != nil {
+		body = strings.ReplaceAll(*pr.Body, "\r\n", "\n")
+	}
+	return &PullRequest{
+		BaseRefName:         pr.Base.Ref,
+		HeadRefName:         pr.Head.Ref,
+		HeadRepositoryOwner: RepositoryOwner{Login: pr.Head.User.Login},
+		State:               state,
+		URL:                 pr.HTMLURL,
+		Number:              pr.Number,
+		Title:               pr.Title,
+		Body:                body,
+	}
+}
+
+func (c *restClient) FetchPRForBranch(branchName string) (*PullRequest, error) {
+	query := url.Values{}
+	query.Set("state", "open")
+	query.Set("head", qualifiedHead(c.getHeadOwner(), branchName))
+	query.Set("per_page", "100")
+
+	var prs []restPullRequest
+	err := c.getPaginated(c.repoPath("pulls")+"?"+query.Encode(), func(body []byte) error {
+		var page []restPullRequest
+		err := json.Unmarshal(body, &page)
+		if err != nil {
+			return err
+		}
+		prs = append(prs, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing PRs for branch %q: %w", branchName, err)
+	}
+	if len(prs) == 0 {
+		// No PR.
+		return nil, nil
+	}
+	return prs[0].toPullRequest(), nil
+}
+
+func (c *restClient) FetchPRByNum(prNum int) (*PullRequest, error) {
+	var pr restPullRequest
+	err := c.do(http.MethodGet, c.repoPath(fmt.Sprintf("pulls/%d", prNum)), nil, &pr)
+	if err != nil {
+		return nil, fmt.Errorf("fetching PR %d: %w", prNum, err)
+	}
+	return pr.toPullRequest(), nil
+}
+
+func (c *restClient) FetchPRByURLOrNum(prURLOrNum string) (*PullRequest, error) {
+	prNum, ok := ParsePRNum(prURLOrNum)
+	if !ok {
+		return nil, fmt.Errorf("invalid PR URL or number %q", prURLOrNum)
+	}
+	return c.FetchPRByNum(prNum)
+}
+
+func (c *restClient) FetchPRs(
+	branchNames []string,
+	prNums []int,
+) (map[string]*PullRequest, map[int]*PullRequest, error) {
+	if len(branchNames) == 0 && len(prNums) == 0 {
+		return map[string]*PullRequest{}, map[int]*PullRequest{}, nil
+	}
+	query, variables := buildPRsQuery(branchNames, prNums)
+	allVariables := map[string]string{"owner": c.repo.Owner, "name": c.repo.Name}
+	for name, value := range variables {
+		allVariables[name] = value
+	}
+	respBody, _, err := c.request(
+		http.MethodPost,
+		c.graphqlURL,
+		map[string]any{"query": query, "variables": allVariables},
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching PRs: %w", err)
+	}
+	prsByBranch, prsByNum, err := parsePRsResponse(respBody, branchNames, prNums, c.headOwner)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching PRs: %w", err)
+	}
+	return prsByBranch, prsByNum, nil
+}
+
+func (c *restClient) FetchPRStatuses(prNums []int) (map[int]*PRStatus, error) {
+	if len(prNums) == 0 {
+		return map[int]*PRStatus{}, nil
+	}
+	respBody, _, err := c.request(
+		http.MethodPost,
+		c.graphqlURL,
+		map[string]any{
+			"query":     buildPRStatusesQuery(prNums),
+			"variables": map[string]string{"owner": c.repo.Owner, "name": c.repo.Name},
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("fetching PR statuses: %w", err)
+	}
+	statuses, err := parsePRStatusesResponse(respBody, prNums)
+	if err != nil {
+		return nil, fmt.Errorf("fetching PR statuses: %w", err)
+	}
+	return statuses, nil
+}
+
+func (c *restClient) CreatePR(opts CreatePROpts) (*PullRequest, error) {
+	reqBody := map[string]any{
+		"head":  qualifiedHead(c.headOwner, opts.Head),
+		"base":  opts.Base,
+		"title": opts.Title,
+		"body":  opts.Body,
+		"draft": opts.Draft,
+	}
+	var pr restPullRequest
+	err := c.do(http.MethodPost, c.repoPath("pulls"), reqBody, &pr)
+	if err != nil {
+		return nil, fmt.Errorf("creating PR for branch %q: %w", opts.Head, err)
+	}
+	return pr.toPullRequest(), nil
+}
+
+func (c *restClient) EditPR(prNum int, opts EditPROpts) error {
+	reqBody := make(map[string]any)
+	if opts.Base != nil {
+		reqBody["base"] = *opts.Base
+	}
+	if opts.Title != nil {
+		reqBody["title"] = *opts.Title
+	}
+	if opts.Body != nil {
+		reqBody["body"] = *opts.Body
+	}
+	err := c.do(http.MethodPatch, c.repoPath(fmt.Sprintf("pulls/%d", prNum)), reqBody, nil)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnprocessableEntity {
+		for _, detail := range apiErr.Errors {
+			if detail.Field == "base" {
+				return fmt.Errorf("editing PR %d: %w: %w", prNum, ErrBaseBranchNotFound, err)
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("editing PR %d: %w", prNum, err)
+	}
+	return nil
+}
+
+func (c *restClient) MergePR(prNum int, method MergeMethod) error {
+	reqBody := map[string]any{"merge_method": string(method)}
+	err := c.do(http.MethodPut, c.repoPath(fmt.Sprintf("pulls/%d/merge", prNum)), reqBody, nil)
+	if err != nil {
+		return fmt.Errorf("merging PR %d: %w", prNum, err)
+	}
+	return nil
+}
+
+func (c *restClient) ClosePR(prNum int, comment string) error {
+	if comment != "" {
+		reqBody := map[string]any{"body": comment}
+		err := c.do(http.MethodPost, c.repoPath(fmt.Sprintf("issues/%d/comments", prNum)), reqBody, nil)
+		if err != nil {
+			return fmt.Errorf("commenting on PR %d: %w", prNum, err)
+		}
+	}
+	reqBody := map[string]any{"state": "closed"}
+	err := c.do(http.MethodPatch, c.repoPath(fmt.Sprintf("pulls/%d", prNum)), reqBody, nil)
+	if err != nil {
+		return fmt.Errorf("closing PR %d: %w", prNum, err)
+	}
+	return nil
+}
+
+func (c *restClient) RepoURL() (string, error) {
+	return c.repo.webURL(), nil
+}
+
+func (c *restClient) HeadOwner() string {
+	return c.headOwner
+}
+
+// The REST API only finds the PRs of a head branch with its owner.
+func (c *restClient) getHeadOwner() string {
+	if c.headOwner != "" {
+		return c.headOwner
+	}
+	return c.repo.Owner
+}
+
+func (c *restClient) repoPath(path string) string {
+	return fmt.Sprintf(
+		"/repos/%s/%s/%s",
+		url.PathEscape(c.repo.Owner),
+		url.PathEscape(c.repo.Name),
+		path,
+	)
+}
+
+// do sends a request with an optional JSON body and decodes the JSON response into out, if not nil.
+func (c *restClient) do(method string, path string, reqBody any, out any) error {
+	respBody, _, err := c.request(method, c.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	err = json.Unmarshal(respBody, out)
+	if err != nil {
+		return fmt.Errorf("decoding JSON response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+var nextLinkRegexp = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// getPaginated calls handlePage with the body of each page, following the Link headers.
+func (c *restClient) getPaginated(path string, handlePage func(body []byte) error) error {
+	pageURL := c.baseURL + path
+	for pageURL != "" {
+		body, header, err := c.request(http.MethodGet, pageURL, nil)
+		if err != nil {
+			return err
+		}
+		err = handlePage(body)
+		if err != nil {
+			return fmt.Errorf("decoding JSON response of GET %s: %w", pageURL, err)
+		}
+		pageURL = ""
+		if match := nextLinkRegexp.FindStringSubmatch(header.Get("Link")); match != nil {
+			pageURL = match[1]
+		}
+	}
+	return nil
+}
+
+func (c *restClient) request(method string, reqURL string, reqBody any) ([]byte, http.Header, error) {
+	var bodyReader io.Reader
+	if reqBody != nil {
+		content, err := json.Marshal(reqBody)
+		if err != nil {
+			return nil, nil, fmt.Errorf("encoding JSON request: %w", err)
+		}
+		bodyReader = bytes.NewReader(content)
+	}
+	req, err := http.NewRequest(method, reqURL, bodyReader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("calling GitHub API: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading response of %s %s: %w", method, reqURL, err)
+	}
+
+	if resp.StatusCode >= 300 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if json.Unmarshal(respBody, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return nil, nil, apiErr
+	}
+	return respBody, resp.Header, nil
+}
@@ -0,0 +1,299 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+)
+
+var testRepo = Repo{Host: "github.com", Owner: "owner", Name: "repo"}
+
+func newTestRESTClient(t *testing.T, handler http.HandlerFunc) Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewRESTClient(server.URL, "token", testRepo, "", server.Client())
+}
+
+func TestRESTClient_FetchPRForBranch(t *testing.T) {
+	g := gomega.NewWithT(t)
+	client := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.Header.Get("Authorization")).To(Equal("Bearer token"))
+		g.Expect(r.URL.Path).To(Equal("/repos/owner/repo/pulls"))
+		g.Expect(r.URL.Query().Get("head")).To(Equal("owner:feature"))
+		if r.URL.Query().Get("page") == "" {
+			serverURL := "http://" + r.Host
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/owner/repo/pulls?head=owner%%3Afeature&page=2>; rel="next"`, serverURL))
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		fmt.Fprint(w, `[{
+			"number": 12,
+			"title": "Title",
+			"body": "line 1\r\nline 2",
+			"state": "open",
+			"html_url": "https://github.com/owner/repo/pull/12",
+			"base": {"ref": "main"},
+			"head": {"ref": "feature"}
+		}]`)
+	})
+
+	pr, err := client.FetchPRForBranch("feature")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pr).To(Equal(&PullRequest{
+		BaseRefName: "main",
+		HeadRefName: "feature",
+		State:       "OPEN",
+		URL:         "https://github.com/owner/repo/pull/12",
+		Number:      12,
+		Title:       "Title",
+		Body:        "line 1\nline 2",
+	}))
+}
+
+func TestRESTClient_FetchPRByURLOrNum(t *testing.T) {
+	g := gomega.NewWithT(t)
+	client := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.URL.Path).To(Equal("/repos/owner/repo/pulls/7"))
+		fmt.Fprint(w, `{"number": 7, "state": "closed", "merged_at": "2024-01-01T00:00:00Z", "body": null}`)
+	})
+
+	for _, prURLOrNum := range []string{"7", "#7", "https://github.com/owner/repo/pull/7"} {
+		pr, err := client.FetchPRByURLOrNum(prURLOrNum)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(pr.Number).To(Equal(7))
+		g.Expect(pr.State).To(Equal("MERGED"))
+		g.Expect(pr.Body).To(BeEmpty())
+	}
+}
+
+func TestRESTClient_FetchPRs(t *testing.T) {
+	g := gomega.NewWithT(t)
+	client := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.Method).To(Equal(http.MethodPost))
+		g.Expect(r.URL.Path).To(Equal("/graphql"))
+		var req struct {
+			Query     string
+			Variables map[string]string
+		}
+		g.Expect(json.NewDecoder(r.Body).Decode(&req)).To(Succeed())
+		g.Expect(req.Query).To(ContainSubstring("b0: pullRequests(headRefName: $b0"))
+		g.Expect(req.Query).To(ContainSubstring("n1: pullRequest(number: 99)"))
+		g.Expect(req.Variables).To(Equal(map[string]string{
+			"owner": "owner",
+			"name":  "repo",
+			"b0":    "feature",
+			"b1":    "no-pr",
+		}))
+		fmt.Fprint(w, `{
+			"data": {"repository": {
+				"b0": {"nodes": [{"number": 1, "state": "OPEN", "headRefName": "feature"}]},
+				"b1": {"nodes": []},
+				"n0": {"number": 2, "state": "MERGED", "body": "a\r\nb"},
+				"n1": null
+			}},
+			"errors": [{"type": "NOT_FOUND", "message": "Could not resolve to a PullRequest with the number of 99."}]
+		}`)
+	})
+
+	prsByBranch, prsByNum, err := client.FetchPRs([]string{"feature", "no-pr"}, []int{2, 99})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(prsByBranch).To(HaveLen(1))
+	g.Expect(prsByBranch["feature"].Number).To(Equal(1))
+	g.Expect(prsByNum).To(HaveLen(1))
+	g.Expect(prsByNum[2].State).To(Equal("MERGED"))
+	g.Expect(prsByNum[2].Body).To(Equal("a\nb"))
+}
+
+func TestRESTClient_FetchPRStatuses(t *testing.T) {
+	g := gomega.NewWithT(t)
+	client := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.URL.Path).To(Equal("/graphql"))
+		var req struct {
+			Query     string
+			Variables map[string]string
+		}
+		g.Expect(json.NewDecoder(r.Body).Decode(&req)).To(Succeed())
+		g.Expect(req.Query).To(ContainSubstring("n0: pullRequest(number: 3) { number isDraft"))
+		g.Expect(req.Variables).To(Equal(map[string]string{"owner": "owner", "name": "repo"}))
+		fmt.Fprint(w, `{
+			"data": {"repository": {
+				"n0": {
+					"number": 3,
+					"isDraft": true,
+					"reviewDecision": "CHANGES_REQUESTED",
+					"mergeable": "CONFLICTING",
+					"commits": {"nodes": [{"commit": {"statusCheckRollup": {"state": "FAILURE"}}}]}
+				},
+				"n1": {
+					"number": 4,
+					"isDraft": false,
+					"reviewDecision": null,
+					"mergeable": "MERGEABLE",
+					"commits": {"nodes": [{"commit": {"statusCheckRollup": null}}]}
+				},
+				"n2": null
+			}},
+			"errors": [{"type": "NOT_FOUND", "message": "Could not resolve to a PullRequest with the number of 99."}]
+		}`)
+	})
+
+	statuses, err := client.FetchPRStatuses([]int{3, 4, 99})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(statuses).To(Equal(map[int]*PRStatus{
+		3: {Number: 3, IsDraft: true, ReviewDecision: "CHANGES_REQUESTED", CheckState: "FAILURE", Mergeable: "CONFLICTING"},
+		4: {Number: 4, Mergeable: "MERGEABLE"},
+	}))
+}
+
+func TestRESTClient_EditPR(t *testing.T) {
+	testCases := map[string]struct {
+		statusCode   int
+		response     string
+		expectedErr  error
+		expectedBody map[string]any
+	}{
+		"success": {
+			statusCode:   http.StatusOK,
+			response:     `{}`,
+			expectedBody: map[string]any{"body": "new body"},
+		},
+		"base branch not found": {
+			statusCode:   http.StatusUnprocessableEntity,
+			response:     `{"message": "Validation Failed", "errors": [{"resource": "PullRequest", "field": "base", "code": "invalid"}]}`,
+			expectedErr:  ErrBaseBranchNotFound,
+			expectedBody: map[string]any{"body": "new body"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			client := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+				g.Expect(r.Method).To(Equal(http.MethodPatch))
+				g.Expect(r.URL.Path).To(Equal("/repos/owner/repo/pulls/3"))
+				var body map[string]any
+				g.Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				g.Expect(body).To(Equal(tc.expectedBody))
+				w.WriteHeader(tc.statusCode)
+				fmt.Fprint(w, tc.response)
+			})
+
+			newBody := "new body"
+			err := client.EditPR(3, EditPROpts{Body: &newBody})
+			if tc.expectedErr == nil {
+				g.Expect(err).ToNot(HaveOccurred())
+			} else {
+				g.Expect(err).To(MatchError(tc.expectedErr))
+			}
+		})
+	}
+}
+
+func TestRESTClient_ClosePR(t *testing.T) {
+	g := gomega.NewWithT(t)
+	var requests []string
+	client := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		g.Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+		requests = append(requests, fmt.Sprintf("%s %s %v", r.Method, r.URL.Path, body))
+		fmt.Fprint(w, `{}`)
+	})
+
+	g.Expect(client.ClosePR(3, "Folded into #2.")).To(Succeed())
+	g.Expect(requests).To(Equal([]string{
+		"POST /repos/owner/repo/issues/3/comments map[body:Folded into #2.]",
+		"PATCH /repos/owner/repo/pulls/3 map[state:closed]",
+	}))
+}
+
+func TestRESTClient_fork(t *testing.T) {
+	g := gomega.NewWithT(t)
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if r.Method == http.MethodPost {
+			g.Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+			fmt.Fprint(w, `{"number": 4, "head": {"ref": "feature", "user": {"login": "fork-owner"}}}`)
+		} else {
+			fmt.Fprint(w, `[]`)
+		}
+		requests = append(requests, fmt.Sprintf("%s %s %s %v", r.Method, r.URL.Path, r.URL.Query().Get("head"), body["head"]))
+	}))
+	t.Cleanup(server.Close)
+	client := NewRESTClient(server.URL, "token", testRepo, "fork-owner", server.Client())
+
+	pr, err := client.FetchPRForBranch("feature")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pr).To(BeNil())
+	pr, err = client.CreatePR(CreatePROpts{Head: "feature", Base: "main"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pr.HeadRefName).To(Equal("feature"))
+	g.Expect(pr.HeadRepositoryOwner.Login).To(Equal("fork-owner"))
+	g.Expect(requests).To(Equal([]string{
+		"GET /repos/owner/repo/pulls fork-owner:feature <nil>",
+		"POST /repos/owner/repo/pulls  fork-owner:feature",
+	}))
+}
+
+func TestRESTClient_APIError(t *testing.T) {
+	g := gomega.NewWithT(t)
+	client := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	})
+
+	_, err := client.FetchPRByNum(1)
+	var apiErr *APIError
+	g.Expect(errors.As(err, &apiErr)).To(BeTrue())
+	g.Expect(apiErr.StatusCode).To(Equal(http.StatusNotFound))
+	g.Expect(apiErr.Message).To(Equal("Not Found"))
+}
+
+func TestParseRemoteURL(t *testing.T) {
+	testCases := map[string]Repo{
+		"https://github.com/owner/repo.git":        testRepo,
+		"https://github.com/owner/repo":            testRepo,
+		"git@github.com:owner/repo.git":            testRepo,
+		"ssh://git@github.com/owner/repo.git":      testRepo,
+		"git@ghe.example.com:owner/repo":           {Host: "ghe.example.com", Owner: "owner", Name: "repo"},
+		"https://user@ghe.example.com/owner/repo/": {Host: "ghe.example.com", Owner: "owner", Name: "repo"},
+	}
+	for remoteURL, expected := range testCases {
+		t.Run(remoteURL, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			repo, err := ParseRemoteURL(remoteURL)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(repo).To(Equal(expected))
+		})
+	}
+}
+
+func TestFindToken(t *testing.T) {
+	g := gomega.NewWithT(t)
+	configDir := t.TempDir()
+	t.Setenv("GH_CONFIG_DIR", configDir)
+	t.Setenv("GH_TOKEN", "")
+	t.Setenv("GITHUB_TOKEN", "")
+	err := os.WriteFile(
+		filepath.Join(configDir, "hosts.yml"),
+		[]byte("github.com:\n    user: owner\n    oauth_token: from-config\n"),
+		0o600,
+	)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	token, err := findToken("github.com")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(token).To(Equal("from-config"))
+
+	t.Setenv("GH_TOKEN", "from-env")
+	token, err = findToken("github.com")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(token).To(Equal("from-env"))
+}
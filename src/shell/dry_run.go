@@ -0,0 +1,303 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// DryRunRunner runs read-only commands with another runner and only prints the other commands.
+// Commands that are not printed return an empty output.
+type DryRunRunner struct {
+	runner Runner
+}
+
+func NewDryRunRunner(runner Runner) *DryRunRunner {
+	return &DryRunRunner{runner: runner}
+}
+
+func (d *DryRunRunner) Run(opt Opt, cmdStr string) (string, error) {
+	if IsReadOnly(cmdStr) {
+		return d.runner.Run(opt, cmdStr)
+	}
+	fmt.Printf("[dry-run] %s\n", cmdStr)
+	return "", nil
+}
+
+// IsReadOnly returns whether the command only queries state, i.e. whether each of its simple commands
+// is a known read-only command that does not write files outside of the temp directory.
+// Unknown commands are assumed to mutate state.
+func IsReadOnly(cmdStr string) bool {
+	words, ok := splitShellWords(cmdStr)
+	if !ok {
+		return false
+	}
+	var command []string
+	for i := 0; i <= len(words); i++ {
+		if i < len(words) && !lo.Contains(shellOperators, words[i]) {
+			command = append(command, words[i])
+			continue
+		}
+		if !isSimpleCommandReadOnly(command) {
+			return false
+		}
+		command = nil
+	}
+	return true
+}
+
+var shellOperators = []string{"&&", "||", ";", "|"}
+
+var readOnlyCommands = []string{
+	"awk", "cat", "cd", "cut", "echo", "grep", "head", "ls", "printf", "pwd", "sort", "tail", "test",
+	"tr", "true", "uniq", "wc", "which",
+}
+
+var readOnlyGitSubcommands = []string{
+	"blame", "cat-file", "check-ref-format", "cherry", "describe", "diff", "diff-index", "diff-tree",
+	"for-each-ref", "grep", "help", "log", "ls-files", "ls-tree", "merge-base", "name-rev", "patch-id",
+	"range-diff", "rev-list", "rev-parse", "shortlog", "show", "show-ref", "status", "var", "version",
+}
+
+func isSimpleCommandReadOnly(command []string) bool {
+	// Drop redirections, which are only allowed to discard output or to write temp files.
+	var args []string
+	for i := 0; i < len(command); i++ {
+		word := command[i]
+		target, isRedirect := parseRedirect(word)
+		if !isRedirect {
+			args = append(args, word)
+			continue
+		}
+		if target == "" && i+1 < len(command) {
+			i++
+			target = command[i]
+		}
+		if strings.HasPrefix(word, "<") || strings.HasPrefix(target, "&") {
+			continue
+		}
+		if !isScratchFile(target) {
+			return false
+		}
+	}
+	if len(args) == 0 {
+		return true
+	}
+
+	switch args[0] {
+	case "git":
+		return isGitCommandReadOnly(args[1:])
+	case "gh":
+		return isGHCommandReadOnly(args[1:])
+	case "sed":
+		return !lo.ContainsBy(args[1:], func(arg string) bool {
+			return strings.HasPrefix(arg, "-i") || arg == "--in-place"
+		})
+	}
+	return lo.Contains(readOnlyCommands, args[0])
+}
+
+// Returns the target of a redirection word such as ">", "2>/dev/null" or "2>&1".
+// The target is empty if it is the next word.
+func parseRedirect(word string) (string, bool) {
+	trimmed := strings.TrimLeft(word, "0123456789")
+	for _, op := range []string{">>", ">", "<"} {
+		if strings.HasPrefix(trimmed, op) {
+			return strings.TrimPrefix(trimmed, op), true
+		}
+	}
+	return "", false
+}
+
+func isScratchFile(path string) bool {
+	if path == "/dev/null" {
+		return true
+	}
+	rel, err := filepath.Rel(os.TempDir(), path)
+	return err == nil && !strings.HasPrefix(rel, "..")
+}
+
+func isGitCommandReadOnly(args []string) bool {
+	// Skip global options.
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		if lo.Contains([]string{"-c", "-C", "--git-dir", "--work-tree"}, args[0]) {
+			args = args[1:]
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return true
+	}
+	subcommand, args := args[0], args[1:]
+	if lo.Contains(args, "--dry-run") {
+		return true
+	}
+	flags, positional := splitFlags(args)
+	hasFlag := func(names ...string) bool {
+		return lo.Some(flags, names)
+	}
+
+	switch subcommand {
+	case "branch":
+		if hasFlag("-d", "-D", "--delete", "-m", "-M", "--move", "-c", "-C", "--copy", "-f", "--force",
+			"-u", "--set-upstream-to", "--unset-upstream", "--edit-description") {
+			return false
+		}
+		return len(positional) == 0 ||
+			hasFlag("--list", "-l", "--show-current", "--points-at", "--contains", "--no-contains",
+				"--merged", "--no-merged", "--format", "-a", "--all", "-r", "--remotes")
+	case "config":
+		if hasFlag("--get", "--get-all", "--get-regexp", "--get-urlmatch", "--list", "-l") {
+			return true
+		}
+		return len(positional) == 1 && !hasFlag("--unset", "--unset-all", "--add", "--replace-all",
+			"--remove-section", "--rename-section", "-e", "--edit")
+	case "remote":
+		return len(positional) == 0 || lo.Contains([]string{"get-url", "show"}, positional[0]) ||
+			(positional[0] == "prune" && hasFlag("-n"))
+	case "symbolic-ref":
+		return len(positional) == 1 && !hasFlag("-d", "--delete")
+	case "stash", "worktree":
+		return len(positional) > 0 && positional[0] == "list"
+	case "push", "add", "clean":
+		return hasFlag("-n")
+	}
+	return lo.Contains(readOnlyGitSubcommands, subcommand)
+}
+
+func isGHCommandReadOnly(args []string) bool {
+	flags, positional := splitFlags(args)
+	if len(positional) == 0 {
+		return true
+	}
+	switch positional[0] {
+	case "pr":
+		return len(positional) > 1 &&
+			lo.Contains([]string{"list", "view", "status", "checks", "diff"}, positional[1])
+	case "repo":
+		return len(positional) > 1 && positional[1] == "view"
+	case "auth":
+		return len(positional) > 1 && positional[1] == "status"
+	case "api":
+		if len(positional) > 1 && positional[1] == "graphql" {
+			// Queries are sent with POST too, so only mutations are excluded.
+			return !lo.ContainsBy(args, func(arg string) bool {
+				query, ok := strings.CutPrefix(arg, "query=")
+				return ok && strings.HasPrefix(strings.TrimSpace(query), "mutation")
+			})
+		}
+		method := "GET"
+		for i, arg := range args {
+			if (arg == "-X" || arg == "--method") && i+1 < len(args) {
+				method = args[i+1]
+			}
+		}
+		// Fields turn the request into a POST unless the method is given.
+		hasFields := lo.Some(flags, []string{"-f", "-F", "--field", "--raw-field", "--input"})
+		return strings.EqualFold(method, "GET") && (!hasFields || lo.Contains(args, "-X"))
+	}
+	return false
+}
+
+// Returns the flags and the positional arguments. Values of flags are counted as positional arguments.
+func splitFlags(args []string) ([]string, []string) {
+	var flags []string
+	var positional []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			name, _, _ := strings.Cut(arg, "=")
+			flags = append(flags, name)
+		} else {
+			positional = append(positional, arg)
+		}
+	}
+	return flags, positional
+}
+
+// Splits a command line into words, removing quotes. Operators such as "&&" are separate words.
+// Command substitutions are kept as single words. Returns false if the command cannot be parsed.
+func splitShellWords(cmdStr string) ([]string, bool) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	flush := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	for i := 0; i < len(cmdStr); i++ {
+		c := cmdStr[i]
+		switch {
+		case c == '\'':
+			end := strings.IndexByte(cmdStr[i+1:], '\'')
+			if end == -1 {
+				return nil, false
+			}
+			word.WriteString(cmdStr[i+1 : i+1+end])
+			inWord = true
+			i += end + 1
+		case c == '"':
+			i++
+			for ; i < len(cmdStr) && cmdStr[i] != '"'; i++ {
+				if cmdStr[i] == '\\' && i+1 < len(cmdStr) {
+					i++
+				}
+				word.WriteByte(cmdStr[i])
+			}
+			if i == len(cmdStr) {
+				return nil, false
+			}
+			inWord = true
+		case c == '\\' && i+1 < len(cmdStr):
+			i++
+			word.WriteByte(cmdStr[i])
+			inWord = true
+		case c == '$' && i+1 < len(cmdStr) && cmdStr[i+1] == '(':
+			// Command substitutions run before the command, so they must be read-only too.
+			depth := 0
+			start := i
+			for ; i < len(cmdStr); i++ {
+				if cmdStr[i] == '(' {
+					depth++
+				} else if cmdStr[i] == ')' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if i == len(cmdStr) || !IsReadOnly(cmdStr[start+2:i]) {
+				return nil, false
+			}
+			word.WriteString(cmdStr[start : i+1])
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			flush()
+		case c == ';' || c == '|' || c == '&':
+			// "&" alone backgrounds a command, which is treated like ";". "2>&1" is part of a word.
+			if c == '&' && inWord && strings.HasSuffix(word.String(), ">") {
+				word.WriteByte(c)
+				continue
+			}
+			flush()
+			if (c == '|' || c == '&') && i+1 < len(cmdStr) && cmdStr[i+1] == c {
+				words = append(words, string([]byte{c, c}))
+				i++
+			} else if c == '&' {
+				words = append(words, ";")
+			} else {
+				words = append(words, string(c))
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	flush()
+	return words, true
+}
@@ -0,0 +1,64 @@
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+)
+
+func TestIsReadOnly(t *testing.T) {
+	g := gomega.NewWithT(t)
+	tmpFile := filepath.Join(os.TempDir(), "patch")
+	for cmd, readOnly := range map[string]bool{
+		"git rev-parse --abbrev-ref HEAD":                        true,
+		"git -c color.ui=always log --oneline":                   true,
+		"git branch --show-current":                              true,
+		"git branch --points-at abc --format '%(refname:short)'": true,
+		"git branch a":                                             false,
+		"git branch -D a b":                                        false,
+		"git config --get branch.a.description":                    true,
+		"git config branch.a.description":                          true,
+		"git config branch.a.description 'Title'":                  false,
+		"git config --unset branch.a.description":                  false,
+		"git merge-base --is-ancestor a b && echo yes":             true,
+		"git add --all && git commit -m 'x; git status'":           false,
+		"git switch a":                                             false,
+		"git push --porcelain --dry-run origin a":                  true,
+		"git push --porcelain origin a":                            false,
+		"git remote prune --dry-run origin":                        true,
+		"git remote prune origin":                                  false,
+		"git status 2>&1":                                          true,
+		"git diff-index abc --binary > " + tmpFile:                 true,
+		"git diff-index abc --binary > patch":                      false,
+		"cd $(git rev-parse --show-toplevel) && git apply patch":   false,
+		"cd $(git rev-parse --show-toplevel) && git status":        true,
+		"cd $(git checkout a) && git status":                       false,
+		"git branch -a | awk '{print $1}'":                         true,
+		"sed -i s/a/b/ file":                                       false,
+		"gh pr list -s open -H a --json url":                       true,
+		"gh pr view 1 --json url":                                  true,
+		"gh pr create --head a --title t --body b":                 false,
+		"gh pr edit 1 --base main":                                 false,
+		"gh api graphql -f query='query { viewer { login } }'":     true,
+		"gh api graphql -f query='mutation { addComment { id } }'": false,
+		"gh api repos/o/r/pulls":                                   true,
+		"gh api -X PATCH repos/o/r/pulls/1":                        false,
+		"rm -rf .git":                                              false,
+		"echo 'unterminated":                                       false,
+	} {
+		g.Expect(IsReadOnly(cmd)).To(Equal(readOnly), cmd)
+	}
+}
+
+func TestDryRunRunner(t *testing.T) {
+	g := gomega.NewWithT(t)
+	inner := NewFakeRunner(Fixture{Command: "git branch --show-current", Output: "a"})
+	runner := NewDryRunRunner(inner)
+
+	g.Expect(runner.Run(Opt{}, "git branch --show-current")).To(Equal("a"))
+	g.Expect(runner.Run(Opt{}, "git switch b")).To(BeEmpty())
+	g.Expect(inner.Commands()).To(Equal([]string{"git branch --show-current"}))
+}
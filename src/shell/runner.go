@@ -0,0 +1,191 @@
+package shell
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Runner runs shell commands. Run returns the output even if the command fails.
+type Runner interface {
+	Run(opt Opt, cmdStr string) (string, error)
+}
+
+var defaultRunner Runner = BashRunner{}
+
+// DefaultRunner returns the runner used by Run and RunAndCollectLines.
+func DefaultRunner() Runner {
+	return defaultRunner
+}
+
+// SetDefaultRunner replaces the runner used by Run and RunAndCollectLines.
+// Returns a function that restores the previous runner.
+func SetDefaultRunner(runner Runner) func() {
+	previous := defaultRunner
+	defaultRunner = runner
+	return func() {
+		defaultRunner = previous
+	}
+}
+
+// Fixture is a command and its result, as recorded by RecordingRunner and replayed by FakeRunner.
+type Fixture struct {
+	Command string
+	Output  string
+	// Empty if the command succeeded.
+	Error string `json:",omitempty"`
+	// Exit code of the command if it failed with one.
+	ExitCode int `json:",omitempty"`
+}
+
+// ExitError is returned by FakeRunner for a replayed command that exited with a non-zero code.
+type ExitError struct {
+	Code    int
+	Message string
+}
+
+func (e *ExitError) Error() string {
+	return e.Message
+}
+
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// ExitCode returns the exit code of the command that failed with the error,
+// whether it was run or replayed. Returns false if the command did not exit with a code.
+func ExitCode(err error) (int, bool) {
+	var exitErr interface{ ExitCode() int }
+	if !errors.As(err, &exitErr) {
+		return 0, false
+	}
+	return exitErr.ExitCode(), true
+}
+
+// LoadFixtures reads fixtures saved by RecordingRunner.
+func LoadFixtures(path string) ([]Fixture, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading fixtures: %w", err)
+	}
+	var fixtures []Fixture
+	err = json.Unmarshal(content, &fixtures)
+	if err != nil {
+		return nil, fmt.Errorf("decoding fixtures %q: %w", path, err)
+	}
+	return fixtures, nil
+}
+
+// FakeRunner replays scripted results instead of running commands.
+// Each fixture is used once, and fixtures of the same command are used in order.
+// Unexpected commands fail.
+type FakeRunner struct {
+	mu       sync.Mutex
+	fixtures []Fixture
+	used     []bool
+	commands []string
+}
+
+func NewFakeRunner(fixtures ...Fixture) *FakeRunner {
+	return &FakeRunner{
+		fixtures: fixtures,
+		used:     make([]bool, len(fixtures)),
+	}
+}
+
+func (f *FakeRunner) Run(opt Opt, cmdStr string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, cmdStr)
+	for i, fixture := range f.fixtures {
+		if f.used[i] || fixture.Command != cmdStr {
+			continue
+		}
+		f.used[i] = true
+		if opt.StreamOutputToStdout {
+			fmt.Print(fixture.Output)
+		}
+		if fixture.ExitCode != 0 {
+			return fixture.Output, fmt.Errorf(
+				"running command: %q: %w",
+				cmdStr,
+				&ExitError{Code: fixture.ExitCode, Message: fixture.Error},
+			)
+		}
+		if fixture.Error != "" {
+			return fixture.Output, fmt.Errorf("running command: %q: %s", cmdStr, fixture.Error)
+		}
+		return fixture.Output, nil
+	}
+	return "", fmt.Errorf("running command: %q: unexpected command", cmdStr)
+}
+
+// Commands returns the commands run so far, in order.
+func (f *FakeRunner) Commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+// Unused returns the fixtures that were not replayed.
+func (f *FakeRunner) Unused() []Fixture {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var unused []Fixture
+	for i, fixture := range f.fixtures {
+		if !f.used[i] {
+			unused = append(unused, fixture)
+		}
+	}
+	return unused
+}
+
+// RecordingRunner runs commands with another runner and records them as fixtures.
+type RecordingRunner struct {
+	runner   Runner
+	mu       sync.Mutex
+	fixtures []Fixture
+}
+
+func NewRecordingRunner(runner Runner) *RecordingRunner {
+	return &RecordingRunner{runner: runner}
+}
+
+func (r *RecordingRunner) Run(opt Opt, cmdStr string) (string, error) {
+	out, err := r.runner.Run(opt, cmdStr)
+	fixture := Fixture{Command: cmdStr, Output: out}
+	if err != nil {
+		// FakeRunner adds the command back when replaying.
+		fixture.Error = err.Error()
+		if cause := errors.Unwrap(err); cause != nil {
+			fixture.Error = cause.Error()
+		}
+		fixture.ExitCode, _ = ExitCode(err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fixtures = append(r.fixtures, fixture)
+	return out, err
+}
+
+// Fixtures returns the commands recorded so far, in order.
+func (r *RecordingRunner) Fixtures() []Fixture {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Fixture(nil), r.fixtures...)
+}
+
+// Save writes the recorded fixtures to a JSON file that LoadFixtures can read.
+func (r *RecordingRunner) Save(path string) error {
+	content, err := json.MarshalIndent(r.Fixtures(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding fixtures: %w", err)
+	}
+	err = os.WriteFile(path, append(content, '\n'), 0o644)
+	if err != nil {
+		return fmt.Errorf("writing fixtures: %w", err)
+	}
+	return nil
+}
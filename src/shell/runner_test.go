@@ -0,0 +1,63 @@
+package shell
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+)
+
+func TestFakeRunner(t *testing.T) {
+	g := gomega.NewWithT(t)
+	runner := NewFakeRunner(
+		Fixture{Command: "git branch --show-current", Output: "a"},
+		Fixture{Command: "git branch --show-current", Output: "b"},
+		Fixture{Command: "git merge-base --is-ancestor a b", Error: "exit status 1"},
+		Fixture{Command: "unused"},
+	)
+
+	g.Expect(runner.Run(Opt{}, "git branch --show-current")).To(Equal("a"))
+	g.Expect(runner.Run(Opt{}, "git branch --show-current")).To(Equal("b"))
+	_, err := runner.Run(Opt{}, "git merge-base --is-ancestor a b")
+	g.Expect(err).To(MatchError(ContainSubstring("exit status 1")))
+	_, err = runner.Run(Opt{}, "git branch --show-current")
+	g.Expect(err).To(MatchError(ContainSubstring("unexpected command")))
+
+	g.Expect(runner.Commands()).To(Equal([]string{
+		"git branch --show-current",
+		"git branch --show-current",
+		"git merge-base --is-ancestor a b",
+		"git branch --show-current",
+	}))
+	g.Expect(runner.Unused()).To(Equal([]Fixture{{Command: "unused"}}))
+}
+
+func TestRecordingRunner_replay(t *testing.T) {
+	g := gomega.NewWithT(t)
+	recorder := NewRecordingRunner(BashRunner{})
+	restore := SetDefaultRunner(recorder)
+	g.Expect(RunAndCollectLines(Opt{}, "printf 'a\\nb\\n'")).To(Equal([]string{"a", "b"}))
+	_, err := Run(Opt{SuppressStderrStreaming: true}, "echo partial; exit 3")
+	g.Expect(err).To(HaveOccurred())
+	restore()
+	g.Expect(DefaultRunner()).To(Equal(BashRunner{}))
+
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	g.Expect(recorder.Save(path)).To(Succeed())
+	fixtures, err := LoadFixtures(path)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(fixtures).To(Equal([]Fixture{
+		{Command: "printf 'a\\nb\\n'", Output: "a\nb"},
+		{Command: "echo partial; exit 3", Output: "partial\n", Error: "exit status 3", ExitCode: 3},
+	}))
+
+	replay := NewFakeRunner(fixtures...)
+	g.Expect(RunAndCollectLinesWith(replay, Opt{}, "printf 'a\\nb\\n'")).To(Equal([]string{"a", "b"}))
+	out, err := replay.Run(Opt{}, "echo partial; exit 3")
+	g.Expect(out).To(Equal("partial\n"))
+	g.Expect(err).To(MatchError(`running command: "echo partial; exit 3": exit status 3`))
+	exitCode, ok := ExitCode(err)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(exitCode).To(Equal(3))
+}
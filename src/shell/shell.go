@@ -13,6 +13,9 @@ type Opt struct {
 	StripTrailingNewline       bool
 	SuppressStderrStreaming    bool
 	CombinedStdoutStderrOutput bool
+	// Interactive connects the command to the terminal so that it can prompt the user.
+	// The output is not captured.
+	Interactive bool
 }
 
 type saveOutput struct {
@@ -24,7 +27,15 @@ func (so *saveOutput) Write(p []byte) (n int, err error) {
 	return os.Stdout.Write(p)
 }
 
+// Run runs the command with the default runner.
 func Run(opt Opt, cmdStr string) (string, error) {
+	return defaultRunner.Run(opt, cmdStr)
+}
+
+// BashRunner runs commands with `bash -c`.
+type BashRunner struct{}
+
+func (BashRunner) Run(opt Opt, cmdStr string) (string, error) {
 	cmd := exec.Command("bash", "-c", cmdStr)
 
 	var (
@@ -42,7 +53,11 @@ func Run(opt Opt, cmdStr string) (string, error) {
 	if !opt.SuppressStderrStreaming && !opt.CombinedStdoutStderrOutput {
 		cmd.Stderr = os.Stderr
 	}
-	if opt.StreamOutputToStdout {
+	if opt.Interactive {
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		err = cmd.Run()
+	} else if opt.StreamOutputToStdout {
 		var so saveOutput
 		cmd.Stdout = &so
 		err = cmd.Run()
@@ -68,8 +83,12 @@ func Run(opt Opt, cmdStr string) (string, error) {
 }
 
 func RunAndCollectLines(opt Opt, cmdStr string) ([]string, error) {
+	return RunAndCollectLinesWith(defaultRunner, opt, cmdStr)
+}
+
+func RunAndCollectLinesWith(runner Runner, opt Opt, cmdStr string) ([]string, error) {
 	opt.StripTrailingNewline = true
-	out, err := Run(opt, cmdStr)
+	out, err := runner.Run(opt, cmdStr)
 	if err != nil {
 		return nil, err
 	}
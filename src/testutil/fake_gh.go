@@ -0,0 +1,483 @@
+package testutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yapaluc/hg-git/src/github"
+)
+
+// The test binary acts as the fake gh when this environment variable is set.
+const fakeGHEnvVar = "HGGIT_FAKE_GH"
+
+// Path of the JSON store of the fake gh.
+const fakeGHStoreEnvVar = "HGGIT_FAKE_GH_STORE"
+
+// FakeRepoURL is the web URL of the repository served by the fake gh.
+const FakeRepoURL = "https://github.com/owner/repo"
+
+// FakeGH is a stub gh CLI backed by a JSON file of PRs.
+// It is installed on PATH as a script that re-executes the test binary,
+// so the test package must call RunFakeGHIfRequested from TestMain.
+type FakeGH struct {
+	t         *testing.T
+	storePath string
+}
+
+type fakeGHStore struct {
+	// Bare repository of the remote, used to check that base branches exist.
+	OriginDir string
+	PRs       []*github.PullRequest
+	// Statuses of the PRs by number. PRs without a status are mergeable and have no review or checks.
+	Statuses map[int]*github.PRStatus
+	// Statuses that the PRs go through once their base branch changes, by number.
+	RetargetStatuses map[int][]*github.PRStatus
+	// Statuses that the PRs get next, one per fetch of their status, by number.
+	NextStatuses map[int][]*github.PRStatus
+	// Comments posted on the PRs by number.
+	Comments map[int][]string
+	// Errors returned when merging the PRs by number, e.g. for a failing merge hook.
+	MergeErrors map[int]string
+}
+
+// RunFakeGHIfRequested runs the fake gh and exits if the test binary was invoked as gh.
+// Must be called at the beginning of TestMain.
+func RunFakeGHIfRequested() {
+	if os.Getenv(fakeGHEnvVar) == "" {
+		return
+	}
+	out, err := runFakeGH(os.Getenv(fakeGHStoreEnvVar), os.Args[1:])
+	fmt.Print(out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// InstallFakeGH puts a fake gh for the repository first on PATH.
+func InstallFakeGH(t *testing.T, repo *Repo) *FakeGH {
+	t.Helper()
+	testBinary, err := os.Executable()
+	if err != nil {
+		t.Fatalf("getting path of the test binary: %s", err)
+	}
+	dir := t.TempDir()
+	f := &FakeGH{t: t, storePath: filepath.Join(dir, "store.json")}
+	f.update(func(store *fakeGHStore) {
+		store.OriginDir = repo.OriginDir
+	})
+
+	script := fmt.Sprintf("#!/bin/sh\n%s=1 exec '%s' \"$@\"\n", fakeGHEnvVar, testBinary)
+	err = os.WriteFile(filepath.Join(dir, "gh"), []byte(script), 0o755)
+	if err != nil {
+		t.Fatalf("writing fake gh: %s", err)
+	}
+	t.Setenv(fakeGHStoreEnvVar, f.storePath)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return f
+}
+
+// PRs returns all the PRs ordered by number.
+func (f *FakeGH) PRs() []*github.PullRequest {
+	f.t.Helper()
+	var prs []*github.PullRequest
+	f.update(func(store *fakeGHStore) {
+		prs = store.PRs
+	})
+	return prs
+}
+
+// PR returns the PR with the given number.
+func (f *FakeGH) PR(prNum int) *github.PullRequest {
+	f.t.Helper()
+	prs := f.PRs()
+	if prNum < 1 || prNum > len(prs) {
+		f.t.Fatalf("no PR #%d", prNum)
+	}
+	return prs[prNum-1]
+}
+
+// AddPR adds an open PR, e.g. one opened from the fork of another user, and returns it with its number.
+// The head branch is not pushed anywhere.
+func (f *FakeGH) AddPR(pr github.PullRequest) *github.PullRequest {
+	f.t.Helper()
+	f.update(func(store *fakeGHStore) {
+		pr.Number = len(store.PRs) + 1
+		pr.URL = fmt.Sprintf("%s/pull/%d", FakeRepoURL, pr.Number)
+		pr.State = "OPEN"
+		store.PRs = append(store.PRs, &pr)
+	})
+	return &pr
+}
+
+// MergePR marks the PR as merged. It does not change the remote branches.
+func (f *FakeGH) MergePR(prNum int) {
+	f.t.Helper()
+	f.update(func(store *fakeGHStore) {
+		store.PRs[prNum-1].State = "MERGED"
+	})
+}
+
+// SetPRStatus sets the review, CI and merge status of the PR with the status's number.
+func (f *FakeGH) SetPRStatus(status github.PRStatus) {
+	f.t.Helper()
+	f.update(func(store *fakeGHStore) {
+		if store.Statuses == nil {
+			store.Statuses = make(map[int]*github.PRStatus)
+		}
+		store.Statuses[status.Number] = &status
+	})
+}
+
+// SetPRStatusAfterRetarget sets the status that the PR with the statuses' number gets once its base
+// branch changes, like when GitHub reruns its checks against the new base.
+// With several statuses, the PR moves to the next one each time its status is fetched, like when the checks finish.
+func (f *FakeGH) SetPRStatusAfterRetarget(statuses ...github.PRStatus) {
+	f.t.Helper()
+	f.update(func(store *fakeGHStore) {
+		if store.RetargetStatuses == nil {
+			store.RetargetStatuses = make(map[int][]*github.PRStatus)
+		}
+		for _, status := range statuses {
+			store.RetargetStatuses[status.Number] = append(store.RetargetStatuses[status.Number], &status)
+		}
+	})
+}
+
+// FailMerge makes merging the PR fail with the given message.
+func (f *FakeGH) FailMerge(prNum int, message string) {
+	f.t.Helper()
+	f.update(func(store *fakeGHStore) {
+		if store.MergeErrors == nil {
+			store.MergeErrors = make(map[int]string)
+		}
+		store.MergeErrors[prNum] = message
+	})
+}
+
+// Comments returns the comments posted on the PR, oldest first.
+func (f *FakeGH) Comments(prNum int) []string {
+	f.t.Helper()
+	var comments []string
+	f.update(func(store *fakeGHStore) {
+		comments = store.Comments[prNum]
+	})
+	return comments
+}
+
+func (f *FakeGH) update(fn func(store *fakeGHStore)) {
+	f.t.Helper()
+	err := updateFakeGHStore(f.storePath, func(store *fakeGHStore) error {
+		fn(store)
+		return nil
+	})
+	if err != nil {
+		f.t.Fatalf("updating fake gh store: %s", err)
+	}
+}
+
+// Loads the store, applies the function and saves the store.
+// Holds a lock file since gh is invoked concurrently.
+func updateFakeGHStore(storePath string, fn func(store *fakeGHStore) error) error {
+	lockPath := storePath + ".lock"
+	for {
+		lock, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			lock.Close()
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("creating lock file: %w", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	defer os.Remove(lockPath)
+
+	var store fakeGHStore
+	content, err := os.ReadFile(storePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("reading store: %w", err)
+	}
+	if err == nil {
+		err = json.Unmarshal(content, &store)
+		if err != nil {
+			return fmt.Errorf("decoding store: %w", err)
+		}
+	}
+
+	err = fn(&store)
+	if err != nil {
+		return err
+	}
+
+	content, err = json.Marshal(&store)
+	if err != nil {
+		return fmt.Errorf("encoding store: %w", err)
+	}
+	return os.WriteFile(storePath, content, 0o644)
+}
+
+var fakeGHPRNumAliasRegexp = regexp.MustCompile(`(n\d+): pullRequest\(number: (\d+)\)`)
+
+// Implements the subset of gh commands used by the github package.
+func runFakeGH(storePath string, args []string) (string, error) {
+	if len(args) < 2 {
+		return "", fmt.Errorf("fake gh: unsupported command %q", args)
+	}
+	command := args[0] + " " + args[1]
+	flags, positional := parseFakeGHArgs(args[2:])
+
+	var out string
+	err := updateFakeGHStore(storePath, func(store *fakeGHStore) error {
+		findPR := func(prURLOrNum string) (*github.PullRequest, error) {
+			prNum, ok := github.ParsePRNum(prURLOrNum)
+			if !ok || prNum < 1 || prNum > len(store.PRs) {
+				return nil, fmt.Errorf("no pull requests found for %q", prURLOrNum)
+			}
+			return store.PRs[prNum-1], nil
+		}
+		openPRForBranch := func(branchName string) *github.PullRequest {
+			for _, pr := range store.PRs {
+				if pr.HeadRefName == branchName && pr.State == "OPEN" {
+					return pr
+				}
+			}
+			return nil
+		}
+		toJSON := func(v any) error {
+			content, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			out = string(content) + "\n"
+			return nil
+		}
+
+		switch command {
+		case "pr list":
+			prs := []*github.PullRequest{}
+			if pr := openPRForBranch(flags["-H"][0]); pr != nil {
+				prs = append(prs, pr)
+			}
+			return toJSON(prs)
+		case "pr view":
+			pr, err := findPR(positional[0])
+			if err != nil {
+				return err
+			}
+			return toJSON(pr)
+		case "pr create":
+			base := "main"
+			if len(flags["--base"]) != 0 {
+				base = flags["--base"][0]
+			}
+			// Heads pushed to a fork are given as owner:branch.
+			headOwner, head, ok := strings.Cut(flags["--head"][0], ":")
+			if !ok {
+				headOwner, head = "owner", flags["--head"][0]
+			}
+			prNum := len(store.PRs) + 1
+			pr := &github.PullRequest{
+				BaseRefName:         base,
+				HeadRefName:         head,
+				HeadRepositoryOwner: github.RepositoryOwner{Login: headOwner},
+				State:               "OPEN",
+				URL:                 fmt.Sprintf("%s/pull/%d", FakeRepoURL, prNum),
+				Number:              prNum,
+				Title:               flags["--title"][0],
+				Body:                flags["--body"][0],
+			}
+			store.PRs = append(store.PRs, pr)
+			out = pr.URL + "\n"
+			return nil
+		case "pr edit":
+			pr, err := findPR(positional[0])
+			if err != nil {
+				return err
+			}
+			if base, ok := flags["--base"]; ok {
+				err := exec.Command(
+					"git", "--git-dir", store.OriginDir, "show-ref", "--verify", "-q", "refs/heads/"+base[0],
+				).Run()
+				if err != nil {
+					return fmt.Errorf("Proposed base branch '%s' was not found", base[0])
+				}
+				pr.BaseRefName = base[0]
+				if statuses, ok := store.RetargetStatuses[pr.Number]; ok {
+					if store.Statuses == nil {
+						store.Statuses = make(map[int]*github.PRStatus)
+					}
+					if store.NextStatuses == nil {
+						store.NextStatuses = make(map[int][]*github.PRStatus)
+					}
+					store.Statuses[pr.Number] = statuses[0]
+					store.NextStatuses[pr.Number] = statuses[1:]
+				}
+			}
+			if title, ok := flags["--title"]; ok {
+				pr.Title = title[0]
+			}
+			if body, ok := flags["--body"]; ok {
+				pr.Body = body[0]
+			}
+			out = pr.URL + "\n"
+			return nil
+		case "pr merge":
+			pr, err := findPR(positional[0])
+			if err != nil {
+				return err
+			}
+			if pr.State != "OPEN" {
+				return fmt.Errorf("Pull request #%d is not open", pr.Number)
+			}
+			if status := store.Statuses[pr.Number]; status != nil && status.Mergeable == "CONFLICTING" {
+				return fmt.Errorf("Pull request #%d is not mergeable", pr.Number)
+			}
+			if message, ok := store.MergeErrors[pr.Number]; ok {
+				return errors.New(message)
+			}
+			_, isMergeCommit := flags["--merge"]
+			err = fakeGHMerge(store.OriginDir, pr, isMergeCommit)
+			if err != nil {
+				return err
+			}
+			pr.State = "MERGED"
+			return nil
+		case "pr close":
+			pr, err := findPR(positional[0])
+			if err != nil {
+				return err
+			}
+			if pr.State != "OPEN" {
+				return fmt.Errorf("Pull request #%d is not open", pr.Number)
+			}
+			if comment, ok := flags["--comment"]; ok {
+				if store.Comments == nil {
+					store.Comments = make(map[int][]string)
+				}
+				store.Comments[pr.Number] = append(store.Comments[pr.Number], comment[0])
+			}
+			pr.State = "CLOSED"
+			return nil
+		case "repo view":
+			return toJSON(map[string]string{"url": FakeRepoURL})
+		case "api graphql":
+			variables := make(map[string]string)
+			for _, flag := range append(flags["-f"], flags["-F"]...) {
+				name, value, _ := strings.Cut(flag, "=")
+				variables[name] = value
+			}
+			repository := make(map[string]any)
+			for name, value := range variables {
+				if strings.HasPrefix(name, "b") {
+					nodes := []*github.PullRequest{}
+					if pr := openPRForBranch(value); pr != nil {
+						nodes = append(nodes, pr)
+					}
+					repository[name] = map[string]any{"nodes": nodes}
+				}
+			}
+			for _, match := range fakeGHPRNumAliasRegexp.FindAllStringSubmatch(variables["query"], -1) {
+				pr, err := findPR(match[2])
+				if err != nil {
+					repository[match[1]] = nil
+					continue
+				}
+				if strings.Contains(variables["query"], "statusCheckRollup") {
+					repository[match[1]] = fakeGHPRStatus(pr.Number, store.Statuses[pr.Number])
+					if next := store.NextStatuses[pr.Number]; len(next) > 0 {
+						store.Statuses[pr.Number] = next[0]
+						store.NextStatuses[pr.Number] = next[1:]
+					}
+					continue
+				}
+				repository[match[1]] = pr
+			}
+			return toJSON(map[string]any{"data": map[string]any{"repository": repository}})
+		}
+		return fmt.Errorf("fake gh: unsupported command %q", args)
+	})
+	return out, err
+}
+
+// Merges the head branch of the PR into its base branch in the origin repository,
+// with a merge commit or a single commit like squash and rebase merges.
+func fakeGHMerge(originDir string, pr *github.PullRequest, isMergeCommit bool) error {
+	git := func(args ...string) (string, error) {
+		out, err := exec.Command("git", append([]string{"--git-dir", originDir}, args...)...).Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	base := "refs/heads/" + pr.BaseRefName
+	head := "refs/heads/" + pr.HeadRefName
+	tree, err := git("merge-tree", "--write-tree", base, head)
+	if err != nil {
+		return fmt.Errorf("Pull request #%d is not mergeable", pr.Number)
+	}
+	args := []string{"commit-tree", tree, "-p", base}
+	if isMergeCommit {
+		args = append(args, "-p", head, "-m", fmt.Sprintf("Merge pull request #%d", pr.Number))
+	} else {
+		args = append(args, "-m", fmt.Sprintf("%s (#%d)", pr.Title, pr.Number))
+	}
+	commit, err := git(args...)
+	if err != nil {
+		return fmt.Errorf("creating merge commit: %w", err)
+	}
+	_, err = git("update-ref", base, commit)
+	if err != nil {
+		return fmt.Errorf("updating base branch: %w", err)
+	}
+	return nil
+}
+
+// Returns the status of a PR in the shape of the GraphQL API.
+func fakeGHPRStatus(prNum int, status *github.PRStatus) map[string]any {
+	if status == nil {
+		status = &github.PRStatus{Mergeable: "MERGEABLE"}
+	}
+	var rollup any
+	if status.CheckState != "" {
+		rollup = map[string]string{"state": status.CheckState}
+	}
+	return map[string]any{
+		"number":         prNum,
+		"isDraft":        status.IsDraft,
+		"reviewDecision": status.ReviewDecision,
+		"mergeable":      status.Mergeable,
+		"commits": map[string]any{
+			"nodes": []any{map[string]any{"commit": map[string]any{"statusCheckRollup": rollup}}},
+		},
+	}
+}
+
+// Splits the arguments into flag values and positional arguments.
+// Flags without a value, such as --draft or --squash, are recorded with the value "true".
+func parseFakeGHArgs(args []string) (map[string][]string, []string) {
+	flags := make(map[string][]string)
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			positional = append(positional, arg)
+			continue
+		}
+		if arg == "--draft" || arg == "--squash" || arg == "--merge" || arg == "--rebase" {
+			flags[arg] = append(flags[arg], "true")
+			continue
+		}
+		if i+1 < len(args) {
+			flags[arg] = append(flags[arg], args[i+1])
+			i++
+		}
+	}
+	return flags, positional
+}
@@ -0,0 +1,197 @@
+// Package testutil provides hermetic git repositories and a fake gh CLI for integration tests.
+package testutil
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Repo is a throwaway git repository with a bare "origin" remote.
+// Creating one isolates the test from the user's git and gh configuration
+// and changes the working directory to the repository.
+type Repo struct {
+	t *testing.T
+	// Working copy.
+	Dir string
+	// Bare repository used as the "origin" remote.
+	OriginDir string
+}
+
+const gitConfig = `[user]
+	name = Test
+	email = test@example.com
+[init]
+	defaultBranch = main
+[advice]
+	detachedHead = false
+`
+
+// NewRepo creates a repository with one commit on main, pushed to origin.
+func NewRepo(t *testing.T) *Repo {
+	t.Helper()
+	root := t.TempDir()
+	home := filepath.Join(root, "home")
+	err := os.Mkdir(home, 0o755)
+	if err != nil {
+		t.Fatalf("creating home directory: %s", err)
+	}
+	err = os.WriteFile(filepath.Join(home, ".gitconfig"), []byte(gitConfig), 0o644)
+	if err != nil {
+		t.Fatalf("writing git config: %s", err)
+	}
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GH_CONFIG_DIR", filepath.Join(home, ".config", "gh"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(home, ".gitconfig"))
+	t.Setenv("GIT_EDITOR", "true")
+	for _, envVar := range []string{
+		"GH_TOKEN",
+		"GITHUB_TOKEN",
+		"GH_ENTERPRISE_TOKEN",
+		"GITHUB_ENTERPRISE_TOKEN",
+		"GIT_DIR",
+		"GIT_WORK_TREE",
+	} {
+		t.Setenv(envVar, "")
+		os.Unsetenv(envVar)
+	}
+
+	r := &Repo{
+		t:         t,
+		Dir:       filepath.Join(root, "work"),
+		OriginDir: filepath.Join(root, "origin.git"),
+	}
+	r.run(root, "git", "init", "-q", "--bare", r.OriginDir)
+	r.run(root, "git", "init", "-q", r.Dir)
+
+	// Commands run in the working directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getting working directory: %s", err)
+	}
+	err = os.Chdir(r.Dir)
+	if err != nil {
+		t.Fatalf("changing working directory: %s", err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+
+	r.Git("remote", "add", "origin", r.OriginDir)
+	r.CommitFile("README.md", "init\n", "Initial commit")
+	r.Git("push", "-q", "-u", "origin", "main")
+	r.Git("remote", "set-head", "origin", "main")
+	return r
+}
+
+func (r *Repo) run(dir string, name string, args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("running %s %s: %s: %s", name, strings.Join(args, " "), err, out)
+	}
+	return strings.TrimRight(string(out), "\n")
+}
+
+// Git runs git in the working copy and returns its output without the trailing newline.
+func (r *Repo) Git(args ...string) string {
+	r.t.Helper()
+	return r.run(r.Dir, "git", args...)
+}
+
+// WriteFile writes a file relative to the root of the working copy.
+func (r *Repo) WriteFile(name string, content string) {
+	r.t.Helper()
+	path := filepath.Join(r.Dir, name)
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		r.t.Fatalf("creating directory of %q: %s", name, err)
+	}
+	err = os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		r.t.Fatalf("writing %q: %s", name, err)
+	}
+}
+
+// ReadFile reads a file relative to the root of the working copy.
+func (r *Repo) ReadFile(name string) string {
+	r.t.Helper()
+	content, err := os.ReadFile(filepath.Join(r.Dir, name))
+	if err != nil {
+		r.t.Fatalf("reading %q: %s", name, err)
+	}
+	return string(content)
+}
+
+// CommitFile writes a file and commits all the changes on the current branch.
+// Returns the hash of the new commit.
+func (r *Repo) CommitFile(name string, content string, message string) string {
+	r.t.Helper()
+	r.WriteFile(name, content)
+	r.Git("add", "--all")
+	r.Git("commit", "-q", "-m", message)
+	return r.Git("rev-parse", "HEAD")
+}
+
+// CreateBranch creates a branch at the current commit with a branch description, and checks it out.
+func (r *Repo) CreateBranch(name string) {
+	r.t.Helper()
+	r.Git("switch", "-q", "-c", name)
+	r.SetBranchDescription(name, "Title of "+name, "Description of "+name)
+}
+
+// SetBranchDescription sets the branch description that is used as the PR title and body.
+func (r *Repo) SetBranchDescription(branch string, title string, body string) {
+	r.t.Helper()
+	r.Git("config", "branch."+branch+".description", title+"\n\n"+body)
+}
+
+// Checkout switches to a branch.
+func (r *Repo) Checkout(branch string) {
+	r.t.Helper()
+	r.Git("switch", "-q", branch)
+}
+
+// CurrentBranch returns the name of the branch checked out.
+func (r *Repo) CurrentBranch() string {
+	r.t.Helper()
+	return r.Git("branch", "--show-current")
+}
+
+// Hash returns the commit hash of a rev.
+func (r *Repo) Hash(rev string) string {
+	r.t.Helper()
+	return r.Git("rev-parse", rev)
+}
+
+// BranchExists returns whether a local branch exists.
+func (r *Repo) BranchExists(branch string) bool {
+	r.t.Helper()
+	return r.Git("branch", "--list", branch) != ""
+}
+
+// IsAncestor returns whether the first rev is an ancestor of the second one.
+func (r *Repo) IsAncestor(ancestor string, rev string) bool {
+	r.t.Helper()
+	cmd := exec.Command("git", "merge-base", "--is-ancestor", ancestor, rev)
+	cmd.Dir = r.Dir
+	return cmd.Run() == nil
+}
+
+// Status returns the short status of the working copy.
+func (r *Repo) Status() string {
+	r.t.Helper()
+	return r.Git("status", "--short")
+}
+
+// OriginGit runs git in the origin repository, e.g. to simulate changes made by others.
+func (r *Repo) OriginGit(args ...string) string {
+	r.t.Helper()
+	return r.run(r.OriginDir, "git", args...)
+}